@@ -0,0 +1,117 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package platform_connector_lib
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/SENERGY-Platform/platform-connector-lib/model"
+)
+
+// deviceCommand, hubCommand, protocolCommand and characteristicCommand are the messages of the device-repository command topics
+type deviceCommand struct {
+	Command string       `json:"command"`
+	Id      string       `json:"id"`
+	Device  model.Device `json:"device"`
+}
+
+type hubCommand struct {
+	Command string    `json:"command"`
+	Id      string    `json:"id"`
+	Hub     model.Hub `json:"hub"`
+}
+
+type protocolCommand struct {
+	Command string `json:"command"`
+	Id      string `json:"id"`
+}
+
+type characteristicCommand struct {
+	Command string `json:"command"`
+	Id      string `json:"id"`
+}
+
+func (this *Connector) startIotCacheInvalidation(ctx context.Context, maxWait time.Duration) {
+	consumers := []struct {
+		name       string
+		topic      string
+		invalidate func(msg []byte) error
+	}{
+		{name: "device", topic: this.Config.DeviceTopic, invalidate: this.invalidateDevice},
+		{name: "hub", topic: this.Config.HubTopic, invalidate: this.invalidateHub},
+		{name: "protocol", topic: this.Config.ProtocolTopic, invalidate: this.invalidateProtocol},
+		{name: "characteristic", topic: this.Config.CharacteristicTopic, invalidate: this.invalidateCharacteristic},
+	}
+	for _, consumer := range consumers {
+		if !isSet(consumer.topic) {
+			continue
+		}
+		err := this.startCacheInvalidationConsumer(ctx, maxWait, consumer.topic, consumer.invalidate)
+		if err != nil {
+			this.Config.GetLogger().Error("unable to start "+consumer.name+" consumer", "error", err, "topic", consumer.topic)
+		}
+	}
+}
+
+func (this *Connector) invalidateDevice(msg []byte) error {
+	command := deviceCommand{}
+	err := json.Unmarshal(msg, &command)
+	if err != nil {
+		return err
+	}
+	this.Config.GetLogger().Debug("invalidate cache for device", "id", command.Id)
+	this.IotCache.InvalidateDeviceCache(command.Id, command.Device.LocalId)
+	return nil
+}
+
+// invalidateHub invalidates the devices of the hub; hubs are not cached
+func (this *Connector) invalidateHub(msg []byte) error {
+	command := hubCommand{}
+	err := json.Unmarshal(msg, &command)
+	if err != nil {
+		return err
+	}
+	this.Config.GetLogger().Debug("invalidate cache for devices of hub", "id", command.Id)
+	for _, deviceId := range command.Hub.DeviceIds {
+		this.IotCache.InvalidateDeviceCache(deviceId, command.Hub.DeviceLocalIds...)
+	}
+	return nil
+}
+
+func (this *Connector) invalidateProtocol(msg []byte) error {
+	command := protocolCommand{}
+	err := json.Unmarshal(msg, &command)
+	if err != nil {
+		return err
+	}
+	this.Config.GetLogger().Debug("invalidate cache for protocol", "id", command.Id)
+	this.IotCache.InvalidateProtocolCache(command.Id)
+	return nil
+}
+
+func (this *Connector) invalidateCharacteristic(msg []byte) error {
+	command := characteristicCommand{}
+	err := json.Unmarshal(msg, &command)
+	if err != nil {
+		return err
+	}
+	this.Config.GetLogger().Debug("invalidate cache for characteristic", "id", command.Id)
+	this.IotCache.InvalidateCharacteristicCache(command.Id)
+	return nil
+}
@@ -18,23 +18,28 @@ package platform_connector_lib
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
-	"log"
 	"net/http"
-	"runtime/debug"
 	"strings"
 	"time"
 
+	"github.com/SENERGY-Platform/platform-connector-lib/grpccommand"
 	"github.com/SENERGY-Platform/platform-connector-lib/model"
 )
 
 func (this *Connector) handleCommand(msg []byte, t time.Time) (err error) {
+	if !this.startCommand() {
+		return ErrShuttingDown
+	}
+	defer this.finishCommand()
 	protocolmsg := model.ProtocolMsg{}
 	err = json.Unmarshal(msg, &protocolmsg)
 	if err != nil {
 		this.Config.GetLogger().Warn("invalid command", "error", err, "msg", string(msg))
+		this.deadLetterCommand(context.Background(), DeadLetter{ErrorClass: DeadLetterMarshalling, Time: t}, msg, err)
 		return nil
 	}
 	protocolmsg.Trace = append(protocolmsg.Trace, model.Trace{
@@ -43,22 +48,70 @@ func (this *Connector) handleCommand(msg []byte, t time.Time) (err error) {
 		Location:  "github.com/SENERGY-Platform/platform-connector-lib handleCommand() after unmarshal",
 	})
 	protocolParts := protocolmsg.Request.Input
+	options := this.getCommandOptions(protocolmsg.Metadata.Service.Id)
+	if options.MaxAge > 0 {
+		if age := time.Since(getCommandTime(protocolmsg, t)); age > options.MaxAge {
+			this.Config.GetLogger().Warn("drop expired command", "age", age, "deviceId", protocolmsg.Metadata.Device.Id, "serviceId", protocolmsg.Metadata.Service.Id)
+			this.HandleCommandErrorWithReason(protocolmsg.Metadata.Device.OwnerId, protocolmsg, CommandErrorExpired, ErrCommandExpired.Error()+" (age "+age.Round(time.Second).String()+")")
+			return nil
+		}
+	}
+	if this.deviceCommandHandler == nil && this.asyncCommandHandler == nil {
+		return errors.New("missing command handler")
+	}
+	//duplicates are dropped before they count against the rate limit
+	if this.deduplicateCommand(protocolmsg) {
+		return nil
+	}
+	if err = this.allow(this.rateLimits.Device, "device", protocolmsg.Metadata.Device.Id, "command"); err != nil {
+		this.Config.GetLogger().Warn("drop rate limited command", "deviceId", protocolmsg.Metadata.Device.Id, "serviceId", protocolmsg.Metadata.Service.Id)
+		this.cancelCommandDeduplication(protocolmsg)
+		this.HandleCommandErrorWithReason(protocolmsg.Metadata.Device.OwnerId, protocolmsg, CommandErrorRateLimited, err.Error())
+		return nil
+	}
 	if this.deviceCommandHandler != nil {
-		handlerResponse, qos, err := this.useDeviceCommandHandler(protocolmsg, protocolParts)
+		handlerResponse, qos, reason, err := this.useDeviceCommandHandlerWithOptions(protocolmsg, protocolParts, options)
 		if err != nil {
-			return err
+			if options == (CommandOptions{}) {
+				//without CommandOptions the error is only returned to the consumer
+				this.cancelCommandDeduplication(protocolmsg)
+				this.resolveSyncCommand(protocolmsg, nil, getSyncCommandError(reason, err.Error()))
+				return err
+			}
+			//a timed out handler may still be running; the de-duplication marker prevents a second execution until its lease expires
+			if reason != CommandErrorTimeout {
+				this.cancelCommandDeduplication(protocolmsg)
+			}
+			//sync callers receive the original error to keep its http status
+			this.resolveSyncCommand(protocolmsg, nil, wrapSyncCommandError(reason, err))
+			//the error is reported; the command must not be redelivered
+			this.HandleCommandErrorWithReason(protocolmsg.Metadata.Device.OwnerId, protocolmsg, reason, err.Error())
+			return nil
 		}
 		return this.HandleCommandResponse(protocolmsg, handlerResponse, qos)
-	} else if this.asyncCommandHandler != nil {
-		return this.asyncCommandHandler(protocolmsg, protocolParts, t)
 	}
-	return errors.New("missing command handler")
+	err = this.asyncCommandHandler(protocolmsg, protocolParts, t)
+	if err != nil {
+		this.cancelCommandDeduplication(protocolmsg)
+	}
+	return err
 }
 
 func (this *Connector) HandleCommandResponse(commandRequest model.ProtocolMsg, commandResponse CommandResponseMsg, qos Qos) (err error) {
+	this.finishCommandDeduplication(commandRequest, commandResponse, qos)
+	if this.resolveSyncCommand(commandRequest, commandResponse, nil) {
+		this.trySendingResponseAsEvent(commandRequest, commandResponse, qos)
+		return nil
+	}
 	if commandRequest.TaskInfo.CompletionStrategy == model.Optimistic {
 		return
 	}
+	err = this.produceCommandResponse(commandRequest, commandResponse, qos)
+	this.trySendingResponseAsEvent(commandRequest, commandResponse, qos)
+	return err
+}
+
+func (this *Connector) produceCommandResponse(commandRequest model.ProtocolMsg, commandResponse CommandResponseMsg, qos Qos) (err error) {
 	commandRequest.Response.Output = commandResponse
 	commandRequest.Trace = append(commandRequest.Trace, model.Trace{
 		Timestamp: time.Now().UnixNano(),
@@ -76,7 +129,13 @@ func (this *Connector) HandleCommandResponse(commandRequest model.ProtocolMsg, c
 		topic = this.Config.KafkaResponseTopic
 	}
 
-	if strings.HasPrefix(topic, "http://") || strings.HasPrefix(topic, "https://") {
+	if grpccommand.IsResponseTo(topic) && this.grpcServer != nil {
+		err = this.grpcServer.SendTo(topic, grpccommand.Message{Response: responseMsg})
+		if err != nil {
+			this.Config.GetLogger().Error("grpc producer error", "error", err)
+			return err
+		}
+	} else if strings.HasPrefix(topic, "http://") || strings.HasPrefix(topic, "https://") {
 		resp, err := http.Post(topic, "application/json", bytes.NewReader(responseMsg))
 		if err != nil {
 			this.Config.GetLogger().Error("http producer error", "error", err, "topic", topic)
@@ -97,17 +156,12 @@ func (this *Connector) HandleCommandResponse(commandRequest model.ProtocolMsg, c
 		}
 		err = producer.ProduceWithKey(topic, string(responseMsg), commandRequest.Metadata.Device.Id)
 		if err != nil && this.Config.FatalKafkaError {
-			if this.Config.Debug {
-				debug.PrintStack()
-			}
-			log.Fatal("FATAL: ", err)
+			this.fatal(&FatalError{Source: FatalCommandResponse, Topic: topic, Err: err})
 		}
 	}
-
-	this.trySendingResponseAsEvent(commandRequest, commandResponse, qos)
 	return err
 }
 
-func (this *Connector) useDeviceCommandHandler(msg model.ProtocolMsg, protocolParts map[string]string) (result map[string]string, qos Qos, err error) {
-	return this.deviceCommandHandler(msg.Metadata.Device.Id, msg.Metadata.Device.LocalId, msg.Metadata.Service.Id, msg.Metadata.Service.LocalId, protocolParts)
+func (this *Connector) useDeviceCommandHandler(ctx context.Context, msg model.ProtocolMsg, protocolParts map[string]string) (result map[string]string, qos Qos, err error) {
+	return this.deviceCommandHandler(ctx, msg.Metadata.Device.Id, msg.Metadata.Device.LocalId, msg.Metadata.Service.Id, msg.Metadata.Service.LocalId, protocolParts)
 }
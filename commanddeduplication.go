@@ -0,0 +1,152 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package platform_connector_lib
+
+import (
+	"errors"
+	"time"
+
+	"github.com/SENERGY-Platform/platform-connector-lib/deduplication"
+	"github.com/SENERGY-Platform/platform-connector-lib/model"
+)
+
+// DefaultCommandDeduplicationLease limits how long a command is considered in progress
+var DefaultCommandDeduplicationLease = time.Minute
+
+type commandDeduplication struct {
+	store deduplication.Store
+	ttl   time.Duration
+	lease time.Duration //ttl of in progress markers; a marker of a crashed instance expires after the lease
+}
+
+// SetCommandDeduplication enables the de-duplication of commands by TaskInfo.TaskId, device id and service id;
+// a duplicate of a handled command replays the previous response, a duplicate of a command in progress is dropped;
+// overwrites the values of Config.CommandDeduplicationTtl, Config.CommandDeduplicationSize and Config.CommandDeduplicationUrl
+func (this *Connector) SetCommandDeduplication(store deduplication.Store, ttl time.Duration) *Connector {
+	if store == nil || ttl <= 0 {
+		this.commandDeduplication = nil
+		return this
+	}
+	this.commandDeduplication = &commandDeduplication{store: store, ttl: ttl, lease: min(ttl, DefaultCommandDeduplicationLease)}
+	return this
+}
+
+// SetCommandDeduplicationLease sets how long a command is considered in progress, before a redelivered duplicate is handled again;
+// should be longer than the max duration of the command handler; must be called after SetCommandDeduplication
+func (this *Connector) SetCommandDeduplicationLease(lease time.Duration) *Connector {
+	if this.commandDeduplication != nil && lease > 0 {
+		this.commandDeduplication.lease = min(this.commandDeduplication.ttl, lease)
+	}
+	return this
+}
+
+func getCommandDeduplicationFromConfig(config Config) (result *commandDeduplication, err error) {
+	if !isSet(config.CommandDeduplicationTtl) {
+		return nil, nil
+	}
+	ttl, err := time.ParseDuration(config.CommandDeduplicationTtl)
+	if err != nil {
+		return nil, errors.New("unable to parse CommandDeduplicationTtl as duration: " + err.Error())
+	}
+	lease := DefaultCommandDeduplicationLease
+	if isSet(config.CommandDeduplicationLease) {
+		lease, err = time.ParseDuration(config.CommandDeduplicationLease)
+		if err != nil {
+			return nil, errors.New("unable to parse CommandDeduplicationLease as duration: " + err.Error())
+		}
+	}
+	var store deduplication.Store
+	if len(config.CommandDeduplicationUrl) > 0 && isSet(config.CommandDeduplicationUrl[0]) {
+		store = deduplication.NewMemcachedStore(config.IotCacheMaxIdleConns, 200*time.Millisecond, config.CommandDeduplicationUrl...)
+	} else {
+		store = deduplication.NewLruStore(config.CommandDeduplicationSize)
+	}
+	return &commandDeduplication{store: store, ttl: ttl, lease: min(ttl, lease)}, nil
+}
+
+func getCommandKey(msg model.ProtocolMsg) (key string, ok bool) {
+	if msg.TaskInfo.TaskId == "" {
+		return "", false
+	}
+	return msg.TaskInfo.TaskId + "|" + msg.Metadata.Device.Id + "|" + msg.Metadata.Service.Id, true
+}
+
+// deduplicateCommand returns true if the command is a duplicate and must not be passed to the command handler;
+// otherwise the command is marked as in progress
+func (this *Connector) deduplicateCommand(msg model.ProtocolMsg) (duplicate bool) {
+	if this.commandDeduplication == nil {
+		return false
+	}
+	key, ok := getCommandKey(msg)
+	if !ok {
+		return false
+	}
+	logger := this.Config.GetLogger()
+	entry, added, err := this.commandDeduplication.store.Add(key, deduplication.Entry{}, this.commandDeduplication.lease)
+	if err != nil {
+		logger.Error("unable to use command de-duplication store; handle command", "error", err, "taskId", msg.TaskInfo.TaskId)
+		return false
+	}
+	if added {
+		return false
+	}
+	if !entry.Done {
+		logger.Warn("drop duplicate command in progress", "taskId", msg.TaskInfo.TaskId, "deviceId", msg.Metadata.Device.Id, "serviceId", msg.Metadata.Service.Id)
+		return true
+	}
+	logger.Info("replay response of duplicate command", "taskId", msg.TaskInfo.TaskId, "deviceId", msg.Metadata.Device.Id, "serviceId", msg.Metadata.Service.Id)
+	if this.resolveSyncCommand(msg, entry.Response, nil) {
+		return true
+	}
+	if msg.TaskInfo.CompletionStrategy != model.Optimistic {
+		err = this.produceCommandResponse(msg, entry.Response, Qos(entry.Qos))
+		if err != nil {
+			logger.Error("unable to replay command response", "error", err, "taskId", msg.TaskInfo.TaskId)
+		}
+	}
+	return true
+}
+
+// finishCommandDeduplication stores the response for replays
+func (this *Connector) finishCommandDeduplication(msg model.ProtocolMsg, response CommandResponseMsg, qos Qos) {
+	if this.commandDeduplication == nil {
+		return
+	}
+	key, ok := getCommandKey(msg)
+	if !ok {
+		return
+	}
+	err := this.commandDeduplication.store.Set(key, deduplication.Entry{Done: true, Response: response, Qos: int(qos)}, this.commandDeduplication.ttl)
+	if err != nil {
+		this.Config.GetLogger().Error("unable to write command de-duplication store", "error", err, "taskId", msg.TaskInfo.TaskId)
+	}
+}
+
+// cancelCommandDeduplication allows a redelivered command to be handled again after a failure
+func (this *Connector) cancelCommandDeduplication(msg model.ProtocolMsg) {
+	if this.commandDeduplication == nil {
+		return
+	}
+	key, ok := getCommandKey(msg)
+	if !ok {
+		return
+	}
+	err := this.commandDeduplication.store.Delete(key)
+	if err != nil {
+		this.Config.GetLogger().Error("unable to write command de-duplication store", "error", err, "taskId", msg.TaskInfo.TaskId)
+	}
+}
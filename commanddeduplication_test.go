@@ -0,0 +1,169 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package platform_connector_lib
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SENERGY-Platform/platform-connector-lib/connectionlimit"
+	"github.com/SENERGY-Platform/platform-connector-lib/deduplication"
+	"github.com/SENERGY-Platform/platform-connector-lib/model"
+	"github.com/SENERGY-Platform/platform-connector-lib/security"
+)
+
+func TestCommandDeduplication(t *testing.T) {
+	mux := sync.Mutex{}
+	responses := []string{}
+	responseTo := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		msg := model.ProtocolMsg{}
+		err := json.NewDecoder(request.Body).Decode(&msg)
+		if err != nil {
+			t.Error(err)
+		}
+		mux.Lock()
+		defer mux.Unlock()
+		responses = append(responses, msg.Response.Output["count"])
+	}))
+	defer responseTo.Close()
+
+	sec, err := security.New("http://localhost:0", "", "", "", "", 0, 0, 0, nil, 0, 0, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := 0
+	ctl := &Connector{security: sec} //responses are not sent as events, because no token is available
+	ctl.SetDeviceCommandHandler(func(deviceId string, deviceUri string, serviceId string, serviceUri string, requestMsg CommandRequestMsg) (responseMsg CommandResponseMsg, qos Qos, err error) {
+		calls++
+		if serviceId == "failing" && calls == 3 {
+			return nil, Sync, errors.New("failed")
+		}
+		return CommandResponseMsg{"count": strconv.Itoa(calls)}, Sync, nil
+	})
+	ctl.SetCommandDeduplication(deduplication.NewLruStore(10), time.Minute)
+
+	command := func(taskId string, serviceId string) []byte {
+		msg := model.ProtocolMsg{
+			TaskInfo: model.TaskInfo{TaskId: taskId},
+			Metadata: model.Metadata{ResponseTo: responseTo.URL, ErrorTo: responseTo.URL, Device: model.Device{Id: "d1"}, Service: model.Service{Id: serviceId}},
+		}
+		result, _ := json.Marshal(msg)
+		return result
+	}
+
+	for _, c := range []struct {
+		taskId    string
+		serviceId string
+		fails     bool
+	}{
+		{taskId: "t1", serviceId: "s1"},
+		{taskId: "t1", serviceId: "s1"}, //duplicate
+		{taskId: "t1", serviceId: "s2"},
+		{taskId: "t2", serviceId: "failing", fails: true},
+		{taskId: "t2", serviceId: "failing"}, //redelivery after failure
+		{taskId: "t2", serviceId: "failing"}, //duplicate
+		{taskId: "", serviceId: "s1"},
+		{taskId: "", serviceId: "s1"}, //no task id
+	} {
+		err = ctl.handleCommand(command(c.taskId, c.serviceId), time.Now())
+		if (err != nil) != c.fails {
+			t.Error(c, err)
+		}
+	}
+
+	if calls != 6 {
+		t.Error(calls)
+	}
+	mux.Lock()
+	defer mux.Unlock()
+	expected := []string{"1", "1", "2", "4", "4", "5", "6"} //without CommandOptions errors are not sent to ErrorTo
+	if len(responses) != len(expected) {
+		t.Fatal(responses)
+	}
+	for i, response := range expected {
+		if responses[i] != response {
+			t.Error(responses)
+		}
+	}
+}
+
+func TestCommandDeduplicationLease(t *testing.T) {
+	calls := atomic.Int64{}
+	ctl := &Connector{}
+	ctl.SetAsyncCommandHandler(func(commandRequest model.ProtocolMsg, requestMsg CommandRequestMsg, t time.Time) (err error) {
+		calls.Add(1) //no response; command stays in progress
+		return nil
+	})
+	ctl.SetCommandDeduplication(deduplication.NewLruStore(10), time.Minute).SetCommandDeduplicationLease(100 * time.Millisecond)
+
+	command, _ := json.Marshal(model.ProtocolMsg{TaskInfo: model.TaskInfo{TaskId: "t1"}, Metadata: model.Metadata{Device: model.Device{Id: "d1"}, Service: model.Service{Id: "s1"}}})
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = ctl.handleCommand(command, time.Now())
+		}()
+	}
+	wg.Wait()
+	if calls.Load() != 1 {
+		t.Error(calls.Load())
+	}
+
+	time.Sleep(150 * time.Millisecond) //lease of the in progress marker expired
+	err := ctl.handleCommand(command, time.Now())
+	if err != nil {
+		t.Error(err)
+	}
+	if calls.Load() != 2 {
+		t.Error(calls.Load())
+	}
+}
+
+func TestCommandDeduplicationRateLimit(t *testing.T) {
+	calls := atomic.Int64{}
+	ctl := &Connector{}
+	ctl.SetAsyncCommandHandler(func(commandRequest model.ProtocolMsg, requestMsg CommandRequestMsg, t time.Time) (err error) {
+		calls.Add(1)
+		return nil
+	})
+	ctl.SetCommandDeduplication(deduplication.NewLruStore(10), time.Minute)
+	ctl.SetRateLimits(RateLimits{Device: connectionlimit.NewRateLimiter("device", connectionlimit.RateLimit{Rate: 1, Burst: 2}, slog.Default())})
+
+	command := func(taskId string) []byte {
+		result, _ := json.Marshal(model.ProtocolMsg{TaskInfo: model.TaskInfo{TaskId: taskId}, Metadata: model.Metadata{Device: model.Device{Id: "d1"}, Service: model.Service{Id: "s1"}}})
+		return result
+	}
+	//the duplicate must not use up the quota of the following command
+	for _, taskId := range []string{"t1", "t1", "t2"} {
+		err := ctl.handleCommand(command(taskId), time.Now())
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if calls.Load() != 2 {
+		t.Error(calls.Load())
+	}
+}
@@ -0,0 +1,172 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package platform_connector_lib
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SENERGY-Platform/platform-connector-lib/model"
+)
+
+type CommandOptions struct {
+	Timeout      time.Duration //optional; max duration of a single DeviceCommandHandler call
+	MaxAge       time.Duration //optional; older commands are not executed (age is based on TaskInfo.Time or the message time)
+	Retries      int           //optional; number of retries after a failed DeviceCommandHandler call; timed out calls are not retried, because the handler may still be running
+	RetryBackoff time.Duration //optional; wait before the first retry, doubled for every further retry; default 1s
+}
+
+type CommandErrorReason string
+
+const (
+	CommandErrorExpired CommandErrorReason = "expired"
+	CommandErrorTimeout CommandErrorReason = "timeout"
+	CommandErrorFailed  CommandErrorReason = "failed"
+)
+
+var ErrCommandTimeout = errors.New("command timeout")
+var ErrCommandExpired = errors.New("command expired")
+
+// SetCommandOptions sets the default CommandOptions; overwrites the values of Config.CommandTimeout, Config.CommandMaxAge, Config.CommandRetries and Config.CommandRetryBackoff
+func (this *Connector) SetCommandOptions(options CommandOptions) *Connector {
+	this.commandOptions = options
+	return this
+}
+
+// SetServiceCommandOptions sets the CommandOptions for commands to the service
+func (this *Connector) SetServiceCommandOptions(serviceId string, options CommandOptions) *Connector {
+	if this.serviceCommandOptions == nil {
+		this.serviceCommandOptions = map[string]CommandOptions{}
+	}
+	this.serviceCommandOptions[serviceId] = options
+	return this
+}
+
+func (this *Connector) getCommandOptions(serviceId string) CommandOptions {
+	if options, ok := this.serviceCommandOptions[serviceId]; ok {
+		return options
+	}
+	return this.commandOptions
+}
+
+func getCommandOptionsFromConfig(config Config) (result CommandOptions, err error) {
+	result.Retries = config.CommandRetries
+	for _, field := range []struct {
+		name  string
+		value string
+		ref   *time.Duration
+	}{
+		{name: "CommandTimeout", value: config.CommandTimeout, ref: &result.Timeout},
+		{name: "CommandMaxAge", value: config.CommandMaxAge, ref: &result.MaxAge},
+		{name: "CommandRetryBackoff", value: config.CommandRetryBackoff, ref: &result.RetryBackoff},
+	} {
+		if isSet(field.value) {
+			*field.ref, err = time.ParseDuration(field.value)
+			if err != nil {
+				return result, errors.New("unable to parse " + field.name + " as duration: " + err.Error())
+			}
+		}
+	}
+	return result, nil
+}
+
+// getCommandTime returns the TaskInfo.Time (unix seconds, unix milliseconds or RFC3339) or t as fallback
+func getCommandTime(msg model.ProtocolMsg, t time.Time) time.Time {
+	taskTime := strings.TrimSpace(msg.TaskInfo.Time)
+	if taskTime == "" {
+		return t
+	}
+	if unix, err := strconv.ParseInt(taskTime, 10, 64); err == nil {
+		if unix > 1e11 {
+			return time.UnixMilli(unix)
+		}
+		return time.Unix(unix, 0)
+	}
+	if parsed, err := time.Parse(time.RFC3339, taskTime); err == nil {
+		return parsed
+	}
+	return t
+}
+
+// useDeviceCommandHandlerWithOptions calls the DeviceCommandHandler with timeout and retries.
+// a timed out handler call is canceled by its context, but may still finish in the background; so it is not retried.
+// waiting for a retry is stopped by the shutdown of the connector.
+func (this *Connector) useDeviceCommandHandlerWithOptions(msg model.ProtocolMsg, protocolParts map[string]string, options CommandOptions) (result map[string]string, qos Qos, reason CommandErrorReason, err error) {
+	backoff := options.RetryBackoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+	for attempt := 0; attempt <= options.Retries; attempt++ {
+		if attempt > 0 {
+			this.Config.GetLogger().Warn("retry command", "error", err, "attempt", attempt, "backoff", backoff, "deviceId", msg.Metadata.Device.Id, "serviceId", msg.Metadata.Service.Id)
+			if !this.waitForRetry(backoff) {
+				break
+			}
+			backoff = backoff * 2
+		}
+		result, qos, err = this.useDeviceCommandHandlerWithTimeout(msg, protocolParts, options.Timeout)
+		if err == nil {
+			return result, qos, "", nil
+		}
+		if errors.Is(err, ErrCommandTimeout) {
+			break
+		}
+	}
+	if errors.Is(err, ErrCommandTimeout) {
+		return result, qos, CommandErrorTimeout, err
+	}
+	return result, qos, CommandErrorFailed, err
+}
+
+// waitForRetry returns false if the connector is shut down before backoff is over
+func (this *Connector) waitForRetry(backoff time.Duration) bool {
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-this.shutdownContext().Done():
+		return false
+	}
+}
+
+func (this *Connector) useDeviceCommandHandlerWithTimeout(msg model.ProtocolMsg, protocolParts map[string]string, timeout time.Duration) (result map[string]string, qos Qos, err error) {
+	if timeout <= 0 {
+		return this.useDeviceCommandHandler(context.Background(), msg, protocolParts)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	type response struct {
+		result map[string]string
+		qos    Qos
+		err    error
+	}
+	done := make(chan response, 1)
+	go func() {
+		result, qos, err := this.useDeviceCommandHandler(ctx, msg, protocolParts)
+		done <- response{result: result, qos: qos, err: err}
+	}()
+	select {
+	case resp := <-done:
+		return resp.result, resp.qos, resp.err
+	case <-ctx.Done():
+		return result, qos, ErrCommandTimeout
+	}
+}
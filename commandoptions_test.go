@@ -0,0 +1,159 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package platform_connector_lib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SENERGY-Platform/platform-connector-lib/deduplication"
+	"github.com/SENERGY-Platform/platform-connector-lib/model"
+)
+
+func TestCommandOptions(t *testing.T) {
+	mux := sync.Mutex{}
+	reasons := []string{}
+	errorTo := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		msg := model.ProtocolMsg{}
+		err := json.NewDecoder(request.Body).Decode(&msg)
+		if err != nil {
+			t.Error(err)
+		}
+		mux.Lock()
+		defer mux.Unlock()
+		reasons = append(reasons, msg.Response.Output["error_reason"])
+	}))
+	defer errorTo.Close()
+
+	calls := atomic.Int64{}
+	ctl := &Connector{}
+	ctl.SetDeviceCommandHandler(func(deviceId string, deviceUri string, serviceId string, serviceUri string, requestMsg CommandRequestMsg) (responseMsg CommandResponseMsg, qos Qos, err error) {
+		calls.Add(1)
+		if serviceId == "slow" {
+			time.Sleep(time.Second)
+		}
+		return nil, Sync, errors.New("failed")
+	})
+	ctl.SetCommandOptions(CommandOptions{MaxAge: time.Minute, Retries: 1, RetryBackoff: 10 * time.Millisecond})
+	ctl.SetServiceCommandOptions("slow", CommandOptions{Timeout: 50 * time.Millisecond, Retries: 2}) //timed out calls are not retried
+
+	command := func(serviceId string, taskTime time.Time) []byte {
+		msg := model.ProtocolMsg{
+			TaskInfo: model.TaskInfo{Time: strconv.FormatInt(taskTime.Unix(), 10)},
+			Metadata: model.Metadata{ErrorTo: errorTo.URL, Service: model.Service{Id: serviceId}},
+		}
+		result, _ := json.Marshal(msg)
+		return result
+	}
+
+	err := ctl.handleCommand(command("expired", time.Now().Add(-time.Hour)), time.Now())
+	if err != nil {
+		t.Error(err)
+	}
+	//reported errors are not returned, to prevent redeliveries
+	err = ctl.handleCommand(command("failing", time.Now()), time.Now())
+	if err != nil {
+		t.Error(err)
+	}
+	err = ctl.handleCommand(command("slow", time.Now().Add(-time.Hour)), time.Now())
+	if err != nil {
+		t.Error(err)
+	}
+
+	if calls.Load() != 3 {
+		t.Error(calls.Load())
+	}
+	mux.Lock()
+	defer mux.Unlock()
+	expected := []string{string(CommandErrorExpired), string(CommandErrorFailed), string(CommandErrorTimeout)}
+	if len(reasons) != len(expected) {
+		t.Fatal(reasons)
+	}
+	for i, reason := range expected {
+		if reasons[i] != reason {
+			t.Error(reasons)
+		}
+	}
+}
+
+func TestCommandOptionsTimeoutDeduplication(t *testing.T) {
+	errorTo := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {}))
+	defer errorTo.Close()
+
+	calls := atomic.Int64{}
+	canceled := make(chan struct{})
+	ctl := &Connector{}
+	ctl.SetDeviceCommandHandlerCtx(func(ctx context.Context, deviceId string, deviceUri string, serviceId string, serviceUri string, requestMsg CommandRequestMsg) (responseMsg CommandResponseMsg, qos Qos, err error) {
+		calls.Add(1)
+		<-ctx.Done()
+		close(canceled)
+		return nil, Sync, ctx.Err()
+	})
+	ctl.SetCommandOptions(CommandOptions{Timeout: 50 * time.Millisecond})
+	ctl.SetCommandDeduplication(deduplication.NewLruStore(10), time.Minute)
+
+	command, _ := json.Marshal(model.ProtocolMsg{
+		TaskInfo: model.TaskInfo{TaskId: "t1"},
+		Metadata: model.Metadata{ErrorTo: errorTo.URL, Device: model.Device{Id: "d1"}, Service: model.Service{Id: "s1"}},
+	})
+	for i := 0; i < 2; i++ {
+		err := ctl.handleCommand(command, time.Now())
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Error("timed out handler call has not been canceled")
+	}
+	//the redelivered command is dropped, while the timed out call may still be running
+	if calls.Load() != 1 {
+		t.Error(calls.Load())
+	}
+}
+
+func TestCommandOptionsRetryShutdown(t *testing.T) {
+	errorTo := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {}))
+	defer errorTo.Close()
+
+	ctl := &Connector{}
+	ctl.Config.GetLogger()
+	ctl.SetDeviceCommandHandler(func(deviceId string, deviceUri string, serviceId string, serviceUri string, requestMsg CommandRequestMsg) (responseMsg CommandResponseMsg, qos Qos, err error) {
+		return nil, Sync, errors.New("failed")
+	})
+	ctl.SetCommandOptions(CommandOptions{Retries: 1, RetryBackoff: time.Minute})
+
+	command, _ := json.Marshal(model.ProtocolMsg{Metadata: model.Metadata{ErrorTo: errorTo.URL, Device: model.Device{Id: "d1"}, Service: model.Service{Id: "s1"}}})
+	go ctl.handleCommand(command, time.Now())
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err := ctl.Shutdown(ctx)
+	if err != nil {
+		t.Error(err)
+	}
+}
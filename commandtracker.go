@@ -0,0 +1,140 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package platform_connector_lib
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/SENERGY-Platform/platform-connector-lib/correlation"
+	"github.com/SENERGY-Platform/platform-connector-lib/model"
+	"github.com/google/uuid"
+)
+
+// CommandSender forwards a command to the device; the device response must reference the correlationId
+type CommandSender func(correlationId string, commandRequest model.ProtocolMsg, requestMsg CommandRequestMsg, t time.Time) error
+
+// CommandTracker implements request/response handling for asynchronous device protocols.
+// pending commands are stored with a deadline; commands without response are reported with HandleCommandErrorWithReason.
+// deadlines are watched by the instance which received the command; with a shared store (e.g. memcached),
+// responses may be handled by any instance.
+type CommandTracker struct {
+	connector *Connector
+	store     correlation.Store
+	timeout   time.Duration
+	send      CommandSender
+	mux       sync.Mutex
+	timers    map[string]*time.Timer
+}
+
+func NewCommandTracker(connector *Connector, store correlation.Store, timeout time.Duration, send CommandSender) *CommandTracker {
+	return &CommandTracker{
+		connector: connector,
+		store:     store,
+		timeout:   timeout,
+		send:      send,
+		timers:    map[string]*time.Timer{},
+	}
+}
+
+// Handle is an AsyncCommandHandler; use with Connector.SetAsyncCommandHandler()
+func (this *CommandTracker) Handle(commandRequest model.ProtocolMsg, requestMsg CommandRequestMsg, t time.Time) error {
+	correlationId := uuid.NewString()
+	//the stored command must outlive the deadline to be reported by expire()
+	err := this.store.Set(correlationId, commandRequest, this.timeout+time.Minute)
+	if err != nil {
+		this.connector.Config.GetLogger().Error("unable to store pending command", "error", err)
+		return err
+	}
+	this.mux.Lock()
+	this.timers[correlationId] = time.AfterFunc(this.timeout, func() {
+		this.expire(correlationId)
+	})
+	this.mux.Unlock()
+	err = this.send(correlationId, commandRequest, requestMsg, t)
+	if err != nil {
+		this.stopTimer(correlationId)
+		_, _ = this.store.Take(correlationId)
+		return err
+	}
+	return nil
+}
+
+// HandleResponse completes the pending command; returns correlation.ErrNotFound for unknown, duplicate and late responses
+func (this *CommandTracker) HandleResponse(correlationId string, response CommandResponseMsg, qos Qos) error {
+	commandRequest, err := this.take(correlationId)
+	if err != nil {
+		return err
+	}
+	return this.connector.HandleCommandResponse(commandRequest, response, qos)
+}
+
+// HandleError completes the pending command with an error reported by the device; returns correlation.ErrNotFound for unknown, duplicate and late responses
+func (this *CommandTracker) HandleError(correlationId string, errorMessage string) error {
+	commandRequest, err := this.take(correlationId)
+	if err != nil {
+		return err
+	}
+	this.connector.cancelCommandDeduplication(commandRequest)
+	this.connector.HandleCommandErrorWithReason(commandRequest.Metadata.Device.OwnerId, commandRequest, CommandErrorFailed, errorMessage)
+	return nil
+}
+
+// Pending returns the number of commands which are watched by this instance
+func (this *CommandTracker) Pending() int {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	return len(this.timers)
+}
+
+func (this *CommandTracker) take(correlationId string) (commandRequest model.ProtocolMsg, err error) {
+	commandRequest, err = this.store.Take(correlationId)
+	if errors.Is(err, correlation.ErrNotFound) {
+		this.connector.Config.GetLogger().Warn("reject command response", "error", err, "correlationId", correlationId)
+	}
+	if err != nil {
+		return commandRequest, err
+	}
+	this.stopTimer(correlationId)
+	return commandRequest, nil
+}
+
+func (this *CommandTracker) expire(correlationId string) {
+	this.mux.Lock()
+	delete(this.timers, correlationId)
+	this.mux.Unlock()
+	commandRequest, err := this.store.Take(correlationId)
+	if errors.Is(err, correlation.ErrNotFound) {
+		return //response has been handled (maybe by an other instance)
+	}
+	if err != nil {
+		this.connector.Config.GetLogger().Error("unable to check expired command", "error", err, "correlationId", correlationId)
+		return
+	}
+	this.connector.cancelCommandDeduplication(commandRequest)
+	this.connector.HandleCommandErrorWithReason(commandRequest.Metadata.Device.OwnerId, commandRequest, CommandErrorTimeout, "no device response within "+this.timeout.String())
+}
+
+func (this *CommandTracker) stopTimer(correlationId string) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	if timer, ok := this.timers[correlationId]; ok {
+		timer.Stop()
+		delete(this.timers, correlationId)
+	}
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package platform_connector_lib
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SENERGY-Platform/platform-connector-lib/correlation"
+	"github.com/SENERGY-Platform/platform-connector-lib/model"
+)
+
+func TestCommandTracker(t *testing.T) {
+	mux := sync.Mutex{}
+	errorReasons := []string{}
+	errorTo := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		msg := model.ProtocolMsg{}
+		err := json.NewDecoder(request.Body).Decode(&msg)
+		if err != nil {
+			t.Error(err)
+		}
+		mux.Lock()
+		defer mux.Unlock()
+		errorReasons = append(errorReasons, msg.Response.Output["error_reason"])
+	}))
+	defer errorTo.Close()
+
+	ctl := &Connector{}
+	ctl.Config.GetLogger() //init logger before concurrent use
+
+	sent := map[string]string{}
+	tracker := NewCommandTracker(ctl, correlation.NewMemoryStore(), 100*time.Millisecond, func(correlationId string, commandRequest model.ProtocolMsg, requestMsg CommandRequestMsg, t time.Time) error {
+		sent[commandRequest.Metadata.Service.Id] = correlationId
+		return nil
+	})
+
+	for _, serviceId := range []string{"answered", "expired"} {
+		err := tracker.Handle(model.ProtocolMsg{
+			TaskInfo: model.TaskInfo{CompletionStrategy: model.Optimistic},
+			Metadata: model.Metadata{ErrorTo: errorTo.URL, Service: model.Service{Id: serviceId}},
+		}, nil, time.Now())
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	if tracker.Pending() != 2 {
+		t.Error(tracker.Pending())
+	}
+
+	err := tracker.HandleResponse(sent["answered"], CommandResponseMsg{}, Sync)
+	if err != nil {
+		t.Error(err)
+	}
+	err = tracker.HandleResponse(sent["answered"], CommandResponseMsg{}, Sync)
+	if !errors.Is(err, correlation.ErrNotFound) {
+		t.Error("duplicate response not rejected", err)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	err = tracker.HandleResponse(sent["expired"], CommandResponseMsg{}, Sync)
+	if !errors.Is(err, correlation.ErrNotFound) {
+		t.Error("late response not rejected", err)
+	}
+	if tracker.Pending() != 0 {
+		t.Error(tracker.Pending())
+	}
+	mux.Lock()
+	defer mux.Unlock()
+	if len(errorReasons) != 1 || errorReasons[0] != string(CommandErrorTimeout) {
+		t.Error(errorReasons)
+	}
+}
@@ -51,11 +51,18 @@ type Config struct {
 	AuthClientSecret         string //keycloak-secret
 	AuthExpirationTimeBuffer float64
 	AuthEndpoint             string
+	AuthBackgroundRefresh    bool //optional; renews the access token in the background instead of on demand; stopped by Connector.Shutdown()
 
 	JwtPrivateKey string
 	JwtExpiration int64
 	JwtIssuer     string
 
+	JwtVerify       bool   //optional; verifies signature and expiry of tokens passed to ...WithAuthToken methods, against JwtPublicKey or the JWKS of AuthEndpoint
+	JwtPublicKey    string //optional; PEM or base64 encoded rsa public key
+	JwtVerifyIssuer string //optional; expected "iss" claim
+
+	SecurityUsersFile string //optional; json file with users and roles (see security.StaticUsers); signs tokens locally instead of using keycloak
+
 	DeviceExpiration      int32
 	DeviceTypeExpiration  int32
 	TokenCacheExpiration  int32
@@ -80,6 +87,23 @@ type Config struct {
 	PostgresDb        string
 
 	HttpCommandConsumerPort string
+	HttpCommandJwtAuth      bool     //optional; requires a bearer token, validated by the auth service
+	HttpCommandTlsCert      string   //optional; cert file; enables https
+	HttpCommandTlsKey       string   //optional; key file
+	HttpCommandTlsClientCa  string   //optional; ca file; enables mTLS
+	HttpCommandCorsOrigins  []string //optional; default allows every origin; "-" disables cors
+	HttpCommandTimeout      string   //optional; duration; read timeout and max wait for synchronous commands (?sync=true); default 10s
+	HttpCommandMaxPending   int      //optional; http commands are rejected with 503 while more commands are pending
+
+	GrpcCommandConsumerPort string //optional; starts a grpc server receiving commands over a bidirectional stream (see grpccommand)
+	GrpcCommandTlsCert      string //optional; cert file; enables tls
+	GrpcCommandTlsKey       string //optional; key file
+	GrpcCommandTlsClientCa  string //optional; ca file; enables mTLS
+	GrpcEvents              bool   //optional; events are sent over the grpc stream instead of kafka
+
+	EventIngestionPort    string //optional; http/websocket event server; started by Connector.StartEventIngestion()
+	EventIngestionTlsCert string //optional; cert file; enables https
+	EventIngestionTlsKey  string //optional; key file
 
 	AsyncPgThreadMax    int
 	AsyncFlushMessages  int
@@ -87,16 +111,58 @@ type Config struct {
 	AsyncCompression    sarama.CompressionCodec
 	SyncCompression     sarama.CompressionCodec
 
-	KafkaConsumerMaxWait  string
-	KafkaConsumerMinBytes int
-	KafkaConsumerMaxBytes int
+	KafkaConsumerMaxWait       string
+	KafkaConsumerMinBytes      int
+	KafkaConsumerMaxBytes      int
+	KafkaConsumerMaxReconnects int //optional; 0 means unlimited
+
+	KafkaOutboxDir           string //optional; enables a durable outbox for kafka producers
+	KafkaOutboxMaxBytes      int64  //optional; per qos
+	KafkaOutboxMaxAge        string //optional; duration
+	KafkaOutboxRetryInterval string //optional; duration
+
+	DeadLetterTopic string //optional; kafka topic or http(s) url, receiving rejected events and commands
+
+	CommandTimeout      string //optional; duration
+	CommandMaxAge       string //optional; duration
+	CommandRetries      int    //optional
+	CommandRetryBackoff string //optional; duration
+	CommandConcurrency  int    //optional; number of commands handled in parallel; commands to the same device are handled in order
+
+	CommandDeduplicationTtl   string   //optional; duration; enables the de-duplication of commands by task id, device id and service id
+	CommandDeduplicationSize  int      //optional; max entries of the in-memory de-duplication store; default 10000
+	CommandDeduplicationUrl   []string //optional; memcached urls; shares the de-duplication between instances instead of using an in-memory store
+	CommandDeduplicationLease string   //optional; duration; max time a command is considered in progress (e.g. after a crash of the handling instance); default 1m
 
-	IotCacheTimeout      string
-	IotCacheMaxIdleConns int
+	DeviceRateLimit      float64  //optional; events and commands per second and device
+	DeviceRateLimitBurst int      //optional; default: DeviceRateLimit rounded up
+	UserRateLimit        float64  //optional; events per second and user
+	UserRateLimitBurst   int      //optional; default: UserRateLimit rounded up
+	HubRateLimit         float64  //optional; messages per second and hub; see Connector.AllowHub()
+	HubRateLimitBurst    int      //optional; default: HubRateLimit rounded up
+	RateLimitUrl         []string //optional; memcached urls; shares the rate limits between instances
+
+	HealthEndpoint string //optional; path of the health endpoint on the metrics server (:2112), e.g. "/health"
+
+	IotCacheTimeout          string
+	IotCacheMaxIdleConns     int
+	IotMaxConcurrentRequests int    //optional; max parallel requests to the device-repository and device-manager
+	IotCacheSize             int    //optional; max entries of a bounded in-memory iot cache (LRU); replaces the default unbounded in-memory cache
+	IotCacheSnapshotFile     string //optional; requires IotCacheSize; loaded by New() to warm the cache, written by Connector.Shutdown()
+	ProtocolExpiration       int32  //optional; seconds; default 3600
+	NotFoundExpiration       int32  //optional; seconds; caches not found results of device, device-type, protocol and characteristic lookups
+	StaleExpiration          int32  //optional; seconds; expired iot cache entries are served for this duration while they are refreshed in the background
+
+	IotCircuitBreakerThreshold int    //optional; enables a circuit breaker for device repository and device manager requests, which opens after this number of consecutive failures
+	IotCircuitBreakerTimeout   string //optional; duration until an open circuit breaker allows a test request; default 30s
 
 	NotificationUrl string
 
-	DeviceTypeTopic string
+	DeviceTypeTopic     string
+	DeviceTopic         string //optional; device-repository command topic; invalidates cached devices
+	HubTopic            string //optional; device-repository command topic; invalidates cached devices of changed hubs
+	ProtocolTopic       string //optional; device-repository command topic; invalidates cached protocols
+	CharacteristicTopic string //optional; device-repository command topic; invalidates cached characteristics
 
 	KafkaTopicConfigs map[string][]kafka.ConfigEntry
 
@@ -223,3 +289,17 @@ func (this *Config) GetLogger() *slog.Logger {
 	}
 	return this.logger
 }
+
+// isSet returns false for empty config values and the placeholder "-"
+func isSet(value string) bool {
+	value = strings.TrimSpace(value)
+	return value != "" && value != "-"
+}
+
+// getOptional returns "" for unset config values (see isSet)
+func getOptional(value string) string {
+	if !isSet(value) {
+		return ""
+	}
+	return value
+}
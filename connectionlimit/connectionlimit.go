@@ -18,7 +18,6 @@ package connectionlimit
 
 import (
 	"errors"
-	"fmt"
 	"github.com/bradfitz/gomemcache/memcache"
 	"strconv"
 	"time"
@@ -43,32 +42,29 @@ func New(limit int, durationInSeconds int32, memcacheUrl ...string) *ConnectionL
 
 var ReachedLimitErr = errors.New("reached connection limit")
 
+// Check counts the connection attempt; uses atomic increments to be safe for concurrent instances
 func (this *ConnectionLimitHandler) Check(connectionId string) error {
 	if this == nil {
 		return nil
 	}
 	key := "connection_limit_counter_" + connectionId
-	item, err := this.cache.Get(key)
-	if err == memcache.ErrCacheMiss {
-		err = nil
-		item = &memcache.Item{
+	count, err := this.cache.Increment(key, 1)
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		err = this.cache.Add(&memcache.Item{
 			Key:        key,
-			Value:      []byte(strconv.Itoa(0)),
+			Value:      []byte(strconv.Itoa(1)),
 			Expiration: this.durationInSeconds,
+		})
+		count = 1
+		if errors.Is(err, memcache.ErrNotStored) {
+			count, err = this.cache.Increment(key, 1) //created concurrently by an other instance
 		}
 	}
 	if err != nil {
 		return err
 	}
-	count, err := strconv.Atoi(string(item.Value))
-	if err != nil {
-		return fmt.Errorf("WARNING: unexpected value in connectionlimit value %v: %v", key, string(item.Value))
-	}
-	if count > this.limit {
+	if count > uint64(this.limit)+1 {
 		return ReachedLimitErr
 	}
-	item.Key = key
-	item.Value = []byte(strconv.Itoa(count + 1))
-	item.Expiration = this.durationInSeconds
-	return this.cache.Set(item)
+	return nil
 }
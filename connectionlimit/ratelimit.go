@@ -0,0 +1,195 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connectionlimit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+var ErrRateLimited = errors.New("rate limited")
+
+type RateLimit struct {
+	Rate  float64 //allowed messages per second
+	Burst int     //max messages at once; default: Rate rounded up
+}
+
+// RateLimiter limits messages per key (e.g. device id).
+// without memcached, every key has an in-memory token bucket.
+// with memcached, instances share a sliding window of Burst/Rate seconds, counted with atomic increments;
+// rejected messages are not counted. the in-memory buckets are used as fallback, while memcached is not reachable.
+type RateLimiter struct {
+	name   string
+	limit  RateLimit
+	window time.Duration
+	cache  counterCache
+	logger *slog.Logger
+
+	mux     sync.Mutex
+	buckets map[string]*bucket
+	calls   int
+}
+
+// counterCache is implemented by *memcache.Client
+type counterCache interface {
+	Get(key string) (item *memcache.Item, err error)
+	Add(item *memcache.Item) error
+	Increment(key string, delta uint64) (newValue uint64, err error)
+	Decrement(key string, delta uint64) (newValue uint64, err error)
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// cleanupInterval is the number of Allow() calls between removals of full buckets
+const cleanupInterval = 1000
+
+// NewRateLimiter uses the name to separate the memcached keys of different limiters
+func NewRateLimiter(name string, limit RateLimit, logger *slog.Logger, memcacheUrl ...string) *RateLimiter {
+	if limit.Burst <= 0 {
+		limit.Burst = int(math.Ceil(limit.Rate))
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	result := &RateLimiter{
+		name:    name,
+		limit:   limit,
+		window:  max(time.Duration(float64(limit.Burst)/limit.Rate*float64(time.Second)), time.Second),
+		logger:  logger,
+		buckets: map[string]*bucket{},
+	}
+	if len(memcacheUrl) > 0 {
+		client := memcache.New(memcacheUrl...)
+		client.MaxIdleConns = 10
+		client.Timeout = 200 * time.Millisecond
+		result.cache = client
+	}
+	return result
+}
+
+// Allow returns ErrRateLimited if the message exceeds the limit of the key
+func (this *RateLimiter) Allow(key string) error {
+	if this == nil {
+		return nil
+	}
+	if this.cache != nil {
+		allowed, err := this.allowShared(key, time.Now())
+		if err == nil {
+			if !allowed {
+				return ErrRateLimited
+			}
+			return nil
+		}
+		this.logger.Warn("unable to use shared rate limit; use in-memory limit", "error", err, "limiter", this.name)
+	}
+	if !this.allowLocal(key, time.Now()) {
+		return ErrRateLimited
+	}
+	return nil
+}
+
+func (this *RateLimiter) allowLocal(key string, now time.Time) bool {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	this.calls++
+	if this.calls%cleanupInterval == 0 {
+		this.cleanup(now)
+	}
+	b, ok := this.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(this.limit.Burst), last: now}
+		this.buckets[key] = b
+	}
+	b.tokens = min(float64(this.limit.Burst), b.tokens+now.Sub(b.last).Seconds()*this.limit.Rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// cleanup removes buckets which would be full again
+func (this *RateLimiter) cleanup(now time.Time) {
+	for key, b := range this.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*this.limit.Rate >= float64(this.limit.Burst) {
+			delete(this.buckets, key)
+		}
+	}
+}
+
+// allowShared estimates the messages of the sliding window from the counters of the current and the previous fixed window
+func (this *RateLimiter) allowShared(key string, now time.Time) (allowed bool, err error) {
+	index := now.UnixNano() / this.window.Nanoseconds()
+	prefix := this.memcachedKey(key)
+	current := prefix + "." + strconv.FormatInt(index, 10)
+	count, err := this.increment(current, int32(math.Ceil(2*this.window.Seconds())))
+	if err != nil {
+		return false, err
+	}
+	previous := uint64(0)
+	item, err := this.cache.Get(prefix + "." + strconv.FormatInt(index-1, 10))
+	if err == nil {
+		previous, err = strconv.ParseUint(string(item.Value), 10, 64)
+	}
+	if err != nil && !errors.Is(err, memcache.ErrCacheMiss) {
+		//the caller falls back to the local limiter; the message must not be counted twice
+		if _, decrementErr := this.cache.Decrement(current, 1); decrementErr != nil {
+			this.logger.Warn("unable to decrement shared rate limit counter", "error", decrementErr, "limiter", this.name)
+		}
+		return false, err
+	}
+	elapsed := float64(now.UnixNano()-index*this.window.Nanoseconds()) / float64(this.window.Nanoseconds())
+	allowed = float64(previous)*(1-elapsed)+float64(count) <= float64(this.limit.Burst)
+	if !allowed {
+		//rejected messages must not reduce the throughput of the following windows
+		_, err = this.cache.Decrement(current, 1)
+		if err != nil {
+			this.logger.Warn("unable to decrement shared rate limit counter", "error", err, "limiter", this.name)
+		}
+	}
+	return allowed, nil
+}
+
+func (this *RateLimiter) increment(key string, expiration int32) (count uint64, err error) {
+	count, err = this.cache.Increment(key, 1)
+	if !errors.Is(err, memcache.ErrCacheMiss) {
+		return count, err
+	}
+	err = this.cache.Add(&memcache.Item{Key: key, Value: []byte("1"), Expiration: expiration})
+	if errors.Is(err, memcache.ErrNotStored) {
+		return this.cache.Increment(key, 1) //created concurrently by an other instance
+	}
+	return 1, err
+}
+
+// memcachedKey hashes the key to respect the memcached key limits (max 250 chars, no whitespace)
+func (this *RateLimiter) memcachedKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return "rate_limit_" + this.name + "_" + hex.EncodeToString(hash[:16])
+}
@@ -0,0 +1,160 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connectionlimit
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := NewRateLimiter("test", RateLimit{Rate: 10, Burst: 3}, nil)
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if !limiter.allowLocal("a", now) {
+			t.Fatal("expected burst to be allowed", i)
+		}
+	}
+	if limiter.allowLocal("a", now) {
+		t.Fatal("expected limit after burst")
+	}
+	if !limiter.allowLocal("b", now) {
+		t.Fatal("expected separate bucket per key")
+	}
+	if !limiter.allowLocal("a", now.Add(100*time.Millisecond)) {
+		t.Fatal("expected refilled token")
+	}
+	if limiter.allowLocal("a", now.Add(100*time.Millisecond)) {
+		t.Fatal("expected limit")
+	}
+
+	//unreachable memcached falls back to the in-memory buckets
+	shared := NewRateLimiter("test", RateLimit{Rate: 1}, nil, "localhost:1")
+	if err := shared.Allow("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := shared.Allow("a"); !errors.Is(err, ErrRateLimited) {
+		t.Fatal(err)
+	}
+
+	var disabled *RateLimiter
+	if err := disabled.Allow("a"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type counterCacheMock struct {
+	mux    sync.Mutex
+	values map[string]uint64
+}
+
+func (this *counterCacheMock) Get(key string) (item *memcache.Item, err error) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	value, ok := this.values[key]
+	if !ok {
+		return nil, memcache.ErrCacheMiss
+	}
+	return &memcache.Item{Key: key, Value: []byte(strconv.FormatUint(value, 10))}, nil
+}
+
+func (this *counterCacheMock) Add(item *memcache.Item) error {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	if _, ok := this.values[item.Key]; ok {
+		return memcache.ErrNotStored
+	}
+	value, err := strconv.ParseUint(string(item.Value), 10, 64)
+	if err != nil {
+		return err
+	}
+	this.values[item.Key] = value
+	return nil
+}
+
+func (this *counterCacheMock) Increment(key string, delta uint64) (newValue uint64, err error) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	if _, ok := this.values[key]; !ok {
+		return 0, memcache.ErrCacheMiss
+	}
+	this.values[key] += delta
+	return this.values[key], nil
+}
+
+func (this *counterCacheMock) Decrement(key string, delta uint64) (newValue uint64, err error) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	if _, ok := this.values[key]; !ok {
+		return 0, memcache.ErrCacheMiss
+	}
+	this.values[key] -= min(delta, this.values[key])
+	return this.values[key], nil
+}
+
+func TestSharedRateLimiterSustainedOverLimit(t *testing.T) {
+	limiter := NewRateLimiter("test", RateLimit{Rate: 10, Burst: 10}, nil)
+	limiter.cache = &counterCacheMock{values: map[string]uint64{}}
+	start := time.Now().Truncate(time.Second)
+	allowed := map[int]int{}
+	//100 messages per second for 5 seconds
+	for i := 0; i < 500; i++ {
+		now := start.Add(time.Duration(i) * 10 * time.Millisecond)
+		ok, err := limiter.allowShared("a", now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			allowed[int(now.Sub(start)/time.Second)]++
+		}
+	}
+	for second := 0; second < 5; second++ {
+		if allowed[second] < 5 || allowed[second] > 15 {
+			t.Error(second, allowed)
+		}
+	}
+}
+
+type failingGetCacheMock struct {
+	counterCacheMock
+}
+
+func (this *failingGetCacheMock) Get(key string) (item *memcache.Item, err error) {
+	return nil, errors.New("get failed")
+}
+
+func TestSharedRateLimiterGetFailure(t *testing.T) {
+	limiter := NewRateLimiter("test", RateLimit{Rate: 10, Burst: 10}, nil)
+	cache := &failingGetCacheMock{counterCacheMock: counterCacheMock{values: map[string]uint64{}}}
+	limiter.cache = cache
+	now := time.Now()
+	_, err := limiter.allowShared("a", now)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	//the message falls back to the in-memory limiter and must not remain in the shared counter
+	for key, value := range cache.values {
+		if value != 0 {
+			t.Error(key, value)
+		}
+	}
+}
@@ -20,12 +20,15 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"log"
+	"os"
+	"path/filepath"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	developerNotifications "github.com/SENERGY-Platform/developer-notifications/pkg/client"
+	"github.com/SENERGY-Platform/platform-connector-lib/grpccommand"
 	"github.com/SENERGY-Platform/platform-connector-lib/httpcommand"
 	"github.com/SENERGY-Platform/platform-connector-lib/iot"
 	"github.com/SENERGY-Platform/platform-connector-lib/kafka"
@@ -33,6 +36,8 @@ import (
 	"github.com/SENERGY-Platform/platform-connector-lib/msgvalidation"
 	"github.com/SENERGY-Platform/platform-connector-lib/psql"
 	"github.com/SENERGY-Platform/platform-connector-lib/security"
+	"github.com/SENERGY-Platform/platform-connector-lib/statistics"
+	"github.com/bradfitz/gomemcache/memcache"
 	kafka2 "github.com/segmentio/kafka-go"
 )
 
@@ -42,6 +47,9 @@ type CommandRequestMsg = map[ProtocolSegmentName]string
 type EventMsg = map[ProtocolSegmentName]string
 
 type DeviceCommandHandler func(deviceId string, deviceUri string, serviceId string, serviceUri string, requestMsg CommandRequestMsg) (responseMsg CommandResponseMsg, qos Qos, err error)
+
+// DeviceCommandHandlerCtx is a DeviceCommandHandler which receives a context; ctx is canceled if the CommandOptions.Timeout is exceeded
+type DeviceCommandHandlerCtx func(ctx context.Context, deviceId string, deviceUri string, serviceId string, serviceUri string, requestMsg CommandRequestMsg) (responseMsg CommandResponseMsg, qos Qos, err error)
 type AsyncCommandHandler func(commandRequest model.ProtocolMsg, requestMsg CommandRequestMsg, t time.Time) (err error)
 
 var ErrorUnknownLocalServiceId = errors.New("unknown local service id")
@@ -66,11 +74,17 @@ type Security interface {
 	GetUserRoles(userid string) (roles []string, err error)
 }
 
+// TokenRefresher is an optional Security extension; used if Config.AuthBackgroundRefresh is set
+type TokenRefresher interface {
+	StartTokenRefresher(ctx context.Context)
+}
+
 type Connector struct {
 	Config Config
 	//asyncCommandHandler, endpointCommandHandler and deviceCommandHandler are mutual exclusive
-	deviceCommandHandler DeviceCommandHandler //must be able to handle concurrent calls
-	asyncCommandHandler  AsyncCommandHandler  //must be able to handle concurrent calls
+	deviceCommandHandler DeviceCommandHandlerCtx //must be able to handle concurrent calls
+	asyncCommandHandler  AsyncCommandHandler     //must be able to handle concurrent calls
+	producerMux          sync.RWMutex
 	producer             map[Qos]kafka.ProducerInterface
 	postgresPublisher    *psql.Publisher
 	iot                  *iot.Iot
@@ -78,12 +92,62 @@ type Connector struct {
 
 	IotCache *iot.PreparedCache
 
-	asyncPgBackpressure chan bool //used to limit go routines for async postgres publishing
+	sinks []registeredSink
+
+	rawEventMiddlewares []RawEventMiddleware
+	envelopeMiddlewares map[EnvelopeStage][]EnvelopeMiddleware
 
 	devNotifications developerNotifications.Client
+
+	shutdownMux        sync.RWMutex
+	shuttingDown       bool
+	shutdownCtx        context.Context //canceled when the shutdown starts; see shutdownContext()
+	cancelShutdownCtx  context.CancelFunc
+	stopConsumers      context.CancelFunc
+	stopEventIngestion context.CancelFunc
+	consumers          sync.WaitGroup
+
+	kafkaConsumersMux sync.Mutex
+	kafkaConsumers    map[string]*kafka.Consumer
+	commands          sync.WaitGroup
+	pendingCommands   atomic.Int64
+	events            sync.WaitGroup
+	pendingEvents     atomic.Int64
+
+	deadLetterOnce     sync.Once
+	deadLetterQueue    chan DeadLetter
+	deadLetters        sync.WaitGroup
+	pendingDeadLetters atomic.Int64
+
+	fatalErrorHandler FatalErrorHandler
+
+	commandOptions        CommandOptions
+	serviceCommandOptions map[string]CommandOptions
+	commandDeduplication  *commandDeduplication
+	rateLimits            RateLimits
+
+	syncCommandsMux sync.Mutex
+	syncCommands    map[string]chan syncCommandResult
+
+	grpcServer *grpccommand.Server
+
+	tokenVerifier      *security.Verifier
+	stopTokenRefresher context.CancelFunc
+
+	healthMux      sync.Mutex
+	healthErrors   map[string]healthError
+	healthMemcache *memcache.Client
+}
+
+type Options struct {
+	Security Security //optional; default is security.Offline if Config.SecurityUsersFile is set, otherwise the keycloak backed security.Security
 }
 
 func New(config Config) (connector *Connector, err error) {
+	return NewWithOptions(config, Options{})
+}
+
+func NewWithOptions(config Config, options Options) (connector *Connector, err error) {
 	config = setConfigDefaults(config)
 	var publisher *psql.Publisher
 	if config.PublishToPostgres {
@@ -93,35 +157,71 @@ func New(config Config) (connector *Connector, err error) {
 		}
 	}
 
-	asyncPgThreadMax := config.AsyncPgThreadMax
-	if asyncPgThreadMax == 0 {
-		asyncPgThreadMax = 1000
+	sec := options.Security
+	if sec == nil {
+		sec, err = newSecurity(config)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	sec, err := security.New(
-		config.AuthEndpoint,
-		config.AuthClientId,
-		config.AuthClientSecret,
-		config.JwtIssuer,
-		config.JwtPrivateKey,
-		config.JwtExpiration,
-		config.AuthExpirationTimeBuffer,
-		config.TokenCacheExpiration,
-		config.TokenCacheUrl,
-		5,
-		500*time.Millisecond,
-		config.GetLogger(),
-	)
+	commandOptions, err := getCommandOptionsFromConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	commandDeduplication, err := getCommandDeduplicationFromConfig(config)
 	if err != nil {
 		return nil, err
 	}
 
+	tokenVerifier, err := newTokenVerifier(config)
+	if err != nil {
+		return nil, err
+	}
+
+	iotClient := iot.New(config.DeviceManagerUrl, config.DeviceRepoUrl, config.PermissionsV2Url, config.GetLogger()).SetMaxConcurrentRequests(config.IotMaxConcurrentRequests)
+	if config.IotCircuitBreakerThreshold > 0 {
+		breakerConfig := iot.CircuitBreakerConfig{FailureThreshold: config.IotCircuitBreakerThreshold}
+		if isSet(config.IotCircuitBreakerTimeout) {
+			breakerConfig.OpenTimeout, err = time.ParseDuration(config.IotCircuitBreakerTimeout)
+			if err != nil {
+				return nil, errors.New("unable to parse IotCircuitBreakerTimeout as duration: " + err.Error())
+			}
+		}
+		iotClient.SetCircuitBreaker(breakerConfig)
+	}
+
 	connector = &Connector{
-		Config:              config,
-		iot:                 iot.New(config.DeviceManagerUrl, config.DeviceRepoUrl, config.PermissionsV2Url, config.GetLogger()),
-		security:            sec,
-		postgresPublisher:   publisher,
-		asyncPgBackpressure: make(chan bool, asyncPgThreadMax),
+		Config:               config,
+		iot:                  iotClient,
+		security:             sec,
+		postgresPublisher:    publisher,
+		commandOptions:       commandOptions,
+		commandDeduplication: commandDeduplication,
+		tokenVerifier:        tokenVerifier,
+		rateLimits:           getRateLimitsFromConfig(config),
+	}
+	kafkaErrorPolicy := SinkErrorReturn
+	if config.FatalKafkaError {
+		kafkaErrorPolicy = SinkErrorFatal
+	}
+	if isSet(config.GrpcCommandConsumerPort) {
+		connector.grpcServer = grpccommand.New(grpccommand.Config{
+			Port:            config.GrpcCommandConsumerPort,
+			Logger:          config.GetLogger(),
+			TlsCertFile:     getOptional(config.GrpcCommandTlsCert),
+			TlsKeyFile:      getOptional(config.GrpcCommandTlsKey),
+			TlsClientCaFile: getOptional(config.GrpcCommandTlsClientCa),
+		})
+	}
+	if connector.grpcServer != nil && config.GrpcEvents {
+		connector.AddEventSink(NewGrpcSink(connector.grpcServer), SinkOptions{ErrorPolicy: SinkErrorReturn})
+	} else {
+		connector.AddEventSink(NewKafkaSink(connector.GetProducer), SinkOptions{ErrorPolicy: kafkaErrorPolicy})
+	}
+	if publisher != nil {
+		connector.AddEventSink(NewTimescaleSink(publisher, config.AsyncPgThreadMax, config.GetLogger(), connector.notifyDeviceOwners), SinkOptions{ErrorPolicy: SinkErrorLog})
 	}
 	iotCacheTimeout := 200 * time.Millisecond
 	if timeout, err := time.ParseDuration(config.IotCacheTimeout); err != nil {
@@ -129,17 +229,72 @@ func New(config Config) (connector *Connector, err error) {
 	} else {
 		iotCacheTimeout = timeout
 	}
-	connector.IotCache, err = iot.NewCache(connector.iot, config.DeviceExpiration, config.DeviceTypeExpiration, config.CharacteristicExpiration, config.IotCacheMaxIdleConns, iotCacheTimeout, config.IotCacheUrl...)
+	connector.IotCache, err = iot.NewCacheWithOptions(connector.iot, iot.CacheOptions{
+		DeviceExpiration:         config.DeviceExpiration,
+		DeviceTypeExpiration:     config.DeviceTypeExpiration,
+		CharacteristicExpiration: config.CharacteristicExpiration,
+		ProtocolExpiration:       config.ProtocolExpiration,
+		NotFoundExpiration:       config.NotFoundExpiration,
+		StaleExpiration:          config.StaleExpiration,
+		Size:                     config.IotCacheSize,
+		MemcachedUrls:            config.IotCacheUrl,
+		MaxIdleConns:             config.IotCacheMaxIdleConns,
+		Timeout:                  iotCacheTimeout,
+	})
 	if err != nil {
 		return nil, err
 	}
+	if isSet(config.IotCacheSnapshotFile) {
+		err = connector.IotCache.LoadSnapshot(config.IotCacheSnapshotFile)
+		if errors.Is(err, iot.ErrSnapshotNotSupported) {
+			return nil, errors.New("IotCacheSnapshotFile requires IotCacheSize")
+		}
+		if errors.Is(err, os.ErrNotExist) {
+			config.GetLogger().Info("no iot cache snapshot found", "file", config.IotCacheSnapshotFile)
+		} else if err != nil {
+			config.GetLogger().Warn("unable to load iot cache snapshot", "error", err, "file", config.IotCacheSnapshotFile)
+		}
+	}
 
-	if config.DeveloperNotificationUrl != "" && config.DeveloperNotificationUrl != "-" {
+	if config.AuthBackgroundRefresh {
+		refresher, ok := sec.(TokenRefresher)
+		if !ok {
+			return nil, errors.New("AuthBackgroundRefresh requires a Security implementing TokenRefresher")
+		}
+		var refresherCtx context.Context
+		refresherCtx, connector.stopTokenRefresher = context.WithCancel(context.Background())
+		refresher.StartTokenRefresher(refresherCtx)
+	}
+
+	if isSet(config.DeveloperNotificationUrl) {
 		connector.devNotifications = developerNotifications.New(config.DeveloperNotificationUrl)
 	}
+	if isSet(config.HealthEndpoint) {
+		statistics.Handle(config.HealthEndpoint, connector.HealthHandler())
+	}
 	return connector, nil
 }
 
+func newSecurity(config Config) (Security, error) {
+	if isSet(config.SecurityUsersFile) {
+		return security.NewOffline(config.SecurityUsersFile, config.JwtIssuer, config.JwtPrivateKey, config.JwtExpiration, config.GetLogger())
+	}
+	return security.New(
+		config.AuthEndpoint,
+		config.AuthClientId,
+		config.AuthClientSecret,
+		config.JwtIssuer,
+		config.JwtPrivateKey,
+		config.JwtExpiration,
+		config.AuthExpirationTimeBuffer,
+		config.TokenCacheExpiration,
+		config.TokenCacheUrl,
+		5,
+		500*time.Millisecond,
+		config.GetLogger(),
+	)
+}
+
 func setConfigDefaults(config Config) Config {
 	if config.KafkaTopicConfigs == nil {
 		config.KafkaTopicConfigs = map[string][]kafka2.ConfigEntry{
@@ -194,6 +349,14 @@ func setConfigDefaults(config Config) Config {
 
 // asyncCommandHandler, endpointCommandHandler and deviceCommandHandler are mutual exclusive
 func (this *Connector) SetDeviceCommandHandler(handler DeviceCommandHandler) *Connector {
+	return this.SetDeviceCommandHandlerCtx(func(ctx context.Context, deviceId string, deviceUri string, serviceId string, serviceUri string, requestMsg CommandRequestMsg) (responseMsg CommandResponseMsg, qos Qos, err error) {
+		return handler(deviceId, deviceUri, serviceId, serviceUri, requestMsg)
+	})
+}
+
+// SetDeviceCommandHandlerCtx is SetDeviceCommandHandler with a handler, which is able to stop timed out calls (see CommandOptions.Timeout)
+// asyncCommandHandler, endpointCommandHandler and deviceCommandHandler are mutual exclusive
+func (this *Connector) SetDeviceCommandHandlerCtx(handler DeviceCommandHandlerCtx) *Connector {
 	if this.asyncCommandHandler != nil {
 		panic("try setting command handler while async command handler exists")
 	}
@@ -227,11 +390,13 @@ func (this *Connector) StartConsumer(ctx context.Context) (err error) {
 		return errors.New("missing command handler; use SetAsyncCommandHandler() or SetDeviceCommandHandler()")
 	}
 
+	ctx, this.stopConsumers = context.WithCancel(ctx)
+
 	used := false
 	maxWait := 100 * time.Millisecond
 
-	if this.Config.Protocol != "" && this.Config.Protocol != "-" {
-		if this.Config.KafkaConsumerMaxWait != "" && this.Config.KafkaConsumerMaxWait != "-" {
+	if isSet(this.Config.Protocol) {
+		if isSet(this.Config.KafkaConsumerMaxWait) {
 			maxWait, err = time.ParseDuration(this.Config.KafkaConsumerMaxWait)
 			if err != nil {
 				return errors.New("unable to parse KafkaConsumerMaxWait as duration: " + err.Error())
@@ -239,92 +404,187 @@ func (this *Connector) StartConsumer(ctx context.Context) (err error) {
 		}
 
 		used = true
-		err = kafka.NewConsumer(ctx, kafka.ConsumerConfig{
-			KafkaUrl:       this.Config.KafkaUrl,
-			GroupId:        this.Config.KafkaGroupName,
-			Topic:          this.Config.Protocol,
-			MinBytes:       this.Config.KafkaConsumerMinBytes,
-			MaxBytes:       this.Config.KafkaConsumerMaxBytes,
-			MaxWait:        maxWait,
-			TopicConfigMap: this.Config.KafkaTopicConfigs,
-			InitTopic:      this.Config.InitTopics,
-		}, func(topic string, msg []byte, t time.Time) error {
-			if string(msg) == "topic_init" {
-				return nil
-			}
-			return this.handleCommand(msg, t)
-		}, func(err error) {
-			this.Config.GetLogger().Error("FATAL ERROR: kafka consumer", "error", err)
-			log.Fatal(err)
-		})
+		err = this.startCommandConsumer(ctx, maxWait)
 		if err != nil {
 			return err
 		}
 	}
 
-	if this.Config.HttpCommandConsumerPort != "" && this.Config.HttpCommandConsumerPort != "-" {
+	if isSet(this.Config.HttpCommandConsumerPort) {
 		used = true
-		err = httpcommand.StartConsumer(ctx, this.Config.GetLogger(), this.Config.HttpCommandConsumerPort, func(msg []byte) error {
-			return this.handleCommand(msg, time.Now())
-		})
+		err = this.startHttpCommandConsumer(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	if this.grpcServer != nil {
+		used = true
+		err = this.startGrpcCommandConsumer(ctx)
 		if err != nil {
 			return err
 		}
 	}
 
 	if !used {
-		return errors.New("no command consumer set; at least one of the following config fields must be set: Protocol, HttpCommandConsumerPort")
+		return errors.New("no command consumer set; at least one of the following config fields must be set: Protocol, HttpCommandConsumerPort, GrpcCommandConsumerPort")
 	}
 
 	//iot cache invalidation
-	if this.Config.DeviceTypeTopic != "" && this.Config.DeviceTypeTopic != "-" {
-		err = kafka.NewConsumer(ctx, kafka.ConsumerConfig{
-			KafkaUrl:       this.Config.KafkaUrl,
-			GroupId:        this.Config.KafkaGroupName,
-			Topic:          this.Config.DeviceTypeTopic,
-			MinBytes:       this.Config.KafkaConsumerMinBytes,
-			MaxBytes:       this.Config.KafkaConsumerMaxBytes,
-			MaxWait:        maxWait,
-			TopicConfigMap: this.Config.KafkaTopicConfigs,
-			InitTopic:      this.Config.InitTopics,
-		}, func(topic string, msg []byte, t time.Time) error {
-			if string(msg) == "topic_init" {
-				return nil
+	if isSet(this.Config.DeviceTypeTopic) {
+		err = this.startDeviceTypeConsumer(ctx, maxWait)
+		if err != nil {
+			this.Config.GetLogger().Error("unable to start device-type consumer", "error", err, "topic", this.Config.DeviceTypeTopic)
+		}
+	}
+	this.startIotCacheInvalidation(ctx, maxWait)
+
+	return nil
+}
+
+func (this *Connector) startCommandConsumer(ctx context.Context, maxWait time.Duration) error {
+	consumer, err := kafka.StartConsumer(ctx, kafka.ConsumerConfig{
+		KafkaUrl:       this.Config.KafkaUrl,
+		GroupId:        this.Config.KafkaGroupName,
+		Topic:          this.Config.Protocol,
+		MinBytes:       this.Config.KafkaConsumerMinBytes,
+		MaxBytes:       this.Config.KafkaConsumerMaxBytes,
+		MaxWait:        maxWait,
+		TopicConfigMap: this.Config.KafkaTopicConfigs,
+		InitTopic:      this.Config.InitTopics,
+		Wg:             &this.consumers,
+		MaxReconnects:  this.Config.KafkaConsumerMaxReconnects,
+		Logger:         this.Config.GetLogger(),
+		Concurrency:    this.Config.CommandConcurrency,
+	}, func(topic string, msg []byte, t time.Time) error {
+		if string(msg) == "topic_init" {
+			return nil
+		}
+		return this.handleCommand(msg, t)
+	}, func(err error) {
+		this.fatal(&FatalError{Source: FatalKafkaConsumer, Topic: this.Config.Protocol, Err: err, Retry: func(retryCtx context.Context) error {
+			if ctx.Err() != nil {
+				return nil //consumer has been stopped
 			}
-			command := DeviceTypeCommand{}
-			err = json.Unmarshal(msg, &command)
-			if err != nil {
-				this.Config.GetLogger().Error("unable to unmarshal consumed  device-type command message", "error", err, "topic", this.Config.DeviceTypeTopic)
-				return nil
+			return this.startCommandConsumer(ctx, maxWait)
+		}})
+	})
+	if err != nil {
+		return err
+	}
+	this.setKafkaConsumer(consumer)
+	return nil
+}
+
+func (this *Connector) startHttpCommandConsumer(ctx context.Context) error {
+	config, err := this.getHttpCommandConfig()
+	if err != nil {
+		return err
+	}
+	return httpcommand.Start(ctx, config, this.handleHttpCommand, func(err error) {
+		this.fatal(&FatalError{Source: FatalHttpCommandServer, Topic: this.Config.HttpCommandConsumerPort, Err: err, Retry: func(retryCtx context.Context) error {
+			if ctx.Err() != nil {
+				return nil //consumer has been stopped
 			}
-			this.Config.GetLogger().Info("invalidate cache for device-type", "id", command.Id)
-			this.IotCache.InvalidateDeviceTypeCache(command.Id)
+			return this.startHttpCommandConsumer(ctx)
+		}})
+	})
+}
+
+func (this *Connector) startDeviceTypeConsumer(ctx context.Context, maxWait time.Duration) error {
+	return this.startCacheInvalidationConsumer(ctx, maxWait, this.Config.DeviceTypeTopic, func(msg []byte) error {
+		command := DeviceTypeCommand{}
+		err := json.Unmarshal(msg, &command)
+		if err != nil {
+			return err
+		}
+		this.Config.GetLogger().Info("invalidate cache for device-type", "id", command.Id)
+		this.IotCache.InvalidateDeviceTypeCache(command.Id)
+		return nil
+	})
+}
+
+func (this *Connector) startCacheInvalidationConsumer(ctx context.Context, maxWait time.Duration, topic string, invalidate func(msg []byte) error) error {
+	consumer, err := kafka.StartConsumer(ctx, kafka.ConsumerConfig{
+		KafkaUrl:       this.Config.KafkaUrl,
+		GroupId:        this.Config.KafkaGroupName,
+		Topic:          topic,
+		MinBytes:       this.Config.KafkaConsumerMinBytes,
+		MaxBytes:       this.Config.KafkaConsumerMaxBytes,
+		MaxWait:        maxWait,
+		TopicConfigMap: this.Config.KafkaTopicConfigs,
+		InitTopic:      this.Config.InitTopics,
+		Wg:             &this.consumers,
+		MaxReconnects:  this.Config.KafkaConsumerMaxReconnects,
+		Logger:         this.Config.GetLogger(),
+	}, func(topic string, msg []byte, t time.Time) error {
+		if string(msg) == "topic_init" {
 			return nil
-		}, func(err error) {
-			log.Println("ERROR: kafka consumer", this.Config.DeviceTypeTopic, err)
-		})
+		}
+		err := invalidate(msg)
+		if err != nil {
+			this.Config.GetLogger().Error("unable to unmarshal consumed cache invalidation message", "error", err, "topic", topic)
+		}
+		return nil
+	}, func(err error) {
+		this.Config.GetLogger().Error("kafka consumer error", "error", err, "topic", topic)
+		//without a custom FatalErrorHandler, a stopped cache invalidation is only logged
+		if this.fatalErrorHandler != nil {
+			this.fatal(&FatalError{Source: FatalKafkaConsumer, Topic: topic, Err: err, Retry: func(retryCtx context.Context) error {
+				if ctx.Err() != nil {
+					return nil //consumer has been stopped
+				}
+				return this.startCacheInvalidationConsumer(ctx, maxWait, topic, invalidate)
+			}})
+		}
+	})
+	if err != nil {
+		return err
 	}
-
+	this.setKafkaConsumer(consumer)
 	return nil
 }
 
+func (this *Connector) setKafkaConsumer(consumer *kafka.Consumer) {
+	this.kafkaConsumersMux.Lock()
+	defer this.kafkaConsumersMux.Unlock()
+	if this.kafkaConsumers == nil {
+		this.kafkaConsumers = map[string]*kafka.Consumer{}
+	}
+	this.kafkaConsumers[consumer.Topic()] = consumer
+}
+
+// ConsumerStates returns the state of the kafka consumers by topic
+func (this *Connector) ConsumerStates() map[string]kafka.ConsumerState {
+	this.kafkaConsumersMux.Lock()
+	defer this.kafkaConsumersMux.Unlock()
+	result := map[string]kafka.ConsumerState{}
+	for topic, consumer := range this.kafkaConsumers {
+		result[topic] = consumer.State()
+	}
+	return result
+}
+
 type DeviceTypeCommand struct {
 	Command string `json:"command"`
 	Id      string `json:"id"`
 }
 
 func (this *Connector) InitProducer(ctx context.Context, qosList []Qos) (err error) {
-	this.producer = map[Qos]kafka.ProducerInterface{}
+	producer := map[Qos]kafka.ProducerInterface{}
 	for _, qos := range qosList {
-		err = this.initProducer(ctx, qos)
+		producer[qos], err = this.initProducer(ctx, qos)
 		if err != nil {
 			return err
 		}
 	}
+	this.producerMux.Lock()
+	defer this.producerMux.Unlock()
+	this.producer = producer
 	return nil
 }
 
-func (this *Connector) initProducer(ctx context.Context, qos Qos) (err error) {
+func (this *Connector) initProducer(ctx context.Context, qos Qos) (producer kafka.ProducerInterface, err error) {
 	partitionsNum := 1
 	replFactor := 1
 	sync := false
@@ -346,9 +606,13 @@ func (this *Connector) initProducer(ctx context.Context, qos Qos) (err error) {
 		sync = true
 		idempotent = true
 	default:
-		return errors.New("unknown qos=" + strconv.Itoa(int(qos)))
+		return nil, errors.New("unknown qos=" + strconv.Itoa(int(qos)))
+	}
+	outbox, err := this.getOutboxConfig(qos)
+	if err != nil {
+		return nil, err
 	}
-	this.producer[qos], err = kafka.PrepareProducerWithConfig(ctx, this.Config.KafkaUrl, kafka.Config{
+	producer, err = kafka.PrepareProducerWithConfig(ctx, this.Config.KafkaUrl, kafka.Config{
 		AsyncFlushMessages:  this.Config.AsyncFlushMessages,
 		AsyncFlushFrequency: this.Config.AsyncFlushFrequency,
 		AsyncCompression:    this.Config.AsyncCompression,
@@ -360,71 +624,169 @@ func (this *Connector) initProducer(ctx context.Context, qos Qos) (err error) {
 		TopicConfigMap:      this.Config.KafkaTopicConfigs,
 		InitTopics:          this.Config.InitTopics,
 		Logger:              this.Config.GetLogger(),
+		Outbox:              outbox,
+		AsyncErrorHandler:   this.getAsyncProducerErrorHandler(qos, outbox),
 	})
 	if err != nil {
 		this.Config.GetLogger().Error("unable to prepare producer", "error", err)
-		return err
+		return nil, err
 	}
-	return
+	return producer, nil
+}
+
+// getAsyncProducerErrorHandler returns nil if an outbox is used, to let the outbox store failed messages
+func (this *Connector) getAsyncProducerErrorHandler(qos Qos, outbox *kafka.OutboxConfig) func(message kafka.Message, hasKey bool, err error) {
+	if outbox != nil {
+		return nil
+	}
+	return func(message kafka.Message, hasKey bool, err error) {
+		this.fatal(&FatalError{Source: FatalKafkaProducer, Topic: message.Topic, Err: err, Retry: func(ctx context.Context) error {
+			producer, err := this.GetProducer(qos)
+			if err != nil {
+				return err
+			}
+			if !hasKey {
+				return producer.Produce(message.Topic, message.Value)
+			}
+			return kafka.ProduceWithTimestampCtx(ctx, producer, message.Topic, message.Value, message.Key, message.Timestamp)
+		}})
+	}
+}
+
+func (this *Connector) getOutboxConfig(qos Qos) (result *kafka.OutboxConfig, err error) {
+	if !isSet(this.Config.KafkaOutboxDir) {
+		return nil, nil
+	}
+	result = &kafka.OutboxConfig{
+		Dir:      filepath.Join(this.Config.KafkaOutboxDir, "qos_"+strconv.Itoa(int(qos))),
+		MaxBytes: this.Config.KafkaOutboxMaxBytes,
+	}
+	if isSet(this.Config.KafkaOutboxMaxAge) {
+		result.MaxAge, err = time.ParseDuration(this.Config.KafkaOutboxMaxAge)
+		if err != nil {
+			return nil, errors.New("unable to parse KafkaOutboxMaxAge as duration: " + err.Error())
+		}
+	}
+	if isSet(this.Config.KafkaOutboxRetryInterval) {
+		result.RetryInterval, err = time.ParseDuration(this.Config.KafkaOutboxRetryInterval)
+		if err != nil {
+			return nil, errors.New("unable to parse KafkaOutboxRetryInterval as duration: " + err.Error())
+		}
+	}
+	return result, nil
 }
 
 func (this *Connector) HandleDeviceEvent(username string, password string, deviceId string, serviceId string, protocolParts map[string]string, qos Qos, remoteInfo model.RemoteInfo) (err error) {
-	token, err := this.security.GetUserToken(username, password, remoteInfo)
+	return this.HandleDeviceEventCtx(context.Background(), username, password, deviceId, serviceId, protocolParts, qos, remoteInfo)
+}
+
+func (this *Connector) HandleDeviceEventCtx(ctx context.Context, username string, password string, deviceId string, serviceId string, protocolParts map[string]string, qos Qos, remoteInfo model.RemoteInfo) (err error) {
+	token, err := this.getUserToken(ctx, username, password, remoteInfo)
 	if err != nil {
-		this.Config.GetLogger().Error("unable to get user token", "error", err, "username", username)
+		//failed logins are not sent as dead letter
 		return err
 	}
-	return this.HandleDeviceEventWithAuthToken(token, deviceId, serviceId, protocolParts, qos)
+	return this.HandleDeviceEventWithAuthTokenCtx(ctx, token, deviceId, serviceId, protocolParts, qos)
 }
 
 func (this *Connector) HandleDeviceEventWithAuthToken(token security.JwtToken, deviceId string, serviceId string, eventMsg EventMsg, qos Qos) (err error) {
-	return this.handleDeviceEvent(token, deviceId, serviceId, eventMsg, qos)
+	return this.HandleDeviceEventWithAuthTokenCtx(context.Background(), token, deviceId, serviceId, eventMsg, qos)
+}
+
+func (this *Connector) HandleDeviceEventWithAuthTokenCtx(ctx context.Context, token security.JwtToken, deviceId string, serviceId string, eventMsg EventMsg, qos Qos) (err error) {
+	if !this.startEvent() {
+		return ErrShuttingDown
+	}
+	defer this.finishEvent()
+	if err = this.verifyToken(token); err != nil {
+		this.deadLetterEvent(ctx, DeadLetter{DeviceId: deviceId, ServiceId: serviceId}, eventMsg, err)
+		return err
+	}
+	if err = this.checkEventRateLimit(token, deviceId); err != nil {
+		return err
+	}
+	return this.handleDeviceEvent(ctx, token, deviceId, serviceId, eventMsg, qos)
 }
 
 func (this *Connector) HandleDeviceRefEvent(username string, password string, deviceUri string, serviceUri string, eventMsg EventMsg, qos Qos, remoteInfo model.RemoteInfo) (info HandledDeviceInfo, err error) {
-	token, err := this.security.GetUserToken(username, password, remoteInfo)
+	return this.HandleDeviceRefEventCtx(context.Background(), username, password, deviceUri, serviceUri, eventMsg, qos, remoteInfo)
+}
+
+func (this *Connector) HandleDeviceRefEventCtx(ctx context.Context, username string, password string, deviceUri string, serviceUri string, eventMsg EventMsg, qos Qos, remoteInfo model.RemoteInfo) (info HandledDeviceInfo, err error) {
+	token, err := this.getUserToken(ctx, username, password, remoteInfo)
 	if err != nil {
-		this.Config.GetLogger().Error("unable to get user token", "error", err, "username", username)
+		//failed logins are not sent as dead letter
 		return info, err
 	}
-	return this.HandleDeviceRefEventWithAuthToken(token, deviceUri, serviceUri, eventMsg, qos)
+	return this.HandleDeviceRefEventWithAuthTokenCtx(ctx, token, deviceUri, serviceUri, eventMsg, qos)
 }
 
 func (this *Connector) HandleDeviceRefEventWithAuthToken(token security.JwtToken, deviceUri string, serviceUri string, eventMsg EventMsg, qos Qos) (info HandledDeviceInfo, err error) {
-	return this.handleDeviceRefEvent(token, deviceUri, serviceUri, eventMsg, qos)
+	return this.HandleDeviceRefEventWithAuthTokenCtx(context.Background(), token, deviceUri, serviceUri, eventMsg, qos)
+}
+
+func (this *Connector) HandleDeviceRefEventWithAuthTokenCtx(ctx context.Context, token security.JwtToken, deviceUri string, serviceUri string, eventMsg EventMsg, qos Qos) (info HandledDeviceInfo, err error) {
+	if !this.startEvent() {
+		return info, ErrShuttingDown
+	}
+	defer this.finishEvent()
+	if err = this.verifyToken(token); err != nil {
+		this.deadLetterEvent(ctx, DeadLetter{DeviceLocalId: deviceUri, ServiceLocalId: serviceUri}, eventMsg, err)
+		return info, err
+	}
+	return this.handleDeviceRefEvent(ctx, token, deviceUri, serviceUri, eventMsg, qos)
 }
 
 func (this *Connector) HandleDeviceIdentEvent(username string, password string, deviceId string, localDeviceId string, serviceId string, localServiceId string, eventMsg EventMsg, qos Qos, remoteInfo model.RemoteInfo) (info HandledDeviceInfo, err error) {
-	token, err := this.security.GetUserToken(username, password, remoteInfo)
+	return this.HandleDeviceIdentEventCtx(context.Background(), username, password, deviceId, localDeviceId, serviceId, localServiceId, eventMsg, qos, remoteInfo)
+}
+
+func (this *Connector) HandleDeviceIdentEventCtx(ctx context.Context, username string, password string, deviceId string, localDeviceId string, serviceId string, localServiceId string, eventMsg EventMsg, qos Qos, remoteInfo model.RemoteInfo) (info HandledDeviceInfo, err error) {
+	token, err := this.getUserToken(ctx, username, password, remoteInfo)
 	if err != nil {
-		this.Config.GetLogger().Error("unable to get user token", "error", err, "username", username)
+		//failed logins are not sent as dead letter
 		return info, err
 	}
-	return this.HandleDeviceIdentEventWithAuthToken(token, deviceId, localDeviceId, serviceId, localServiceId, eventMsg, qos)
+	return this.HandleDeviceIdentEventWithAuthTokenCtx(ctx, token, deviceId, localDeviceId, serviceId, localServiceId, eventMsg, qos)
 }
 
 func (this *Connector) HandleDeviceIdentEventWithAuthToken(token security.JwtToken, deviceId string, localDeviceId string, serviceId string, localServiceId string, eventMsg EventMsg, qos Qos) (info HandledDeviceInfo, err error) {
+	return this.HandleDeviceIdentEventWithAuthTokenCtx(context.Background(), token, deviceId, localDeviceId, serviceId, localServiceId, eventMsg, qos)
+}
+
+func (this *Connector) HandleDeviceIdentEventWithAuthTokenCtx(ctx context.Context, token security.JwtToken, deviceId string, localDeviceId string, serviceId string, localServiceId string, eventMsg EventMsg, qos Qos) (info HandledDeviceInfo, err error) {
+	if !this.startEvent() {
+		return info, ErrShuttingDown
+	}
+	defer this.finishEvent()
+	if err = this.verifyToken(token); err != nil {
+		this.deadLetterEvent(ctx, DeadLetter{DeviceId: deviceId, DeviceLocalId: localDeviceId, ServiceId: serviceId, ServiceLocalId: localServiceId}, eventMsg, err)
+		return info, err
+	}
+	cache := this.IotCache.WithToken(token).WithContext(ctx)
 	var device model.Device
 	if deviceId == "" {
 		if localDeviceId == "" {
 			return info, errors.New("missing deviceId or localDeviceId")
 		} else {
-			device, err = this.IotCache.WithToken(token).GetDeviceByLocalId(localDeviceId)
+			device, err = cache.GetDeviceByLocalId(localDeviceId)
 			if err != nil {
 				this.Config.GetLogger().Error("unable to get device by localId", "error", err, "localDeviceId", localDeviceId)
+				this.deadLetterEvent(ctx, DeadLetter{DeviceLocalId: localDeviceId, ServiceId: serviceId, ServiceLocalId: localServiceId}, eventMsg, err)
 				return info, err
 			}
 			deviceId = device.Id
 		}
 	} else {
-		device, err = this.IotCache.WithToken(token).GetDevice(deviceId)
+		device, err = cache.GetDevice(deviceId)
 		if err != nil {
 			this.Config.GetLogger().Error("unable to get device", "error", err, "deviceId", deviceId)
+			this.deadLetterEvent(ctx, DeadLetter{DeviceId: deviceId, ServiceId: serviceId, ServiceLocalId: localServiceId}, eventMsg, err)
 			return info, err
 		}
 	}
 	info.DeviceId = device.Id
-	dt, err := this.IotCache.WithToken(token).GetDeviceType(device.DeviceTypeId)
+	dt, err := cache.GetDeviceType(device.DeviceTypeId)
 	if err != nil {
 		this.Config.GetLogger().Error("unable to get device type", "error", err, "deviceTypeId", device.DeviceTypeId)
 		return info, err
@@ -445,7 +807,10 @@ func (this *Connector) HandleDeviceIdentEventWithAuthToken(token security.JwtTok
 		}
 	}
 	info.ServiceIds = []string{serviceId}
-	err = this.handleDeviceEvent(token, deviceId, serviceId, eventMsg, qos)
+	if err = this.checkEventRateLimit(token, deviceId); err != nil {
+		return info, err
+	}
+	err = this.handleDeviceEvent(ctx, token, deviceId, serviceId, eventMsg, qos)
 	if err != nil {
 		this.Config.GetLogger().Error("unable to handle device event", "error", err, "deviceId", deviceId, "serviceId", serviceId)
 		return info, err
@@ -453,6 +818,19 @@ func (this *Connector) HandleDeviceIdentEventWithAuthToken(token security.JwtTok
 	return info, nil
 }
 
+// getUserToken wraps Security.GetUserToken, which is not context aware, with a check of ctx
+func (this *Connector) getUserToken(ctx context.Context, username string, password string, remoteInfo model.RemoteInfo) (token security.JwtToken, err error) {
+	if err = ctx.Err(); err != nil {
+		return token, err
+	}
+	token, err = this.security.GetUserToken(username, password, remoteInfo)
+	if err != nil {
+		this.Config.GetLogger().Error("unable to get user token", "error", err, "username", username)
+		return token, err
+	}
+	return token, nil
+}
+
 func (this *Connector) Security() Security {
 	return this.security
 }
@@ -473,6 +851,8 @@ func (this *Connector) CleanMsg(msg map[string]interface{}, service model.Servic
 }
 
 func (this *Connector) GetProducer(qos Qos) (producer kafka.ProducerInterface, err error) {
+	this.producerMux.RLock()
+	defer this.producerMux.RUnlock()
 	producer, ok := this.producer[qos]
 	if !ok {
 		return producer, errors.New("no matching producer for qos=" + strconv.Itoa(int(qos)) + " found")
@@ -18,12 +18,23 @@ package correlation
 
 import (
 	"encoding/json"
+	"errors"
 	"github.com/SENERGY-Platform/platform-connector-lib/model"
 	"github.com/bradfitz/gomemcache/memcache"
 	"github.com/google/uuid"
+	"math"
 	"time"
 )
 
+var ErrNotFound = errors.New("unknown correlation id")
+
+// Store holds pending commands by correlation id
+type Store interface {
+	Set(correlationId string, msg model.ProtocolMsg, expiration time.Duration) error
+	// Take returns and removes the stored message; concurrent calls with the same id succeed at most once; returns ErrNotFound for unknown or expired ids
+	Take(correlationId string) (msg model.ProtocolMsg, err error)
+}
+
 type CorrelationService struct {
 	memcached  *memcache.Client
 	expiration int32
@@ -53,3 +64,27 @@ func (this *CorrelationService) Get(correlationId string) (msg model.ProtocolMsg
 	err = json.Unmarshal(item.Value, &msg)
 	return
 }
+
+func (this *CorrelationService) Set(correlationId string, msg model.ProtocolMsg, expiration time.Duration) error {
+	value, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return this.memcached.Set(&memcache.Item{Key: "cid." + correlationId, Value: value, Expiration: int32(math.Ceil(expiration.Seconds()))})
+}
+
+func (this *CorrelationService) Take(correlationId string) (msg model.ProtocolMsg, err error) {
+	msg, err = this.Get(correlationId)
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		return msg, ErrNotFound
+	}
+	if err != nil {
+		return msg, err
+	}
+	//only one caller is able to delete the item
+	err = this.memcached.Delete("cid." + correlationId)
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		return msg, ErrNotFound
+	}
+	return msg, err
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package correlation
+
+import (
+	"sync"
+	"time"
+
+	"github.com/SENERGY-Platform/platform-connector-lib/model"
+)
+
+// MemoryStore is a Store for single instance connectors and tests.
+// expired entries are only removed by Take, which is called for every expired command by the CommandTracker.
+type MemoryStore struct {
+	mux     sync.Mutex
+	entries map[string]memoryEntry
+}
+
+type memoryEntry struct {
+	msg     model.ProtocolMsg
+	expires time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: map[string]memoryEntry{}}
+}
+
+func (this *MemoryStore) Set(correlationId string, msg model.ProtocolMsg, expiration time.Duration) error {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	this.entries[correlationId] = memoryEntry{msg: msg, expires: time.Now().Add(expiration)}
+	return nil
+}
+
+func (this *MemoryStore) Take(correlationId string) (msg model.ProtocolMsg, err error) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	entry, ok := this.entries[correlationId]
+	if !ok {
+		return msg, ErrNotFound
+	}
+	delete(this.entries, correlationId)
+	if time.Now().After(entry.expires) {
+		return msg, ErrNotFound
+	}
+	return entry.msg, nil
+}
@@ -0,0 +1,198 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package platform_connector_lib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/SENERGY-Platform/platform-connector-lib/kafka"
+	"github.com/SENERGY-Platform/platform-connector-lib/security"
+	"github.com/SENERGY-Platform/platform-connector-lib/statistics"
+)
+
+type DeadLetterErrorClass string
+
+const (
+	DeadLetterMarshalling   DeadLetterErrorClass = "marshalling"
+	DeadLetterValidation    DeadLetterErrorClass = "validation"
+	DeadLetterUnitReference DeadLetterErrorClass = "unit_reference"
+	DeadLetterAuth          DeadLetterErrorClass = "auth"
+)
+
+const (
+	DeadLetterTypeEvent   = "event"
+	DeadLetterTypeCommand = "command"
+)
+
+// DeadLetter is sent to Config.DeadLetterTopic for every rejected event or command
+type DeadLetter struct {
+	Type           string               `json:"type"`
+	ErrorClass     DeadLetterErrorClass `json:"error_class"`
+	Error          string               `json:"error"`
+	UserId         string               `json:"user_id,omitempty"`
+	DeviceId       string               `json:"device_id,omitempty"`
+	DeviceLocalId  string               `json:"device_local_id,omitempty"`
+	ServiceId      string               `json:"service_id,omitempty"`
+	ServiceLocalId string               `json:"service_local_id,omitempty"`
+	Payload        string               `json:"payload"` //original payload; event messages are json encoded
+	Time           time.Time            `json:"time"`
+}
+
+// RejectedError marks errors caused by the content of a message
+type RejectedError struct {
+	Class DeadLetterErrorClass
+	Err   error
+}
+
+func (this *RejectedError) Error() string {
+	return this.Err.Error()
+}
+
+func (this *RejectedError) Unwrap() error {
+	return this.Err
+}
+
+func rejected(class DeadLetterErrorClass, err error) error {
+	return &RejectedError{Class: class, Err: err}
+}
+
+func getDeadLetterErrorClass(err error) (class DeadLetterErrorClass, ok bool) {
+	var rejectedErr *RejectedError
+	if errors.As(err, &rejectedErr) {
+		return rejectedErr.Class, true
+	}
+	if errors.Is(err, security.ErrorAccessDenied) {
+		return DeadLetterAuth, true
+	}
+	return "", false
+}
+
+// deadLetterEvent sends msg as dead letter, if err is caused by the message or letter.ErrorClass is set
+func (this *Connector) deadLetterEvent(ctx context.Context, letter DeadLetter, msg EventMsg, err error) {
+	if err == nil || !this.deadLetterEnabled() || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return
+	}
+	if letter.ErrorClass == "" {
+		class, ok := getDeadLetterErrorClass(err)
+		if !ok {
+			return
+		}
+		letter.ErrorClass = class
+	}
+	payload, jsonErr := json.Marshal(msg)
+	if jsonErr != nil {
+		this.Config.GetLogger().Error("unable to marshal dead letter payload", "error", jsonErr)
+		return
+	}
+	letter.Type = DeadLetterTypeEvent
+	letter.Error = this.removeSecretsFromString(err.Error())
+	letter.Payload = string(payload)
+	this.sendDeadLetter(letter)
+}
+
+func (this *Connector) deadLetterCommand(ctx context.Context, letter DeadLetter, payload []byte, err error) {
+	if !this.deadLetterEnabled() {
+		return
+	}
+	letter.Type = DeadLetterTypeCommand
+	letter.Error = this.removeSecretsFromString(err.Error())
+	letter.Payload = string(payload)
+	this.sendDeadLetter(letter)
+}
+
+func (this *Connector) deadLetterEnabled() bool {
+	return isSet(this.Config.DeadLetterTopic)
+}
+
+// deadLetterQueueSize limits the dead letters waiting to be sent; further dead letters are dropped
+const deadLetterQueueSize = 1000
+
+// sendDeadLetter queues the letter, to keep a slow dead letter endpoint out of the event and command paths
+func (this *Connector) sendDeadLetter(letter DeadLetter) {
+	if letter.Time.IsZero() {
+		letter.Time = time.Now()
+	}
+	statistics.DeadLetter(letter.Type, string(letter.ErrorClass))
+	this.deadLetterOnce.Do(func() {
+		this.deadLetterQueue = make(chan DeadLetter, deadLetterQueueSize)
+		go func() {
+			for letter := range this.deadLetterQueue {
+				this.produceDeadLetter(letter)
+				this.pendingDeadLetters.Add(-1)
+				this.deadLetters.Done()
+			}
+		}()
+	})
+	this.deadLetters.Add(1)
+	this.pendingDeadLetters.Add(1)
+	select {
+	case this.deadLetterQueue <- letter:
+	default:
+		this.pendingDeadLetters.Add(-1)
+		this.deadLetters.Done()
+		this.Config.GetLogger().Error("unable to send dead letter: queue is full", "type", letter.Type, "deviceId", letter.DeviceId, "topic", this.Config.DeadLetterTopic)
+	}
+}
+
+func (this *Connector) produceDeadLetter(letter DeadLetter) {
+	msg, err := json.Marshal(letter)
+	if err != nil {
+		this.Config.GetLogger().Error("unable to marshal dead letter", "error", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	topic := this.Config.DeadLetterTopic
+	if strings.HasPrefix(topic, "http://") || strings.HasPrefix(topic, "https://") {
+		req, err := http.NewRequestWithContext(ctx, "POST", topic, bytes.NewReader(msg))
+		if err != nil {
+			this.Config.GetLogger().Error("unable to create dead letter request", "error", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			this.Config.GetLogger().Error("unable to send dead letter", "error", err, "topic", topic)
+			return
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			respMsg, _ := io.ReadAll(resp.Body)
+			this.Config.GetLogger().Error("unexpected response status from dead letter endpoint", "status-code", resp.StatusCode, "error", string(respMsg))
+		}
+		return
+	}
+	for _, qos := range []Qos{Sync, SyncIdempotent, Async} {
+		producer, err := this.GetProducer(qos)
+		if err != nil {
+			continue
+		}
+		err = kafka.ProduceWithTimestampCtx(ctx, producer, topic, string(msg), letter.DeviceId, letter.Time)
+		if err != nil {
+			this.Config.GetLogger().Error("unable to send dead letter", "error", err, "topic", topic)
+		}
+		return
+	}
+	this.Config.GetLogger().Error("unable to send dead letter: no kafka producer available", "topic", topic)
+}
@@ -0,0 +1,118 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package platform_connector_lib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SENERGY-Platform/platform-connector-lib/model"
+	"github.com/SENERGY-Platform/platform-connector-lib/security"
+)
+
+func TestDeadLetter(t *testing.T) {
+	mux := sync.Mutex{}
+	letters := []DeadLetter{}
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		letter := DeadLetter{}
+		err := json.NewDecoder(request.Body).Decode(&letter)
+		if err != nil {
+			t.Error(err)
+		}
+		mux.Lock()
+		defer mux.Unlock()
+		letters = append(letters, letter)
+	}))
+	defer server.Close()
+
+	ctl := &Connector{Config: Config{DeadLetterTopic: server.URL}}
+
+	err := ctl.handleCommand([]byte("not json"), time.Now())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ctl.deadLetterEvent(context.Background(), DeadLetter{DeviceId: "d1", ServiceId: "s1"}, EventMsg{"data": "foo"}, fmt.Errorf("wrapped: %w", rejected(DeadLetterValidation, errors.New("invalid"))))
+	ctl.deadLetterEvent(context.Background(), DeadLetter{DeviceId: "d2"}, EventMsg{"data": "bar"}, security.ErrorAccessDenied)
+
+	//internal errors are not caused by the message and are not sent as dead letter
+	ctl.deadLetterEvent(context.Background(), DeadLetter{DeviceId: "d3"}, EventMsg{"data": "batz"}, security.ErrorInternal)
+
+	ctl.deadLetters.Wait()
+	mux.Lock()
+	defer mux.Unlock()
+	if len(letters) != 3 {
+		t.Fatal(letters)
+	}
+	if letters[0].Type != DeadLetterTypeCommand || letters[0].ErrorClass != DeadLetterMarshalling || letters[0].Payload != "not json" {
+		t.Error(letters[0])
+	}
+	if letters[1].Type != DeadLetterTypeEvent || letters[1].ErrorClass != DeadLetterValidation || letters[1].DeviceId != "d1" || letters[1].Payload != `{"data":"foo"}` || letters[1].Time.IsZero() {
+		t.Error(letters[1])
+	}
+	if letters[2].ErrorClass != DeadLetterAuth || letters[2].DeviceId != "d2" {
+		t.Error(letters[2])
+	}
+}
+
+func TestDeadLetterAsync(t *testing.T) {
+	letters := atomic.Int64{}
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		letters.Add(1)
+	}))
+	defer server.Close()
+	auth := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		http.Error(writer, `{"error":"invalid_grant"}`, http.StatusUnauthorized)
+	}))
+	defer auth.Close()
+	sec, err := security.New(auth.URL, "", "", "", "", 0, 0, 0, nil, 0, 0, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctl := &Connector{Config: Config{DeadLetterTopic: server.URL}, security: sec}
+
+	//a slow dead letter endpoint does not delay the rejected event
+	start := time.Now()
+	ctl.deadLetterEvent(context.Background(), DeadLetter{DeviceId: "d1"}, EventMsg{"data": "foo"}, rejected(DeadLetterValidation, errors.New("invalid")))
+	if time.Since(start) > 100*time.Millisecond {
+		t.Error(time.Since(start))
+	}
+
+	//failed logins are not sent as dead letter
+	err = ctl.HandleDeviceEventCtx(context.Background(), "user", "pw", "d1", "s1", EventMsg{"data": "bar"}, Async, model.RemoteInfo{})
+	if !errors.Is(err, security.ErrorAccessDenied) {
+		t.Error(err)
+	}
+
+	err = ctl.Shutdown(context.Background())
+	if err != nil {
+		t.Error(err)
+	}
+	if letters.Load() != 1 {
+		t.Error(letters.Load())
+	}
+}
@@ -0,0 +1,198 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package deduplication
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+type Entry struct {
+	Done     bool              `json:"done"` //false while the command is handled
+	Response map[string]string `json:"response,omitempty"`
+	Qos      int               `json:"qos"`
+}
+
+// Store remembers handled commands for a limited time
+type Store interface {
+	Get(key string) (entry Entry, found bool, err error)
+	Set(key string, entry Entry, ttl time.Duration) error
+	// Add stores entry only if key is not set; otherwise the existing entry is returned with added == false
+	Add(key string, entry Entry, ttl time.Duration) (existing Entry, added bool, err error)
+	Delete(key string) error
+}
+
+// LruStore is a bounded in-memory Store; the least recently used entries are removed if Size is exceeded
+type LruStore struct {
+	size    int
+	mux     sync.Mutex
+	list    *list.List
+	entries map[string]*list.Element
+}
+
+type lruElement struct {
+	key     string
+	entry   Entry
+	expires time.Time
+}
+
+func NewLruStore(size int) *LruStore {
+	if size <= 0 {
+		size = 10000
+	}
+	return &LruStore{size: size, list: list.New(), entries: map[string]*list.Element{}}
+}
+
+func (this *LruStore) Get(key string) (entry Entry, found bool, err error) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	element, ok := this.entries[key]
+	if !ok {
+		return entry, false, nil
+	}
+	value := element.Value.(*lruElement)
+	if time.Now().After(value.expires) {
+		this.list.Remove(element)
+		delete(this.entries, key)
+		return entry, false, nil
+	}
+	this.list.MoveToFront(element)
+	return value.entry, true, nil
+}
+
+func (this *LruStore) Set(key string, entry Entry, ttl time.Duration) error {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	this.set(key, entry, ttl)
+	return nil
+}
+
+func (this *LruStore) Add(key string, entry Entry, ttl time.Duration) (existing Entry, added bool, err error) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	if element, ok := this.entries[key]; ok {
+		value := element.Value.(*lruElement)
+		if time.Now().Before(value.expires) {
+			this.list.MoveToFront(element)
+			return value.entry, false, nil
+		}
+	}
+	this.set(key, entry, ttl)
+	return entry, true, nil
+}
+
+func (this *LruStore) set(key string, entry Entry, ttl time.Duration) {
+	value := &lruElement{key: key, entry: entry, expires: time.Now().Add(ttl)}
+	if element, ok := this.entries[key]; ok {
+		element.Value = value
+		this.list.MoveToFront(element)
+		return
+	}
+	this.entries[key] = this.list.PushFront(value)
+	for this.list.Len() > this.size {
+		oldest := this.list.Back()
+		this.list.Remove(oldest)
+		delete(this.entries, oldest.Value.(*lruElement).key)
+	}
+}
+
+func (this *LruStore) Delete(key string) error {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	if element, ok := this.entries[key]; ok {
+		this.list.Remove(element)
+		delete(this.entries, key)
+	}
+	return nil
+}
+
+// MemcachedStore shares the de-duplication between connector instances
+type MemcachedStore struct {
+	memcached *memcache.Client
+}
+
+func NewMemcachedStore(maxIdleConns int, timeout time.Duration, memcachedServer ...string) *MemcachedStore {
+	client := memcache.New(memcachedServer...)
+	client.MaxIdleConns = maxIdleConns
+	client.Timeout = timeout
+	return &MemcachedStore{memcached: client}
+}
+
+func (this *MemcachedStore) Get(key string) (entry Entry, found bool, err error) {
+	item, err := this.memcached.Get(memcachedKey(key))
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		return entry, false, nil
+	}
+	if err != nil {
+		return entry, false, err
+	}
+	err = json.Unmarshal(item.Value, &entry)
+	return entry, err == nil, err
+}
+
+func (this *MemcachedStore) Set(key string, entry Entry, ttl time.Duration) error {
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return this.memcached.Set(&memcache.Item{Key: memcachedKey(key), Value: value, Expiration: int32(math.Ceil(ttl.Seconds()))})
+}
+
+func (this *MemcachedStore) Add(key string, entry Entry, ttl time.Duration) (existing Entry, added bool, err error) {
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return existing, false, err
+	}
+	for attempt := 0; attempt < 2; attempt++ {
+		err = this.memcached.Add(&memcache.Item{Key: memcachedKey(key), Value: value, Expiration: int32(math.Ceil(ttl.Seconds()))})
+		if err == nil {
+			return entry, true, nil
+		}
+		if !errors.Is(err, memcache.ErrNotStored) {
+			return existing, false, err
+		}
+		var found bool
+		existing, found, err = this.Get(key)
+		if err != nil || found {
+			return existing, false, err
+		}
+		//entry expired between Add and Get
+	}
+	return existing, false, errors.New("unable to add de-duplication entry")
+}
+
+func (this *MemcachedStore) Delete(key string) error {
+	err := this.memcached.Delete(memcachedKey(key))
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		return nil
+	}
+	return err
+}
+
+// memcachedKey hashes the key to respect the memcached key limits (max 250 chars, no whitespace)
+func memcachedKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return "dedup." + hex.EncodeToString(hash[:])
+}
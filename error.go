@@ -21,11 +21,10 @@ import (
 	"encoding/json"
 	"errors"
 	"io"
-	"log"
 	"net/http"
-	"runtime/debug"
 	"strings"
 
+	"github.com/SENERGY-Platform/platform-connector-lib/grpccommand"
 	"github.com/SENERGY-Platform/platform-connector-lib/model"
 )
 
@@ -60,6 +59,11 @@ func (this *Connector) HandleDeviceError(userId string, device model.Device, err
 }
 
 func (this *Connector) HandleCommandError(userId string, commandRequest model.ProtocolMsg, errorMessage string) {
+	this.HandleCommandErrorWithReason(userId, commandRequest, "", errorMessage)
+}
+
+// HandleCommandErrorWithReason adds the reason as "error_reason" to the response output, if set
+func (this *Connector) HandleCommandErrorWithReason(userId string, commandRequest model.ProtocolMsg, reason CommandErrorReason, errorMessage string) {
 	notificationMessage := "Error: " + errorMessage +
 		"\n\nDevice: " + commandRequest.Metadata.Device.Name + " (" + commandRequest.Metadata.Device.Id + ")" +
 		"\nService: " + commandRequest.Metadata.Service.Name + " (" + commandRequest.Metadata.Service.LocalId + ")"
@@ -75,6 +79,10 @@ func (this *Connector) HandleCommandError(userId string, commandRequest model.Pr
 		err = nil
 	}
 
+	if this.resolveSyncCommand(commandRequest, nil, getSyncCommandError(reason, errorMessage)) {
+		return
+	}
+
 	topic := commandRequest.Metadata.ErrorTo
 	if topic == "" {
 		this.Config.GetLogger().Warn("no Metadata.ErrorTo value set in command --> error will not be forwarded")
@@ -85,13 +93,22 @@ func (this *Connector) HandleCommandError(userId string, commandRequest model.Pr
 		commandRequest.Response.Output = map[string]string{}
 	}
 	commandRequest.Response.Output["error"] = errorMessage
+	if reason != "" {
+		commandRequest.Response.Output["error_reason"] = string(reason)
+	}
 	responseMsg, err := json.Marshal(commandRequest)
 	if err != nil {
 		this.Config.GetLogger().Error("json marshal error", "error", err)
 		return
 	}
 
-	if strings.HasPrefix(topic, "http://") || strings.HasPrefix(topic, "https://") {
+	if grpccommand.IsResponseTo(topic) && this.grpcServer != nil {
+		err = this.grpcServer.SendTo(topic, grpccommand.Message{Error: responseMsg})
+		if err != nil {
+			this.Config.GetLogger().Error("grpc producer error", "error", err)
+			return
+		}
+	} else if strings.HasPrefix(topic, "http://") || strings.HasPrefix(topic, "https://") {
 		resp, err := http.Post(topic, "application/json", bytes.NewReader(responseMsg))
 		if err != nil {
 			this.Config.GetLogger().Error("http producer error", "error", err, "topic", topic)
@@ -112,11 +129,7 @@ func (this *Connector) HandleCommandError(userId string, commandRequest model.Pr
 		}
 		err = producer.ProduceWithKey(topic, string(responseMsg), commandRequest.Metadata.Device.Id)
 		if err != nil && this.Config.FatalKafkaError {
-			if this.Config.Debug {
-				debug.PrintStack()
-			}
-			this.Config.GetLogger().Error("FATAL: unable to producer to kafka", "error", err)
-			log.Fatal("FATAL: ", err)
+			this.fatal(&FatalError{Source: FatalCommandError, Topic: topic, Err: err})
 		}
 	}
 	return
@@ -17,39 +17,37 @@
 package platform_connector_lib
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
-	"log"
+	"maps"
 	"runtime/debug"
-	"sync"
 	"time"
 
 	"github.com/SENERGY-Platform/platform-connector-lib/iot"
 	"github.com/SENERGY-Platform/platform-connector-lib/marshalling"
 	"github.com/SENERGY-Platform/platform-connector-lib/model"
 	"github.com/SENERGY-Platform/platform-connector-lib/security"
-	"github.com/SENERGY-Platform/platform-connector-lib/statistics"
 	"github.com/SENERGY-Platform/platform-connector-lib/unitreference"
 )
 
-func (this *Connector) unmarshalMsgFromRef(token security.JwtToken, device model.Device, service model.Service, msg map[string]string, iot *iot.Cache) (result map[string]interface{}, err error) {
+func (this *Connector) unmarshalMsgFromRef(ctx context.Context, token security.JwtToken, device model.Device, service model.Service, msg map[string]string, iot *iot.Cache) (result map[string]interface{}, err error) {
 	result = map[string]interface{}{}
-	protocol, err := iot.GetProtocol(service.ProtocolId)
+	protocol, err := iot.WithContext(ctx).GetProtocol(service.ProtocolId)
 	if err != nil {
 		return result, err
 	}
-	return this.unmarshalMsg(token, device, service, protocol, msg)
+	return this.unmarshalMsg(ctx, token, device, service, protocol, msg)
 }
 
-func (this *Connector) unmarshalMsg(token security.JwtToken, device model.Device, service model.Service, protocol model.Protocol, msg map[string]string) (result map[string]interface{}, err error) {
+func (this *Connector) unmarshalMsg(ctx context.Context, token security.JwtToken, device model.Device, service model.Service, protocol model.Protocol, msg map[string]string) (result map[string]interface{}, err error) {
 	result = map[string]interface{}{}
 	fallback, fallbackKnown := marshalling.Get(this.Config.SerializationFallback)
 	for _, output := range service.Outputs {
 		if output.ContentVariable.Name != "" && (fallbackKnown || output.Serialization != "") {
 			marshaller, ok := marshalling.Get(string(output.Serialization))
 			if !ok {
-				return result, errors.New("unknown format " + string(output.Serialization))
+				return result, rejected(DeadLetterMarshalling, errors.New("unknown format "+string(output.Serialization)))
 			}
 			for _, segment := range protocol.ProtocolSegments {
 				if segment.Id == output.ProtocolSegmentId {
@@ -67,7 +65,7 @@ func (this *Connector) unmarshalMsg(token security.JwtToken, device model.Device
 								}
 							}
 							this.notifyMessageFormatError(device, service, fmt.Errorf("unable to serialize to %v: err=\"%w\"; msg=%#v", string(output.Serialization), err, message))
-							return result, err
+							return result, rejected(DeadLetterMarshalling, err)
 						}
 						result[output.ContentVariable.Name] = out
 					}
@@ -76,20 +74,23 @@ func (this *Connector) unmarshalMsg(token security.JwtToken, device model.Device
 		}
 	}
 
-	err = unitreference.FillUnitsForService(&service, token, this.IotCache)
+	err = unitreference.FillUnitsForService(&service, token, this.IotCache.WithToken(token).WithContext(ctx))
 	if err != nil {
 		this.notifyMessageFormatError(device, service, fmt.Errorf("unable to fill units fot serice: %w", err))
-		return result, err
+		if errors.Is(err, security.ErrorInternal) || errors.Is(err, security.ErrorUnexpectedStatus) {
+			return result, err
+		}
+		return result, rejected(DeadLetterUnitReference, err)
 	}
 	result, err = this.CleanMsg(result, service)
 	if err != nil {
 		this.notifyMessageFormatError(device, service, fmt.Errorf("unable clean message: %w", err))
-		return result, err
+		return result, rejected(DeadLetterValidation, err)
 	}
 	err = this.ValidateMsg(result, service)
 	if err != nil {
 		this.notifyMessageFormatError(device, service, fmt.Errorf("invalid message: %w", err))
-		return result, err
+		return result, rejected(DeadLetterValidation, err)
 	}
 	return result, err
 }
@@ -100,14 +101,19 @@ type HandledDeviceInfo struct {
 	ServiceIds   []string
 }
 
-func (this *Connector) handleDeviceRefEvent(token security.JwtToken, deviceUri string, serviceUri string, msg EventMsg, qos Qos) (info HandledDeviceInfo, err error) {
-	device, err := this.IotCache.WithToken(token).GetDeviceByLocalId(deviceUri)
+func (this *Connector) handleDeviceRefEvent(ctx context.Context, token security.JwtToken, deviceUri string, serviceUri string, msg EventMsg, qos Qos) (info HandledDeviceInfo, err error) {
+	cache := this.IotCache.WithToken(token).WithContext(ctx)
+	device, err := cache.GetDeviceByLocalId(deviceUri)
 	if err != nil {
 		this.Config.GetLogger().Error("unable to get device by local id", "error", err, "deviceLocalId", deviceUri)
+		this.deadLetterEvent(ctx, DeadLetter{DeviceLocalId: deviceUri, ServiceLocalId: serviceUri}, msg, err)
 		return info, err
 	}
 	info.DeviceId = device.Id
-	dt, err := this.IotCache.WithToken(token).GetDeviceType(device.DeviceTypeId)
+	if err = this.checkEventRateLimit(token, device.Id); err != nil {
+		return info, err
+	}
+	dt, err := cache.GetDeviceType(device.DeviceTypeId)
 	if err != nil {
 		this.Config.GetLogger().Error("unable to get device type", "error", err, "deviceTypeId", device.DeviceTypeId)
 		return info, err
@@ -116,7 +122,7 @@ func (this *Connector) handleDeviceRefEvent(token security.JwtToken, deviceUri s
 	found := false
 	for _, service := range dt.Services {
 		if service.LocalId == serviceUri && len(service.Outputs) > 0 {
-			err = this.handleDeviceEvent(token, device.Id, service.Id, msg, qos)
+			err = this.handleDeviceEvent(ctx, token, device.Id, service.Id, msg, qos)
 			if err != nil {
 				this.Config.GetLogger().Error("unable to handle device event", "error", err, "deviceId", device.Id, "serviceId", service.Id, "msg", fmt.Sprintf("%#v", msg))
 				return info, err
@@ -131,10 +137,12 @@ func (this *Connector) handleDeviceRefEvent(token security.JwtToken, deviceUri s
 	return info, nil
 }
 
-func (this *Connector) handleDeviceEvent(token security.JwtToken, deviceId string, serviceId string, msg EventMsg, qos Qos) (err error) {
-	cache := this.IotCache.WithToken(token)
+func (this *Connector) handleDeviceEvent(ctx context.Context, token security.JwtToken, deviceId string, serviceId string, msg EventMsg, qos Qos) (err error) {
+	original := maps.Clone(msg)
+	cache := this.IotCache.WithToken(token).WithContext(ctx)
 	device, err := cache.GetDevice(deviceId)
 	if err != nil {
+		this.deadLetterEvent(ctx, DeadLetter{DeviceId: deviceId, ServiceId: serviceId}, original, err)
 		return err
 	}
 	dt, err := cache.GetDeviceType(device.DeviceTypeId)
@@ -157,22 +165,38 @@ func (this *Connector) handleDeviceEvent(token security.JwtToken, deviceId strin
 		msg, timestamp = this.Config.EventTimeProvider(msg)
 	}
 
-	eventValue, err := this.unmarshalMsgFromRef(token, device, service, msg, cache)
+	pl, err := token.GetPayload()
 	if err != nil {
 		return err
 	}
+	info := EventInfo{Token: token, UserId: pl.UserId, Device: device, Service: service, Qos: qos, Time: timestamp}
 
-	envelope := model.Envelope{DeviceId: deviceId, ServiceId: serviceId}
-	envelope.Value = eventValue
-	pl, err := token.GetPayload()
+	msg, err = this.applyRawEventMiddlewares(ctx, info, msg)
+	if err != nil || msg == nil {
+		return err
+	}
+
+	eventValue, err := this.unmarshalMsgFromRef(ctx, token, device, service, msg, cache)
 	if err != nil {
+		this.deadLetterEvent(ctx, DeadLetter{UserId: info.UserId, DeviceId: device.Id, DeviceLocalId: device.LocalId, ServiceId: service.Id, ServiceLocalId: service.LocalId, Time: timestamp}, original, err)
 		return err
 	}
 
-	return this.sendEventEnvelope(envelope, qos, service, pl.UserId, timestamp)
+	envelopes, err := this.applyEnvelopeMiddlewares(ctx, AfterValidation, info, model.Envelope{DeviceId: deviceId, ServiceId: serviceId, Value: eventValue})
+	if err != nil {
+		return err
+	}
+	for _, envelope := range envelopes {
+		err = this.sendEventEnvelope(ctx, info, envelope)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (this *Connector) trySendingResponseAsEvent(cmd model.ProtocolMsg, resp CommandResponseMsg, qos Qos) {
+	ctx := context.Background()
 	token, err := this.Security().Access()
 	if err != nil {
 		this.Config.GetLogger().Error("unable to get access token", "error", err)
@@ -181,113 +205,60 @@ func (this *Connector) trySendingResponseAsEvent(cmd model.ProtocolMsg, resp Com
 		}
 		return
 	}
-	eventValue, err := this.unmarshalMsg(token, cmd.Metadata.Device, cmd.Metadata.Service, cmd.Metadata.Protocol, resp)
+
+	pl, err := token.GetPayload()
 	if err != nil {
-		this.Config.GetLogger().Error("unable to unmarshal response msg", "error", err)
+		this.Config.GetLogger().Error("unable to get payload", "error", err)
 		if this.Config.Debug {
 			debug.PrintStack()
 		}
 		return
 	}
+	info := EventInfo{Token: token, UserId: pl.UserId, Device: cmd.Metadata.Device, Service: cmd.Metadata.Service, Qos: qos, Time: time.Now()}
 
-	deviceId := TrimIdModifier(cmd.Metadata.Device.Id)
-	envelope := model.Envelope{DeviceId: deviceId, ServiceId: cmd.Metadata.Service.Id}
-	envelope.Value = eventValue
-
-	pl, err := token.GetPayload()
-	if err != nil {
-		this.Config.GetLogger().Error("unable to get payload", "error", err)
-		if this.Config.Debug {
-			debug.PrintStack()
+	resp, err = this.applyRawEventMiddlewares(ctx, info, resp)
+	if err != nil || resp == nil {
+		if err != nil {
+			this.Config.GetLogger().Error("unable to apply raw event middlewares to response msg", "error", err)
 		}
 		return
 	}
 
-	err = this.sendEventEnvelope(envelope, qos, cmd.Metadata.Service, pl.UserId, time.Now())
+	eventValue, err := this.unmarshalMsg(ctx, token, cmd.Metadata.Device, cmd.Metadata.Service, cmd.Metadata.Protocol, resp)
 	if err != nil {
-		this.Config.GetLogger().Error("unable to send event envelope", "error", err)
+		this.Config.GetLogger().Error("unable to unmarshal response msg", "error", err)
+		this.deadLetterEvent(ctx, DeadLetter{UserId: info.UserId, DeviceId: cmd.Metadata.Device.Id, DeviceLocalId: cmd.Metadata.Device.LocalId, ServiceId: cmd.Metadata.Service.Id, ServiceLocalId: cmd.Metadata.Service.LocalId}, resp, err)
 		if this.Config.Debug {
 			debug.PrintStack()
 		}
 		return
 	}
-}
 
-func (this *Connector) sendEventEnvelope(envelope model.Envelope, qos Qos, service model.Service, userId string, timestamp time.Time) error {
-	jsonMsg, err := json.Marshal(envelope)
-	if err != nil {
-		this.Config.GetLogger().Error("unable to marshal event envelope", "error", err)
-		return err
-	}
-	if this.Config.Debug {
-		now := time.Now()
-		defer func(start time.Time) {
-			this.Config.GetLogger().Debug("sendEventEnvelope", "duration", time.Now().Sub(start))
-		}(now)
-	}
-	serviceTopic := model.ServiceIdToTopic(envelope.ServiceId)
-	producer, err := this.GetProducer(qos)
+	deviceId := TrimIdModifier(cmd.Metadata.Device.Id)
+	envelopes, err := this.applyEnvelopeMiddlewares(ctx, AfterValidation, info, model.Envelope{DeviceId: deviceId, ServiceId: cmd.Metadata.Service.Id, Value: eventValue})
 	if err != nil {
-		this.Config.GetLogger().Error("unable to get kafka producer", "error", err)
-		return err
+		this.Config.GetLogger().Error("unable to apply envelope middlewares to response msg", "error", err)
+		return
 	}
 
-	var pgErr error
-	var kafkaErr error
-
-	pgWg := sync.WaitGroup{}
-	if this.Config.PublishToPostgres {
-		if qos == Async {
-			this.asyncPgBackpressure <- true //reserve one of the limited go routines
-		} else {
-			pgWg.Add(1)
-		}
-
-		go func() {
-			defer func() {
-				if qos == Async {
-					<-this.asyncPgBackpressure //free one of the limited go routines
-				} else {
-					defer pgWg.Done()
-				}
-			}()
-			timescaleStart := time.Now()
-			pgErr, shouldNotify := this.postgresPublisher.Publish(envelope, service)
-			if pgErr != nil {
-				this.Config.GetLogger().Error("unable to publish event to postgres", "error", pgErr)
-				if shouldNotify {
-					this.notifyDeviceOwners(envelope.DeviceId, Notification{
-						Title:   "DeviceType Timescale Configuration Error",
-						Message: "Error: " + err.Error() + "\n\nDeviceId: " + envelope.DeviceId + "\nService: " + service.Name + " (" + service.LocalId + ")",
-					})
-				}
-				return
-			}
-			statistics.TimescaleWrite(time.Since(timescaleStart), userId)
-			return
-		}()
-	}
-	kafkaStart := time.Now()
-	kafkaErr = producer.ProduceWithTimestamp(serviceTopic, string(jsonMsg), envelope.DeviceId, timestamp)
-	if err != nil {
-		if this.Config.FatalKafkaError {
+	for _, envelope := range envelopes {
+		err = this.sendEventEnvelope(ctx, info, envelope)
+		if err != nil {
+			this.Config.GetLogger().Error("unable to send event envelope", "error", err)
 			if this.Config.Debug {
 				debug.PrintStack()
 			}
-			this.Config.GetLogger().Error("FATAL: unable to produce event to kafka", "error", kafkaErr)
-			log.Fatal("FATAL: while producing for topic: '", serviceTopic, "' :", kafkaErr)
+			return
 		}
-		this.Config.GetLogger().Error("unable to produce event to service topic", "error", kafkaErr, "topic", serviceTopic)
 	}
-	statistics.KafkaWrite(time.Since(kafkaStart), userId)
-
-	pgWg.Wait()
+}
 
-	if kafkaErr != nil {
-		return kafkaErr
-	}
-	if pgErr != nil {
-		return pgErr
+func (this *Connector) sendEventEnvelope(ctx context.Context, info EventInfo, envelope model.Envelope) error {
+	if this.Config.Debug {
+		now := time.Now()
+		defer func(start time.Time) {
+			this.Config.GetLogger().Debug("sendEventEnvelope", "duration", time.Now().Sub(start))
+		}(now)
 	}
-	return nil
+	return this.sendToSinks(ctx, []SinkEvent{{Info: info, Envelope: envelope}})[0]
 }
@@ -0,0 +1,160 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package platform_connector_lib
+
+import (
+	"context"
+	"time"
+
+	"github.com/SENERGY-Platform/platform-connector-lib/model"
+	"github.com/SENERGY-Platform/platform-connector-lib/security"
+)
+
+type EventBatchItem struct {
+	ServiceUri string
+	Msg        EventMsg
+	Time       time.Time //optional; if zero, Config.EventTimeProvider or time.Now() is used
+}
+
+type EventBatchResult struct {
+	ServiceIds []string
+	Err        error
+}
+
+type batchEnvelope struct {
+	item     int
+	envelope model.Envelope
+	info     EventInfo
+}
+
+func (this *Connector) HandleDeviceEventBatch(token security.JwtToken, deviceUri string, items []EventBatchItem, qos Qos) (info HandledDeviceInfo, results []EventBatchResult, err error) {
+	return this.HandleDeviceEventBatchCtx(context.Background(), token, deviceUri, items, qos)
+}
+
+// HandleDeviceEventBatchCtx handles multiple events of one device. device, device-type and protocols are resolved once
+// and all resulting envelopes are passed to the event sinks in a single batch.
+// err is only set if the batch as a whole could not be handled; failures of single items are reported in results.
+func (this *Connector) HandleDeviceEventBatchCtx(ctx context.Context, token security.JwtToken, deviceUri string, items []EventBatchItem, qos Qos) (info HandledDeviceInfo, results []EventBatchResult, err error) {
+	if !this.startEvent() {
+		return info, results, ErrShuttingDown
+	}
+	defer this.finishEvent()
+	if err = this.verifyToken(token); err != nil {
+		return info, results, err
+	}
+	cache := this.IotCache.WithToken(token).WithContext(ctx)
+	device, err := cache.GetDeviceByLocalId(deviceUri)
+	if err != nil {
+		this.Config.GetLogger().Error("unable to get device by local id", "error", err, "deviceLocalId", deviceUri)
+		for _, item := range items {
+			this.deadLetterEvent(ctx, DeadLetter{DeviceLocalId: deviceUri, ServiceLocalId: item.ServiceUri}, item.Msg, err)
+		}
+		return info, results, err
+	}
+	info.DeviceId = device.Id
+	dt, err := cache.GetDeviceType(device.DeviceTypeId)
+	if err != nil {
+		this.Config.GetLogger().Error("unable to get device type", "error", err, "deviceTypeId", device.DeviceTypeId)
+		return info, results, err
+	}
+	info.DeviceTypeId = dt.Id
+	pl, err := token.GetPayload()
+	if err != nil {
+		return info, results, err
+	}
+
+	results = make([]EventBatchResult, len(items))
+	envelopes := []batchEnvelope{}
+	handledServices := map[string]bool{}
+	for i, item := range items {
+		if limitErr := this.checkEventRateLimit(token, device.Id); limitErr != nil {
+			results[i].Err = limitErr
+			continue
+		}
+		msg := item.Msg
+		timestamp := item.Time
+		if timestamp.IsZero() {
+			timestamp = time.Now()
+			if this.Config.EventTimeProvider != nil {
+				msg, timestamp = this.Config.EventTimeProvider(msg)
+			}
+		}
+		found := false
+		itemEnvelopes := []batchEnvelope{}
+		serviceIds := []string{}
+		for _, service := range dt.Services {
+			if service.LocalId != item.ServiceUri || len(service.Outputs) == 0 {
+				continue
+			}
+			found = true
+			info := EventInfo{Token: token, UserId: pl.UserId, Device: device, Service: service, Qos: qos, Time: timestamp}
+			serviceMsg, err := this.applyRawEventMiddlewares(ctx, info, msg)
+			if err != nil {
+				results[i].Err = err
+				break
+			}
+			if serviceMsg == nil {
+				continue
+			}
+			eventValue, err := this.unmarshalMsgFromRef(ctx, token, device, service, serviceMsg, cache)
+			if err != nil {
+				this.deadLetterEvent(ctx, DeadLetter{UserId: pl.UserId, DeviceId: device.Id, DeviceLocalId: device.LocalId, ServiceId: service.Id, ServiceLocalId: service.LocalId, Time: timestamp}, item.Msg, err)
+				results[i].Err = err
+				break
+			}
+			serviceEnvelopes, err := this.applyEnvelopeMiddlewares(ctx, AfterValidation, info, model.Envelope{DeviceId: device.Id, ServiceId: service.Id, Value: eventValue})
+			if err != nil {
+				results[i].Err = err
+				break
+			}
+			for _, envelope := range serviceEnvelopes {
+				itemEnvelopes = append(itemEnvelopes, batchEnvelope{item: i, envelope: envelope, info: info})
+			}
+			serviceIds = append(serviceIds, service.Id)
+		}
+		if !found {
+			results[i].Err = ErrorUnknownLocalServiceId
+		}
+		if results[i].Err != nil {
+			continue
+		}
+		results[i].ServiceIds = serviceIds
+		envelopes = append(envelopes, itemEnvelopes...)
+	}
+
+	events := make([]SinkEvent, len(envelopes))
+	for i, e := range envelopes {
+		events[i] = SinkEvent{Info: e.info, Envelope: e.envelope}
+	}
+	for i, err := range this.sendToSinks(ctx, events) {
+		if err != nil && results[envelopes[i].item].Err == nil {
+			results[envelopes[i].item].Err = err
+		}
+	}
+
+	for _, result := range results {
+		if result.Err == nil {
+			for _, serviceId := range result.ServiceIds {
+				if !handledServices[serviceId] {
+					handledServices[serviceId] = true
+					info.ServiceIds = append(info.ServiceIds, serviceId)
+				}
+			}
+		}
+	}
+	return info, results, nil
+}
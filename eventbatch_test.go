@@ -0,0 +1,199 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package platform_connector_lib
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SENERGY-Platform/platform-connector-lib/connectionlimit"
+	"github.com/SENERGY-Platform/platform-connector-lib/iot"
+	"github.com/SENERGY-Platform/platform-connector-lib/model"
+	"github.com/SENERGY-Platform/platform-connector-lib/security"
+	"github.com/golang-jwt/jwt"
+)
+
+func TestHandleDeviceEventBatch(t *testing.T) {
+	device := model.Device{Id: "d1", LocalId: "l1", DeviceTypeId: "dt1"}
+	output := func(name string) model.Content {
+		return model.Content{
+			Id:                "c_" + name,
+			ContentVariable:   model.ContentVariable{Id: "v_" + name, Name: "value", Type: model.Integer},
+			Serialization:     "json",
+			ProtocolSegmentId: "seg1",
+		}
+	}
+	deviceType := model.DeviceType{Id: "dt1", Services: []model.Service{
+		{Id: "s1", LocalId: "sl1", ProtocolId: "p1", Outputs: []model.Content{output("s1")}},
+		{Id: "s2", LocalId: "sl2", ProtocolId: "p1", Outputs: []model.Content{output("s2")}},
+		{Id: "s3", LocalId: "sl3", ProtocolId: "p1", Outputs: []model.Content{{
+			Id:                "c_s3",
+			ContentVariable:   model.ContentVariable{Id: "v_s3", Name: "value", Type: model.String},
+			Serialization:     "json",
+			ProtocolSegmentId: "seg1",
+		}}},
+		{Id: "s4", LocalId: "sl3", ProtocolId: "p1", Outputs: []model.Content{output("s4")}},
+	}}
+	protocol := model.Protocol{Id: "p1", ProtocolSegments: []model.ProtocolSegment{{Id: "seg1", Name: "data"}}}
+	repo := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		switch request.URL.Path {
+		case "/local-devices/l1":
+			_ = json.NewEncoder(writer).Encode(device)
+		case "/device-types/dt1":
+			_ = json.NewEncoder(writer).Encode(deviceType)
+		case "/protocols/p1":
+			_ = json.NewEncoder(writer).Encode(protocol)
+		default:
+			http.NotFound(writer, request)
+		}
+	}))
+	defer repo.Close()
+
+	newConnector := func(t *testing.T) (*Connector, *SinkMock) {
+		cache, err := iot.NewCacheWithOptions(iot.New(repo.URL, repo.URL, "", slog.Default()), iot.CacheOptions{DeviceExpiration: 60, DeviceTypeExpiration: 60, CharacteristicExpiration: 60})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sink := &SinkMock{name: "mock"}
+		ctl := &Connector{IotCache: cache}
+		ctl.AddEventSink(sink, SinkOptions{ErrorPolicy: SinkErrorReturn})
+		return ctl, sink
+	}
+
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodRS256, security.KeycloakClaims{StandardClaims: jwt.StandardClaims{Subject: "u1"}}).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := security.JwtToken("Bearer " + signed)
+
+	t.Run("per message errors", func(t *testing.T) {
+		ctl, sink := newConnector(t)
+		info, results, err := ctl.HandleDeviceEventBatchCtx(context.Background(), token, "l1", []EventBatchItem{
+			{ServiceUri: "sl1", Msg: EventMsg{"data": "1"}},
+			{ServiceUri: "unknown", Msg: EventMsg{"data": "2"}},
+			{ServiceUri: "sl2", Msg: EventMsg{"data": "not a number"}},
+			{ServiceUri: "sl2", Msg: EventMsg{"data": "4"}},
+		}, Async)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.DeviceId != "d1" || info.DeviceTypeId != "dt1" || len(info.ServiceIds) != 2 {
+			t.Errorf("%#v", info)
+		}
+		if len(results) != 4 {
+			t.Fatal(results)
+		}
+		if results[0].Err != nil || len(results[0].ServiceIds) != 1 || results[0].ServiceIds[0] != "s1" {
+			t.Errorf("%#v", results[0])
+		}
+		if !errors.Is(results[1].Err, ErrorUnknownLocalServiceId) {
+			t.Error(results[1].Err)
+		}
+		if results[2].Err == nil {
+			t.Error("expected marshalling error")
+		}
+		if results[3].Err != nil {
+			t.Error(results[3].Err)
+		}
+		if len(sink.received) != 2 || sink.received[0].Envelope.ServiceId != "s1" || sink.received[1].Envelope.ServiceId != "s2" {
+			t.Errorf("%#v", sink.received)
+		}
+	})
+
+	t.Run("sink errors", func(t *testing.T) {
+		ctl, sink := newConnector(t)
+		sink.err = errors.New("sink error")
+		_, results, err := ctl.HandleDeviceEventBatchCtx(context.Background(), token, "l1", []EventBatchItem{
+			{ServiceUri: "sl1", Msg: EventMsg{"data": "1"}},
+			{ServiceUri: "sl2", Msg: EventMsg{"data": "2"}},
+		}, Async)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, result := range results {
+			if !errors.Is(result.Err, sink.err) {
+				t.Error(result.Err)
+			}
+		}
+	})
+
+	t.Run("partial item failure", func(t *testing.T) {
+		ctl, sink := newConnector(t)
+		info, results, err := ctl.HandleDeviceEventBatchCtx(context.Background(), token, "l1", []EventBatchItem{
+			{ServiceUri: "sl3", Msg: EventMsg{"data": `"text"`}},
+		}, Async)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if results[0].Err == nil || len(results[0].ServiceIds) != 0 || len(info.ServiceIds) != 0 {
+			t.Errorf("%#v %#v", results[0], info)
+		}
+		if len(sink.received) != 0 {
+			t.Errorf("%#v", sink.received)
+		}
+	})
+
+	t.Run("rate limited", func(t *testing.T) {
+		ctl, sink := newConnector(t)
+		ctl.SetRateLimits(RateLimits{Device: connectionlimit.NewRateLimiter("device", connectionlimit.RateLimit{Rate: 0.001, Burst: 2}, slog.Default())})
+		_, results, err := ctl.HandleDeviceEventBatchCtx(context.Background(), token, "l1", []EventBatchItem{
+			{ServiceUri: "sl1", Msg: EventMsg{"data": "1"}},
+			{ServiceUri: "sl1", Msg: EventMsg{"data": "2"}},
+			{ServiceUri: "sl1", Msg: EventMsg{"data": "3"}},
+		}, Async)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if results[0].Err != nil || results[1].Err != nil {
+			t.Error(results[0].Err, results[1].Err)
+		}
+		if !errors.Is(results[2].Err, ErrRateLimited) {
+			t.Error(results[2].Err)
+		}
+		if len(sink.received) != 2 {
+			t.Errorf("%#v", sink.received)
+		}
+	})
+
+	t.Run("verification failure", func(t *testing.T) {
+		ctl, sink := newConnector(t)
+		other, _ := rsa.GenerateKey(rand.Reader, 2048)
+		ctl.tokenVerifier, err = newTokenVerifier(Config{JwtVerify: true, JwtPublicKey: base64.StdEncoding.EncodeToString(x509.MarshalPKCS1PublicKey(&other.PublicKey))})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, results, err := ctl.HandleDeviceEventBatchCtx(context.Background(), token, "l1", []EventBatchItem{
+			{ServiceUri: "sl1", Msg: EventMsg{"data": "1"}},
+		}, Async)
+		if !errors.Is(err, security.ErrorAccessDenied) {
+			t.Error(err)
+		}
+		if results != nil || len(sink.received) != 0 {
+			t.Errorf("%#v %#v", results, sink.received)
+		}
+	})
+}
@@ -0,0 +1,122 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package platform_connector_lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/SENERGY-Platform/platform-connector-lib/httpevent"
+	"github.com/SENERGY-Platform/platform-connector-lib/iot"
+	"github.com/SENERGY-Platform/platform-connector-lib/model"
+	"github.com/SENERGY-Platform/platform-connector-lib/security"
+)
+
+var errUnauthenticated = errors.New("unauthenticated")
+var errAuthUnavailable = errors.New("authentication unavailable")
+
+// StartEventIngestion starts the http/websocket event server (see httpevent.Start), if Config.EventIngestionPort is set
+func (this *Connector) StartEventIngestion(ctx context.Context) error {
+	if !isSet(this.Config.EventIngestionPort) {
+		return nil
+	}
+	ctx, stop := context.WithCancel(ctx)
+	this.shutdownMux.Lock()
+	this.stopEventIngestion = stop
+	this.shutdownMux.Unlock()
+	return httpevent.Start(ctx, httpevent.Config{
+		Port:         this.Config.EventIngestionPort,
+		Logger:       this.Config.GetLogger(),
+		TlsCertFile:  getOptional(this.Config.EventIngestionTlsCert),
+		TlsKeyFile:   getOptional(this.Config.EventIngestionTlsKey),
+		ErrorStatus:  getEventIngestionErrorStatus,
+		Authenticate: this.authenticateIngestedEvent,
+		ErrorClass: func(err error) string {
+			class, _ := getDeadLetterErrorClass(err)
+			return string(class)
+		},
+	}, this.handleIngestedEvent, func(err error) {
+		this.fatal(&FatalError{Source: FatalEventIngestionServer, Topic: this.Config.EventIngestionPort, Err: err, Retry: func(retryCtx context.Context) error {
+			if ctx.Err() != nil {
+				return nil //server has been stopped
+			}
+			return this.StartEventIngestion(ctx)
+		}})
+	})
+}
+
+// authenticateIngestedEvent validates bearer tokens or exchanges basic auth credentials for a token;
+// websocket connections reuse the result until the token expires
+func (this *Connector) authenticateIngestedEvent(ctx context.Context, auth httpevent.Auth, remoteAddr string) (result httpevent.Auth, err error) {
+	token := security.JwtToken(auth.Token)
+	if token != "" {
+		_, err = this.validateToken(token)
+	} else {
+		remoteInfo := model.RemoteInfo{Protocol: "http"}
+		remoteInfo.Ip, remoteInfo.Port, _ = net.SplitHostPort(remoteAddr)
+		token, err = this.getUserToken(ctx, auth.Username, auth.Password, remoteInfo)
+	}
+	//unauthenticated requests are not sent as dead letter
+	if errors.Is(err, security.ErrorAccessDenied) || errors.Is(err, security.ErrInvalidToken) {
+		return result, rejected(DeadLetterAuth, errors.Join(errUnauthenticated, err))
+	}
+	if err != nil {
+		return result, fmt.Errorf("%w: %w", errAuthUnavailable, err)
+	}
+	exp := struct {
+		Exp int64 `json:"exp"`
+	}{}
+	if security.GetJWTPayload(string(token), &exp) == nil && exp.Exp > 0 {
+		result.Expiration = time.Unix(exp.Exp, 0)
+	}
+	result.Token = string(token)
+	return result, nil
+}
+
+// handleIngestedEvent expects events authenticated by authenticateIngestedEvent
+func (this *Connector) handleIngestedEvent(ctx context.Context, event httpevent.Event) (info any, err error) {
+	if event.Auth.Token == "" {
+		return nil, rejected(DeadLetterAuth, errUnauthenticated)
+	}
+	return this.HandleDeviceRefEventWithAuthTokenCtx(ctx, security.JwtToken(event.Auth.Token), event.DeviceLocalId, event.ServiceLocalId, event.Msg, Qos(event.Qos))
+}
+
+func getEventIngestionErrorStatus(err error) int {
+	class, _ := getDeadLetterErrorClass(err)
+	switch {
+	case class == DeadLetterAuth && (errors.Is(err, errUnauthenticated) || errors.Is(err, security.ErrInvalidToken)):
+		return http.StatusUnauthorized
+	case class == DeadLetterAuth:
+		return http.StatusForbidden
+	case class != "":
+		return http.StatusBadRequest
+	case errors.Is(err, security.ErrorNotFound), errors.Is(err, ErrorUnknownLocalServiceId):
+		return http.StatusNotFound
+	case errors.Is(err, ErrRateLimited):
+		return http.StatusTooManyRequests
+	case errors.Is(err, ErrShuttingDown), errors.Is(err, iot.ErrCircuitOpen), errors.Is(err, errAuthUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package platform_connector_lib
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/SENERGY-Platform/platform-connector-lib/httpevent"
+	"github.com/SENERGY-Platform/platform-connector-lib/security"
+)
+
+func TestEventIngestionAuth(t *testing.T) {
+	letters := atomic.Int64{}
+	deadLetters := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		letters.Add(1)
+	}))
+	defer deadLetters.Close()
+	auth := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		http.Error(writer, `{"error":"invalid_grant"}`, http.StatusUnauthorized)
+	}))
+	defer auth.Close()
+
+	for _, c := range []struct {
+		name         string
+		authEndpoint string
+		status       int
+	}{
+		{name: "invalid credentials", authEndpoint: auth.URL, status: http.StatusUnauthorized},
+		{name: "auth unavailable", authEndpoint: "http://localhost:0", status: http.StatusServiceUnavailable},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			sec, err := security.New(c.authEndpoint, "", "", "", "", 0, 0, 0, nil, 0, 0, slog.Default())
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctl := &Connector{Config: Config{DeadLetterTopic: deadLetters.URL}, security: sec}
+			_, err = ctl.authenticateIngestedEvent(context.Background(), httpevent.Auth{Username: "user", Password: "pw"}, "127.0.0.1:1234")
+			if status := getEventIngestionErrorStatus(err); status != c.status {
+				t.Error(status, err)
+			}
+			ctl.deadLetters.Wait()
+		})
+	}
+	if letters.Load() != 0 {
+		t.Error("unauthenticated request sent as dead letter")
+	}
+}
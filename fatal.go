@@ -0,0 +1,140 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package platform_connector_lib
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"runtime/debug"
+	"time"
+
+	"github.com/SENERGY-Platform/platform-connector-lib/statistics"
+)
+
+type FatalErrorSource string
+
+const (
+	FatalKafkaConsumer        FatalErrorSource = "kafka_consumer"
+	FatalKafkaProducer        FatalErrorSource = "kafka_producer"
+	FatalHttpCommandServer    FatalErrorSource = "http_command_server"
+	FatalGrpcCommandServer    FatalErrorSource = "grpc_command_server"
+	FatalEventIngestionServer FatalErrorSource = "event_ingestion_server"
+	FatalCommandResponse      FatalErrorSource = "command_response"
+	FatalCommandError         FatalErrorSource = "command_error"
+	FatalEventSink            FatalErrorSource = "event_sink"
+)
+
+// FatalError is passed to the FatalErrorHandler for errors the connector can not handle by itself
+type FatalError struct {
+	Source FatalErrorSource
+	Topic  string //optional; kafka topic, http port or sink name
+	Err    error
+
+	// Retry is set for recoverable errors (e.g. restarting a stopped kafka consumer).
+	// may be called repeatedly, until it returns nil.
+	Retry func(ctx context.Context) error
+}
+
+func (this *FatalError) Error() string {
+	if this.Topic == "" {
+		return string(this.Source) + ": " + this.Err.Error()
+	}
+	return string(this.Source) + " (" + this.Topic + "): " + this.Err.Error()
+}
+
+func (this *FatalError) Unwrap() error {
+	return this.Err
+}
+
+// FatalErrorHandler must not block
+type FatalErrorHandler func(err *FatalError)
+
+// SetFatalErrorHandler replaces the default handler ExitOnFatalError; must be called before Start()
+func (this *Connector) SetFatalErrorHandler(handler FatalErrorHandler) *Connector {
+	this.fatalErrorHandler = handler
+	return this
+}
+
+// ExitOnFatalError is the default FatalErrorHandler and exits the process
+func ExitOnFatalError(err *FatalError) {
+	log.Fatal("FATAL: ", err)
+}
+
+type Backoff struct {
+	Initial    time.Duration //default 1s
+	Max        time.Duration //default 1m
+	MaxRetries int           //0 means unlimited
+}
+
+// RetryOnFatalError calls FatalError.Retry with exponential backoff until it succeeds or ctx is done.
+// errors without Retry and errors which still fail after Backoff.MaxRetries are passed to fallback; if fallback is nil, they are only logged.
+func RetryOnFatalError(ctx context.Context, backoff Backoff, fallback FatalErrorHandler) FatalErrorHandler {
+	if backoff.Initial <= 0 {
+		backoff.Initial = time.Second
+	}
+	if backoff.Max <= 0 {
+		backoff.Max = time.Minute
+	}
+	if fallback == nil {
+		fallback = func(err *FatalError) {
+			slog.Default().Error("unable to recover from fatal error", "error", err)
+		}
+	}
+	return func(err *FatalError) {
+		if err.Retry == nil {
+			fallback(err)
+			return
+		}
+		go func() {
+			wait := backoff.Initial
+			for i := 0; backoff.MaxRetries <= 0 || i < backoff.MaxRetries; i++ {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(wait):
+				}
+				retryErr := err.Retry(ctx)
+				if retryErr == nil {
+					slog.Default().Info("recovered from fatal error", "error", err, "retries", i+1)
+					return
+				}
+				slog.Default().Warn("unable to recover from fatal error; retry", "error", err, "retry-error", retryErr, "wait", wait)
+				wait = min(wait*2, backoff.Max)
+			}
+			fallback(err)
+		}()
+	}
+}
+
+func (this *Connector) fatal(err *FatalError) {
+	statistics.FatalError(string(err.Source))
+	if this.isShuttingDown() {
+		//e.g. undelivered messages of closed producers or stopped servers
+		this.Config.GetLogger().Warn("ignore fatal error during shutdown", "error", err, "source", err.Source)
+		return
+	}
+	this.Config.GetLogger().Error("FATAL ERROR", "error", err, "source", err.Source, "recoverable", err.Retry != nil)
+	if this.Config.Debug {
+		debug.PrintStack()
+	}
+	if this.fatalErrorHandler == nil {
+		ExitOnFatalError(err)
+		return
+	}
+	this.fatalErrorHandler(err)
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package platform_connector_lib
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SENERGY-Platform/platform-connector-lib/model"
+)
+
+func TestRetryOnFatalError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fallbacks := make(chan *FatalError, 10)
+	handler := RetryOnFatalError(ctx, Backoff{Initial: 10 * time.Millisecond, MaxRetries: 3}, func(err *FatalError) {
+		fallbacks <- err
+	})
+
+	recovering := atomic.Int64{}
+	handler(&FatalError{Source: FatalKafkaConsumer, Err: errors.New("test"), Retry: func(ctx context.Context) error {
+		if recovering.Add(1) < 2 {
+			return errors.New("still failing")
+		}
+		return nil
+	}})
+
+	failing := atomic.Int64{}
+	handler(&FatalError{Source: FatalKafkaConsumer, Err: errors.New("test"), Retry: func(ctx context.Context) error {
+		failing.Add(1)
+		return errors.New("still failing")
+	}})
+
+	handler(&FatalError{Source: FatalEventSink, Err: errors.New("not recoverable")})
+
+	time.Sleep(300 * time.Millisecond)
+	if recovering.Load() != 2 {
+		t.Error(recovering.Load())
+	}
+	if failing.Load() != 3 {
+		t.Error(failing.Load())
+	}
+	if len(fallbacks) != 2 {
+		t.Error(len(fallbacks))
+	}
+}
+
+func TestSinkErrorFatalUsesHandler(t *testing.T) {
+	received := []*FatalError{}
+	ctl := &Connector{}
+	ctl.SetFatalErrorHandler(func(err *FatalError) {
+		received = append(received, err)
+	})
+	ctl.AddEventSink(&SinkMock{name: "failing", err: errors.New("test")}, SinkOptions{ErrorPolicy: SinkErrorFatal})
+	errs := ctl.sendToSinks(context.Background(), []SinkEvent{{Envelope: model.Envelope{DeviceId: "d"}}})
+	if errs[0] == nil {
+		t.Error("missing error")
+	}
+	if len(received) != 1 || received[0].Source != FatalEventSink || received[0].Topic != "failing" {
+		t.Error(received)
+	}
+}
@@ -0,0 +1,289 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grpccommand
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/SENERGY-Platform/platform-connector-lib/model"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+const ServiceName = "senergy.connector.CommandTransport"
+const MethodName = "Connect"
+
+// FullMethodName is used by clients to open the stream
+const FullMethodName = "/" + ServiceName + "/" + MethodName
+
+// ResponseTo marks commands received by grpc; responses and errors to commands with this Metadata.ResponseTo/ErrorTo are sent over the stream.
+// StreamResponseTo() adds the id of the stream which received the command.
+const ResponseTo = "grpc"
+
+var ErrNotConnected = errors.New("no grpc command stream connected")
+
+// StreamResponseTo returns the Metadata.ResponseTo/ErrorTo value, which routes responses to the stream
+func StreamResponseTo(streamId string) string {
+	return ResponseTo + ":" + streamId
+}
+
+// IsResponseTo returns true if responses to the topic are sent over a grpc stream
+func IsResponseTo(topic string) bool {
+	return topic == ResponseTo || strings.HasPrefix(topic, ResponseTo+":")
+}
+
+// Message is exchanged in both directions of the Connect stream; exactly one field is set
+type Message struct {
+	Command  json.RawMessage `json:"command,omitempty"`  //client -> connector; model.ProtocolMsg
+	Response json.RawMessage `json:"response,omitempty"` //connector -> client; model.ProtocolMsg with Response.Output
+	Error    json.RawMessage `json:"error,omitempty"`    //connector -> client; model.ProtocolMsg with Response.Output["error"]
+	Event    *model.Envelope `json:"event,omitempty"`    //connector -> client
+}
+
+type Config struct {
+	Port   string
+	Logger *slog.Logger
+
+	TlsCertFile     string //optional; enables tls
+	TlsKeyFile      string //optional; required with TlsCertFile
+	TlsClientCaFile string //optional; enables mTLS; clients must present a certificate signed by one of the CAs
+}
+
+// Server accepts Connect streams of clients (e.g. a platform gateway);
+// commands may be sent by any client, responses and errors are sent back over the stream of the command,
+// events are sent to the latest connected client
+type Server struct {
+	config   Config
+	logger   *slog.Logger
+	mux      sync.Mutex
+	streams  []*stream
+	streamId uint64
+	server   *grpc.Server //nil if not started or stopped
+	listen   net.Listener
+}
+
+type stream struct {
+	grpc.ServerStream
+	id      string
+	sendMux sync.Mutex
+}
+
+func (this *stream) send(msg Message) error {
+	this.sendMux.Lock()
+	defer this.sendMux.Unlock()
+	return this.SendMsg(&msg)
+}
+
+func New(config Config) *Server {
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Server{config: config, logger: logger}
+}
+
+// Start serves until ctx is done; calls errorhandler if the server stops unexpectedly (e.g. because the port is in use).
+// listener receives the commands and the id of the stream which received them.
+// Start may be called again (e.g. to retry after an error); a previously started server is stopped.
+func (this *Server) Start(ctx context.Context, listener func(streamId string, msg []byte) error, errorhandler func(err error)) error {
+	options := []grpc.ServerOption{grpc.ForceServerCodec(Codec{})}
+	tlsConfig, err := getTlsConfig(this.config)
+	if err != nil {
+		return err
+	}
+	if tlsConfig != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	server := grpc.NewServer(options...)
+	server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: ServiceName,
+		HandlerType: (*any)(nil),
+		Streams: []grpc.StreamDesc{{
+			StreamName:    MethodName,
+			ServerStreams: true,
+			ClientStreams: true,
+			Handler: func(_ any, serverStream grpc.ServerStream) error {
+				return this.handleStream(serverStream, listener)
+			},
+		}},
+	}, nil)
+	this.Stop()
+	listen, err := net.Listen("tcp", ":"+this.config.Port)
+	if err != nil {
+		return err
+	}
+	this.mux.Lock()
+	this.server = server
+	this.listen = listen
+	this.mux.Unlock()
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		this.logger.Info("starting grpc command consumer server", "addr", listen.Addr().String(), "tls", tlsConfig != nil)
+		err := server.Serve(listen)
+		this.mux.Lock()
+		if this.server == server {
+			this.server = nil
+			this.listen = nil
+		}
+		this.mux.Unlock()
+		if err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			this.logger.Error("grpc command consumer server error", "error", err)
+			server.Stop() //close remaining streams before a retry starts a new server
+			errorhandler(err)
+			return
+		}
+		this.logger.Info("grpc command consumer server closed")
+	}()
+	go func() {
+		select {
+		case <-ctx.Done():
+			this.logger.Info("shutting down grpc command consumer server")
+			server.GracefulStop()
+		case <-served: //stopped or failed; a retry starts a new server
+		}
+	}()
+	return nil
+}
+
+// Stop closes the server and all connected streams immediately; pending sends fail
+func (this *Server) Stop() {
+	this.mux.Lock()
+	server := this.server
+	listen := this.listen
+	this.server = nil
+	this.listen = nil
+	this.mux.Unlock()
+	if server != nil {
+		this.logger.Info("stop grpc command consumer server")
+		server.Stop()
+		_ = listen.Close() //the port is released even if Serve has not been called yet
+	}
+}
+
+func (this *Server) handleStream(serverStream grpc.ServerStream, listener func(streamId string, msg []byte) error) error {
+	this.mux.Lock()
+	this.streamId++
+	s := &stream{ServerStream: serverStream, id: strconv.FormatUint(this.streamId, 10)}
+	this.streams = append(this.streams, s)
+	this.mux.Unlock()
+	defer func() {
+		this.mux.Lock()
+		defer this.mux.Unlock()
+		for i, e := range this.streams {
+			if e == s {
+				this.streams = append(this.streams[:i], this.streams[i+1:]...)
+				break
+			}
+		}
+	}()
+	for {
+		msg := Message{}
+		err := serverStream.RecvMsg(&msg)
+		if err != nil {
+			if serverStream.Context().Err() == nil && !errors.Is(err, context.Canceled) {
+				this.logger.Info("grpc command stream closed", "reason", err)
+			}
+			return nil
+		}
+		if len(msg.Command) == 0 {
+			this.logger.Warn("ignore grpc message without command")
+			continue
+		}
+		err = listener(s.id, msg.Command)
+		if err != nil {
+			this.logger.Error("unable to handle grpc command message", "error", err)
+		}
+	}
+}
+
+// Send sends the message to the latest connected client
+func (this *Server) Send(msg Message) error {
+	this.mux.Lock()
+	if len(this.streams) == 0 {
+		this.mux.Unlock()
+		return ErrNotConnected
+	}
+	s := this.streams[len(this.streams)-1]
+	this.mux.Unlock()
+	return s.send(msg)
+}
+
+// SendTo sends the message to the stream referenced by responseTo (see StreamResponseTo());
+// returns ErrNotConnected if the stream is closed. responseTo without stream id is handled by Send.
+func (this *Server) SendTo(responseTo string, msg Message) error {
+	streamId, ok := strings.CutPrefix(responseTo, ResponseTo+":")
+	if !ok {
+		return this.Send(msg)
+	}
+	this.mux.Lock()
+	var target *stream
+	for _, s := range this.streams {
+		if s.id == streamId {
+			target = s
+			break
+		}
+	}
+	this.mux.Unlock()
+	if target == nil {
+		return ErrNotConnected
+	}
+	return target.send(msg)
+}
+
+// Connected returns the number of connected clients
+func (this *Server) Connected() int {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	return len(this.streams)
+}
+
+func getTlsConfig(config Config) (result *tls.Config, err error) {
+	if config.TlsCertFile == "" {
+		if config.TlsClientCaFile != "" {
+			return nil, errors.New("TlsClientCaFile requires TlsCertFile and TlsKeyFile")
+		}
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(config.TlsCertFile, config.TlsKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	result = &tls.Config{MinVersion: tls.VersionTLS12, Certificates: []tls.Certificate{cert}}
+	if config.TlsClientCaFile != "" {
+		ca, err := os.ReadFile(config.TlsClientCaFile)
+		if err != nil {
+			return nil, err
+		}
+		result.ClientCAs = x509.NewCertPool()
+		if !result.ClientCAs.AppendCertsFromPEM(ca) {
+			return nil, errors.New("unable to parse TlsClientCaFile")
+		}
+		result.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return result, nil
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package platform_connector_lib
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/SENERGY-Platform/platform-connector-lib/grpccommand"
+	"github.com/SENERGY-Platform/platform-connector-lib/model"
+)
+
+const GrpcSinkName = "grpc"
+
+func (this *Connector) startGrpcCommandConsumer(ctx context.Context) error {
+	return this.grpcServer.Start(ctx, this.handleGrpcCommand, func(err error) {
+		this.fatal(&FatalError{Source: FatalGrpcCommandServer, Topic: this.Config.GrpcCommandConsumerPort, Err: err, Retry: func(retryCtx context.Context) error {
+			if ctx.Err() != nil {
+				return nil //consumer has been stopped
+			}
+			return this.startGrpcCommandConsumer(ctx)
+		}})
+	})
+}
+
+// handleGrpcCommand routes responses and errors back over the receiving grpc stream, if the command has no own ResponseTo/ErrorTo
+func (this *Connector) handleGrpcCommand(streamId string, msg []byte) error {
+	protocolmsg := model.ProtocolMsg{}
+	err := json.Unmarshal(msg, &protocolmsg)
+	if err != nil {
+		return this.handleCommand(msg, time.Now()) //invalid message is handled by handleCommand
+	}
+	if protocolmsg.Metadata.ResponseTo == "" {
+		protocolmsg.Metadata.ResponseTo = grpccommand.StreamResponseTo(streamId)
+	}
+	if protocolmsg.Metadata.ErrorTo == "" {
+		protocolmsg.Metadata.ErrorTo = grpccommand.StreamResponseTo(streamId)
+	}
+	msg, err = json.Marshal(protocolmsg)
+	if err != nil {
+		return err
+	}
+	return this.handleCommand(msg, time.Now())
+}
+
+// GrpcSink sends envelopes to the client connected to the grpc command server
+type GrpcSink struct {
+	server *grpccommand.Server
+}
+
+func NewGrpcSink(server *grpccommand.Server) *GrpcSink {
+	return &GrpcSink{server: server}
+}
+
+func (this *GrpcSink) Name() string {
+	return GrpcSinkName
+}
+
+func (this *GrpcSink) Send(ctx context.Context, info EventInfo, envelope model.Envelope) error {
+	return this.server.Send(grpccommand.Message{Event: &envelope})
+}
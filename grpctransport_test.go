@@ -0,0 +1,166 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package platform_connector_lib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/SENERGY-Platform/platform-connector-lib/grpccommand"
+	"github.com/SENERGY-Platform/platform-connector-lib/model"
+	"github.com/SENERGY-Platform/platform-connector-lib/security"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestGrpcCommand(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+	listener.Close()
+
+	sec, err := security.New("http://localhost:0", "", "", "", "", 0, 0, 0, nil, 0, 0, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctl := &Connector{security: sec, grpcServer: grpccommand.New(grpccommand.Config{Port: port})} //responses are not sent as events, because no token is available
+	ctl.Config.GetLogger()
+	ctl.SetDeviceCommandHandler(func(deviceId string, deviceUri string, serviceId string, serviceUri string, requestMsg CommandRequestMsg) (responseMsg CommandResponseMsg, qos Qos, err error) {
+		return CommandResponseMsg{"device": deviceId}, Sync, nil
+	})
+	err = ctl.startGrpcCommandConsumer(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := grpc.NewClient("localhost:"+port, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true, ClientStreams: true}, grpccommand.FullMethodName, grpc.ForceCodec(grpccommand.Codec{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	connect := func(stream grpc.ClientStream, expected int) {
+		err = stream.SendMsg(&grpccommand.Message{}) //registers the stream at the server
+		if err != nil {
+			t.Fatal(err)
+		}
+		for ctl.grpcServer.Connected() != expected {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	connect(stream, 1)
+
+	//a later connected client must not receive the response
+	latest, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true, ClientStreams: true}, grpccommand.FullMethodName, grpc.ForceCodec(grpccommand.Codec{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	connect(latest, 2)
+	command, _ := json.Marshal(model.ProtocolMsg{Metadata: model.Metadata{Device: model.Device{Id: "d1"}}})
+	err = stream.SendMsg(&grpccommand.Message{Command: command})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := grpccommand.Message{}
+	err = stream.RecvMsg(&msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := model.ProtocolMsg{}
+	err = json.Unmarshal(msg.Response, &response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Response.Output["device"] != "d1" || !grpccommand.IsResponseTo(response.Metadata.ResponseTo) {
+		t.Errorf("%#v", response)
+	}
+
+	err = NewGrpcSink(ctl.grpcServer).Send(ctx, EventInfo{}, model.Envelope{DeviceId: "d1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg = grpccommand.Message{}
+	err = latest.RecvMsg(&msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Event == nil || msg.Event.DeviceId != "d1" {
+		t.Errorf("%#v", msg)
+	}
+
+	err = ctl.grpcServer.SendTo(grpccommand.StreamResponseTo("unknown"), grpccommand.Message{Response: command})
+	if !errors.Is(err, grpccommand.ErrNotConnected) {
+		t.Error(err)
+	}
+}
+
+func TestGrpcCommandRestart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+	listener.Close()
+
+	server := grpccommand.New(grpccommand.Config{Port: port})
+	defer server.Stop()
+	handler := func(streamId string, msg []byte) error { return nil }
+	errorhandler := func(err error) { t.Error(err) }
+	err = server.Start(ctx, handler, errorhandler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//a retry replaces the running server instead of failing on the used port
+	err = server.Start(ctx, handler, errorhandler)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := grpc.NewClient("localhost:"+port, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true, ClientStreams: true}, grpccommand.FullMethodName, grpc.ForceCodec(grpccommand.Codec{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = stream.SendMsg(&grpccommand.Message{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for server.Connected() != 1 {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
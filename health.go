@@ -0,0 +1,200 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package platform_connector_lib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/SENERGY-Platform/platform-connector-lib/iot"
+	"github.com/SENERGY-Platform/platform-connector-lib/kafka"
+	"github.com/SENERGY-Platform/platform-connector-lib/security"
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+const (
+	HealthKafka            = "kafka"
+	HealthPostgres         = "postgres"
+	HealthDeviceRepository = "device-repository"
+	HealthAuth             = "auth"
+	HealthMemcached        = "memcached"
+	HealthKafkaConsumer    = "kafka-consumer:" //prefix of the consumed topic
+	HealthCircuitBreaker   = "device-repository-circuit-breaker"
+)
+
+var HealthTimeout = 5 * time.Second
+
+type HealthStatus struct {
+	Healthy      bool                        `json:"healthy"`
+	Time         time.Time                   `json:"time"`
+	Dependencies map[string]DependencyHealth `json:"dependencies"`
+}
+
+type DependencyHealth struct {
+	Healthy       bool       `json:"healthy"`
+	LatencyMs     int64      `json:"latency_ms"`
+	Error         string     `json:"error,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastErrorTime *time.Time `json:"last_error_time,omitempty"`
+}
+
+type healthError struct {
+	err  string
+	time time.Time
+}
+
+// Health checks all configured dependencies in parallel; ctx without deadline is limited by HealthTimeout
+func (this *Connector) Health(ctx context.Context) (result HealthStatus) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, HealthTimeout)
+		defer cancel()
+	}
+	checks := this.getHealthChecks()
+	result = HealthStatus{Healthy: true, Time: time.Now(), Dependencies: map[string]DependencyHealth{}}
+	mux := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	this.healthMux.Lock()
+	if this.healthErrors == nil {
+		this.healthErrors = map[string]healthError{}
+	}
+	this.healthMux.Unlock()
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			var err error
+			if !waitCtx(ctx, func() { err = check(ctx) }) {
+				err = ctx.Err()
+			}
+			health := DependencyHealth{Healthy: err == nil, LatencyMs: time.Since(start).Milliseconds()}
+			if err != nil {
+				health.Error = this.removeSecretsFromString(err.Error())
+			}
+			this.healthMux.Lock()
+			if err != nil {
+				this.healthErrors[name] = healthError{err: health.Error, time: time.Now()}
+			}
+			if last, ok := this.healthErrors[name]; ok {
+				health.LastError = last.err
+				health.LastErrorTime = &last.time
+			}
+			this.healthMux.Unlock()
+			mux.Lock()
+			defer mux.Unlock()
+			result.Healthy = result.Healthy && health.Healthy
+			result.Dependencies[name] = health
+		}()
+	}
+	wg.Wait()
+	for topic, state := range this.ConsumerStates() {
+		health := DependencyHealth{Healthy: state == kafka.ConsumerRunning}
+		if !health.Healthy {
+			health.Error = "consumer " + string(state)
+			result.Healthy = false
+		}
+		result.Dependencies[HealthKafkaConsumer+topic] = health
+	}
+	if this.Config.IotCircuitBreakerThreshold > 0 {
+		state := this.iot.CircuitBreakerState()
+		health := DependencyHealth{Healthy: state != iot.CircuitOpen}
+		if state != iot.CircuitClosed {
+			health.Error = "circuit breaker " + string(state)
+		}
+		result.Healthy = result.Healthy && health.Healthy
+		result.Dependencies[HealthCircuitBreaker] = health
+	}
+	return result
+}
+
+// HealthHandler responds with the json encoded HealthStatus; the status code is 503 if a dependency is unhealthy
+func (this *Connector) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		health := this.Health(request.Context())
+		writer.Header().Set("Content-Type", "application/json")
+		if !health.Healthy {
+			writer.WriteHeader(http.StatusServiceUnavailable)
+		}
+		err := json.NewEncoder(writer).Encode(health)
+		if err != nil {
+			this.Config.GetLogger().Error("unable to encode health status", "error", err)
+		}
+	})
+}
+
+func (this *Connector) getHealthChecks() (checks map[string]func(ctx context.Context) error) {
+	checks = map[string]func(ctx context.Context) error{}
+	if isSet(this.Config.KafkaUrl) {
+		checks[HealthKafka] = func(ctx context.Context) error {
+			return kafka.Ping(ctx, this.Config.KafkaUrl)
+		}
+	}
+	if this.postgresPublisher != nil {
+		checks[HealthPostgres] = this.postgresPublisher.Ping
+	}
+	if isSet(this.Config.DeviceRepoUrl) {
+		checks[HealthDeviceRepository] = func(ctx context.Context) error {
+			return pingHttp(ctx, this.Config.DeviceRepoUrl)
+		}
+	}
+	//offline or custom security implementations do not use the auth endpoint
+	if _, ok := this.security.(*security.Security); ok && isSet(this.Config.AuthEndpoint) {
+		checks[HealthAuth] = func(ctx context.Context) error {
+			return pingHttp(ctx, this.Config.AuthEndpoint+"/auth/realms/master/.well-known/openid-configuration")
+		}
+	}
+	if len(this.Config.IotCacheUrl) > 0 {
+		checks[HealthMemcached] = func(ctx context.Context) error {
+			return this.getHealthMemcache().Ping()
+		}
+	}
+	return checks
+}
+
+// getHealthMemcache returns the memcached client of the health check; the client is reused to keep its connections
+func (this *Connector) getHealthMemcache() *memcache.Client {
+	this.healthMux.Lock()
+	defer this.healthMux.Unlock()
+	if this.healthMemcache == nil {
+		this.healthMemcache = memcache.New(this.Config.IotCacheUrl...)
+		this.healthMemcache.Timeout = HealthTimeout
+	}
+	return this.healthMemcache
+}
+
+// pingHttp expects any response without server error
+func pingHttp(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return errors.New("unexpected status " + strconv.Itoa(resp.StatusCode))
+	}
+	return nil
+}
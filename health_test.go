@@ -0,0 +1,93 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package platform_connector_lib
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SENERGY-Platform/platform-connector-lib/security"
+	"github.com/SENERGY-Platform/platform-connector-lib/statistics"
+)
+
+func TestHealth(t *testing.T) {
+	repo := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		http.Error(writer, "not found", http.StatusNotFound)
+	}))
+	defer repo.Close()
+	auth := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		http.Error(writer, "unavailable", http.StatusBadGateway)
+	}))
+	defer auth.Close()
+
+	sec, err := security.New(auth.URL, "", "", "", "", 0, 0, 0, nil, 0, 0, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctl := &Connector{Config: Config{DeviceRepoUrl: repo.URL, AuthEndpoint: auth.URL, KafkaUrl: "-"}, security: sec}
+
+	health := ctl.Health(context.Background())
+	if health.Healthy || len(health.Dependencies) != 2 {
+		t.Errorf("%#v", health)
+	}
+	if !health.Dependencies[HealthDeviceRepository].Healthy {
+		t.Errorf("%#v", health.Dependencies[HealthDeviceRepository])
+	}
+	if health.Dependencies[HealthAuth].Healthy || health.Dependencies[HealthAuth].Error == "" || health.Dependencies[HealthAuth].LastErrorTime == nil {
+		t.Errorf("%#v", health.Dependencies[HealthAuth])
+	}
+
+	recorder := httptest.NewRecorder()
+	ctl.HealthHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Error(recorder.Code)
+	}
+	result := HealthStatus{}
+	err = json.Unmarshal(recorder.Body.Bytes(), &result)
+	if err != nil {
+		t.Error(err)
+	}
+	if result.Dependencies[HealthAuth].LastError == "" {
+		t.Errorf("%#v", result)
+	}
+
+	//the auth endpoint is not used by offline security
+	ctl.security, err = security.NewOfflineFromUsers(security.StaticUsers{Client: "connector", Users: []security.StaticUser{{Id: "c1", Username: "connector"}}}, "", "", 0, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	health = ctl.Health(context.Background())
+	if _, ok := health.Dependencies[HealthAuth]; ok || !health.Healthy {
+		t.Errorf("%#v", health)
+	}
+}
+
+func TestHealthEndpointRegistration(t *testing.T) {
+	first := &Connector{}
+	second := &Connector{}
+	statistics.Handle("/test-health", first.HealthHandler())
+	statistics.Handle("/test-health", second.HealthHandler()) //must not panic
+	recorder := httptest.NewRecorder()
+	http.DefaultServeMux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/test-health", nil))
+	if recorder.Code != http.StatusOK {
+		t.Error(recorder.Code, recorder.Body.String())
+	}
+}
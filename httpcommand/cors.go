@@ -16,18 +16,35 @@
 
 package httpcommand
 
-import "net/http"
+import (
+	"net/http"
+	"slices"
+)
 
 func NewCors(handler http.Handler) *CorsMiddleware {
-	return &CorsMiddleware{handler: handler}
+	return NewCorsWithOrigins(handler, []string{"*"})
+}
+
+// NewCorsWithOrigins allows requests from the origins; "*" allows every origin
+func NewCorsWithOrigins(handler http.Handler, origins []string) *CorsMiddleware {
+	return &CorsMiddleware{handler: handler, origins: origins}
 }
 
 type CorsMiddleware struct {
 	handler http.Handler
+	origins []string
 }
 
 func (this *CorsMiddleware) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 	origin := req.Header.Get("Origin")
+	if !slices.Contains(this.origins, "*") && !slices.Contains(this.origins, origin) {
+		if req.Method == "OPTIONS" {
+			http.Error(res, "origin not allowed", http.StatusForbidden)
+		} else {
+			this.handler.ServeHTTP(res, req)
+		}
+		return
+	}
 	if origin == "" {
 		origin = "*"
 	}
@@ -18,46 +18,142 @@ package httpcommand
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"io"
 	"log"
 	"log/slog"
 	"net/http"
+	"os"
 	"strings"
 	"time"
 )
 
+type Config struct {
+	Port   string
+	Logger *slog.Logger
+
+	Authenticate func(request *http.Request) error //optional; requests are rejected with 401 if an error is returned
+
+	TlsCertFile     string //optional; enables https
+	TlsKeyFile      string //optional; required with TlsCertFile
+	TlsClientCaFile string //optional; enables mTLS; clients must present a certificate signed by one of the CAs
+
+	CorsOrigins []string //optional; "*" allows every origin; no cors headers are set if empty
+
+	ReadTimeout time.Duration //optional; default 10s
+	SyncTimeout time.Duration //optional; max wait for the response of a synchronous command; default 10s
+
+	ErrorStatus func(err error) int //optional; maps listener errors to http status codes; default 400
+}
+
+// Listener handles the command msg; in synchronous mode (query parameter sync=true) the response is written as http body
+type Listener func(ctx context.Context, msg []byte, sync bool) (response []byte, err error)
+
 func StartConsumer(ctx context.Context, slogger *slog.Logger, port string, listener func(msg []byte) error) error {
-	router := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
-		if request.Method == http.MethodPost && strings.TrimPrefix(request.URL.Path, "/") == "commands" {
-			msg, err := io.ReadAll(request.Body)
-			if err != nil {
-				slogger.Error("unable to read http command message", "error", err)
-				http.Error(writer, err.Error(), http.StatusBadRequest)
-				return
-			}
-			err = listener(msg)
+	return StartConsumerWithErrorHandler(ctx, slogger, port, listener, func(err error) {
+		log.Fatal(err)
+	})
+}
+
+// StartConsumerWithErrorHandler calls errorhandler if the server stops unexpectedly (e.g. because the port is in use)
+func StartConsumerWithErrorHandler(ctx context.Context, slogger *slog.Logger, port string, listener func(msg []byte) error, errorhandler func(err error)) error {
+	return Start(ctx, Config{Port: port, Logger: slogger, CorsOrigins: []string{"*"}}, func(ctx context.Context, msg []byte, sync bool) (response []byte, err error) {
+		if sync {
+			return nil, ErrSyncNotSupported
+		}
+		return nil, listener(msg)
+	}, errorhandler)
+}
+
+var ErrSyncNotSupported = errors.New("synchronous commands are not supported")
+
+// Start calls errorhandler if the server stops unexpectedly (e.g. because the port is in use)
+func Start(ctx context.Context, config Config, listener Listener, errorhandler func(err error)) error {
+	slogger := config.Logger
+	if slogger == nil {
+		slogger = slog.Default()
+	}
+	if config.ReadTimeout <= 0 {
+		config.ReadTimeout = 10 * time.Second
+	}
+	if config.SyncTimeout <= 0 {
+		config.SyncTimeout = 10 * time.Second
+	}
+	if config.ErrorStatus == nil {
+		config.ErrorStatus = func(err error) int {
+			return http.StatusBadRequest
+		}
+	}
+	tlsConfig, err := getTlsConfig(config)
+	if err != nil {
+		return err
+	}
+	var handler http.Handler = http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method != http.MethodPost || strings.TrimPrefix(request.URL.Path, "/") != "commands" {
+			http.Error(writer, "unknown endpoint", http.StatusNotFound)
+			return
+		}
+		if config.Authenticate != nil {
+			err := config.Authenticate(request)
 			if err != nil {
-				slogger.Error("unable to handle http command message", "error", err)
-				http.Error(writer, err.Error(), http.StatusBadRequest)
+				slogger.Warn("reject unauthenticated http command", "error", err, "remote", request.RemoteAddr)
+				http.Error(writer, "unauthorized", http.StatusUnauthorized)
 				return
 			}
-			writer.WriteHeader(http.StatusOK)
+		}
+		msg, err := io.ReadAll(request.Body)
+		if err != nil {
+			slogger.Error("unable to read http command message", "error", err)
+			http.Error(writer, err.Error(), http.StatusBadRequest)
 			return
-		} else {
-			http.Error(writer, "unknown endpoint", http.StatusNotFound)
+		}
+		ctx := request.Context()
+		sync := request.URL.Query().Get("sync") == "true"
+		if sync {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, config.SyncTimeout)
+			defer cancel()
+		}
+		response, err := listener(ctx, msg, sync)
+		if err != nil {
+			slogger.Error("unable to handle http command message", "error", err)
+			http.Error(writer, err.Error(), config.ErrorStatus(err))
 			return
 		}
+		if response != nil {
+			writer.Header().Set("Content-Type", "application/json")
+			writer.WriteHeader(http.StatusOK)
+			_, _ = writer.Write(response)
+			return
+		}
+		writer.WriteHeader(http.StatusOK)
 	})
-	corsHandler := NewCors(router)
-	logger := NewLogger(corsHandler)
-	server := &http.Server{Addr: ":" + port, Handler: logger, WriteTimeout: 10 * time.Second, ReadTimeout: 10 * time.Second, ReadHeaderTimeout: 2 * time.Second}
+	if len(config.CorsOrigins) > 0 {
+		handler = NewCorsWithOrigins(handler, config.CorsOrigins)
+	}
+	handler = NewLogger(handler)
+	server := &http.Server{
+		Addr:              ":" + config.Port,
+		Handler:           handler,
+		TLSConfig:         tlsConfig,
+		WriteTimeout:      config.SyncTimeout + config.ReadTimeout,
+		ReadTimeout:       config.ReadTimeout,
+		ReadHeaderTimeout: 2 * time.Second,
+	}
 	go func() {
-		slogger.Info("starting http command consumer server", "addr", server.Addr)
-		if err := server.ListenAndServe(); err != nil {
+		slogger.Info("starting http command consumer server", "addr", server.Addr, "tls", tlsConfig != nil)
+		var err error
+		if tlsConfig != nil {
+			err = server.ListenAndServeTLS(config.TlsCertFile, config.TlsKeyFile)
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil {
 			if !errors.Is(err, http.ErrServerClosed) {
 				slogger.Error("http command consumer server error", "error", err)
-				log.Fatal(err)
+				errorhandler(err)
 			} else {
 				slogger.Info("http command consumer server closed")
 			}
@@ -69,3 +165,25 @@ func StartConsumer(ctx context.Context, slogger *slog.Logger, port string, liste
 	}()
 	return nil
 }
+
+func getTlsConfig(config Config) (result *tls.Config, err error) {
+	if config.TlsCertFile == "" {
+		if config.TlsClientCaFile != "" {
+			return nil, errors.New("TlsClientCaFile requires TlsCertFile and TlsKeyFile")
+		}
+		return nil, nil
+	}
+	result = &tls.Config{MinVersion: tls.VersionTLS12}
+	if config.TlsClientCaFile != "" {
+		ca, err := os.ReadFile(config.TlsClientCaFile)
+		if err != nil {
+			return nil, err
+		}
+		result.ClientCAs = x509.NewCertPool()
+		if !result.ClientCAs.AppendCertsFromPEM(ca) {
+			return nil, errors.New("unable to parse TlsClientCaFile")
+		}
+		result.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return result, nil
+}
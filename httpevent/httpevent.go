@@ -0,0 +1,309 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpevent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var ErrMissingCredentials = errors.New("missing basic auth or bearer token")
+
+type Config struct {
+	Port   string
+	Logger *slog.Logger
+
+	TlsCertFile string //optional; enables https
+	TlsKeyFile  string //optional; required with TlsCertFile
+
+	ReadTimeout     time.Duration //optional; default 10s; not applied to websocket connections
+	MaxMessageBytes int64         //optional; default 1MB
+
+	Authenticate func(ctx context.Context, auth Auth, remoteAddr string) (Auth, error) //optional; called per POST request and once per websocket connection (again after the returned Auth.Expiration); the returned Auth is passed to the listener
+
+	ErrorStatus func(err error) int    //optional; maps listener errors to http status codes; default 500
+	ErrorClass  func(err error) string //optional; adds a machine-readable class to errors
+}
+
+type Auth struct {
+	Username string
+	Password string
+	Token    string //"Bearer <jwt>"
+
+	Expiration time.Time //set by Config.Authenticate; websocket connections authenticate again after this time
+}
+
+type Event struct {
+	Auth           Auth
+	DeviceLocalId  string
+	ServiceLocalId string
+	Msg            map[string]string
+	Qos            int
+	RemoteAddr     string
+}
+
+// Listener handles a single event; info is returned to the client as json
+type Listener func(ctx context.Context, event Event) (info any, err error)
+
+// WebsocketMessage is sent by clients of the websocket endpoint; Id is optional and echoed in the Result
+type WebsocketMessage struct {
+	Id  string            `json:"id,omitempty"`
+	Msg map[string]string `json:"msg"`
+	Qos *int              `json:"qos,omitempty"` //optional; default is the qos query parameter of the connection
+}
+
+// Result is returned for every websocket message
+type Result struct {
+	Id    string `json:"id,omitempty"`
+	Info  any    `json:"info,omitempty"`
+	Error *Error `json:"error,omitempty"`
+}
+
+type Error struct {
+	Message string `json:"message"`
+	Class   string `json:"class,omitempty"`
+	Status  int    `json:"status"`
+}
+
+// Start serves
+//
+//	POST /events/{deviceLocalId}/{serviceLocalId}?qos=<0|1|2> with a json body like {"<protocol-segment>": "<value>"}
+//	GET  /events/{deviceLocalId}/{serviceLocalId}?qos=<0|1|2> as websocket, receiving WebsocketMessage and answering with Result
+//
+// until ctx is done; requests must be authenticated with basic auth or a bearer token.
+// errorhandler is called if the server stops unexpectedly (e.g. because the port is in use).
+func Start(ctx context.Context, config Config, listener Listener, errorhandler func(err error)) error {
+	if config.Logger == nil {
+		config.Logger = slog.Default()
+	}
+	if config.ReadTimeout <= 0 {
+		config.ReadTimeout = 10 * time.Second
+	}
+	if config.MaxMessageBytes <= 0 {
+		config.MaxMessageBytes = 1 << 20
+	}
+	if config.ErrorStatus == nil {
+		config.ErrorStatus = func(err error) int {
+			return http.StatusInternalServerError
+		}
+	}
+	if config.ErrorClass == nil {
+		config.ErrorClass = func(err error) string {
+			return ""
+		}
+	}
+	h := &handler{config: config, listener: listener, ctx: ctx, upgrader: websocket.Upgrader{}}
+	server := &http.Server{
+		Addr:              ":" + config.Port,
+		Handler:           h,
+		ReadHeaderTimeout: 2 * time.Second,
+		ReadTimeout:       config.ReadTimeout, //net/http clears the deadline of hijacked websocket connections
+	}
+	go func() {
+		config.Logger.Info("starting http event server", "addr", server.Addr, "tls", config.TlsCertFile != "")
+		var err error
+		if config.TlsCertFile != "" {
+			err = server.ListenAndServeTLS(config.TlsCertFile, config.TlsKeyFile)
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil {
+			if !errors.Is(err, http.ErrServerClosed) {
+				config.Logger.Error("http event server error", "error", err)
+				errorhandler(err)
+			} else {
+				config.Logger.Info("http event server closed")
+			}
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		config.Logger.Info("shutting down http event server", "result", server.Shutdown(context.Background()))
+	}()
+	return nil
+}
+
+type handler struct {
+	config   Config
+	listener Listener
+	ctx      context.Context
+	upgrader websocket.Upgrader
+}
+
+func (this *handler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	parts := strings.Split(strings.Trim(request.URL.Path, "/"), "/")
+	if len(parts) != 3 || parts[0] != "events" || parts[1] == "" || parts[2] == "" {
+		http.Error(writer, "unknown endpoint", http.StatusNotFound)
+		return
+	}
+	auth, ok := getAuth(request)
+	if !ok {
+		this.writeError(writer, ErrMissingCredentials, http.StatusUnauthorized)
+		return
+	}
+	qos := 0
+	if qosStr := request.URL.Query().Get("qos"); qosStr != "" {
+		var err error
+		qos, err = strconv.Atoi(qosStr)
+		if err != nil || qos < 0 || qos > 2 {
+			this.writeError(writer, errors.New("invalid qos"), http.StatusBadRequest)
+			return
+		}
+	}
+	event := Event{Auth: auth, DeviceLocalId: parts[1], ServiceLocalId: parts[2], Qos: qos, RemoteAddr: request.RemoteAddr}
+	switch {
+	case request.Method == http.MethodPost:
+		this.handlePost(writer, request, event)
+	case request.Method == http.MethodGet && websocket.IsWebSocketUpgrade(request):
+		this.handleWebsocket(writer, request, event)
+	default:
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (this *handler) authenticate(ctx context.Context, auth Auth, remoteAddr string) (Auth, error) {
+	if this.config.Authenticate == nil {
+		return auth, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, this.config.ReadTimeout)
+	defer cancel()
+	return this.config.Authenticate(ctx, auth, remoteAddr)
+}
+
+func (this *handler) handlePost(writer http.ResponseWriter, request *http.Request, event Event) {
+	ctx, cancel := context.WithTimeout(request.Context(), this.config.ReadTimeout)
+	defer cancel()
+	err := json.NewDecoder(io.LimitReader(request.Body, this.config.MaxMessageBytes)).Decode(&event.Msg)
+	if err != nil {
+		this.writeError(writer, err, http.StatusBadRequest)
+		return
+	}
+	event.Auth, err = this.authenticate(ctx, event.Auth, event.RemoteAddr)
+	if err != nil {
+		this.writeError(writer, err, this.config.ErrorStatus(err))
+		return
+	}
+	info, err := this.listener(ctx, event)
+	if err != nil {
+		this.writeError(writer, err, this.config.ErrorStatus(err))
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(writer).Encode(info)
+	if err != nil {
+		this.config.Logger.Error("unable to write http event response", "error", err)
+	}
+}
+
+func (this *handler) handleWebsocket(writer http.ResponseWriter, request *http.Request, event Event) {
+	credentials := event.Auth
+	var err error
+	event.Auth, err = this.authenticate(request.Context(), credentials, event.RemoteAddr)
+	if err != nil {
+		this.writeError(writer, err, this.config.ErrorStatus(err))
+		return
+	}
+	conn, err := this.upgrader.Upgrade(writer, request, nil)
+	if err != nil {
+		this.config.Logger.Warn("unable to upgrade websocket connection", "error", err)
+		return
+	}
+	defer conn.Close()
+	conn.SetReadLimit(this.config.MaxMessageBytes)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-this.ctx.Done():
+			_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "shutdown"), time.Now().Add(time.Second))
+			_ = conn.Close()
+		case <-done:
+		}
+	}()
+	defaultQos := event.Qos
+	for {
+		msg := WebsocketMessage{}
+		err = conn.ReadJSON(&msg)
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) && this.ctx.Err() == nil {
+				this.config.Logger.Info("websocket event connection closed", "reason", err)
+			}
+			return
+		}
+		event.Msg = msg.Msg
+		event.Qos = defaultQos
+		if msg.Qos != nil {
+			event.Qos = *msg.Qos
+		}
+		result := Result{Id: msg.Id}
+		if event.Qos < 0 || event.Qos > 2 {
+			result.Error = this.getError(errors.New("invalid qos"), http.StatusBadRequest)
+			err = conn.WriteJSON(result)
+			if err != nil {
+				this.config.Logger.Warn("unable to write websocket event result", "error", err)
+				return
+			}
+			continue
+		}
+		if this.config.Authenticate != nil && !time.Now().Before(event.Auth.Expiration) {
+			event.Auth, err = this.authenticate(this.ctx, credentials, event.RemoteAddr)
+		}
+		if err == nil {
+			ctx, cancel := context.WithTimeout(this.ctx, this.config.ReadTimeout)
+			result.Info, err = this.listener(ctx, event)
+			cancel()
+		}
+		if err != nil {
+			result.Error = this.getError(err, this.config.ErrorStatus(err))
+		}
+		err = conn.WriteJSON(result)
+		if err != nil {
+			this.config.Logger.Warn("unable to write websocket event result", "error", err)
+			return
+		}
+	}
+}
+
+func (this *handler) getError(err error, status int) *Error {
+	return &Error{Message: err.Error(), Class: this.config.ErrorClass(err), Status: status}
+}
+
+func (this *handler) writeError(writer http.ResponseWriter, err error, status int) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	_ = json.NewEncoder(writer).Encode(this.getError(err, status))
+}
+
+func getAuth(request *http.Request) (auth Auth, ok bool) {
+	if username, password, ok := request.BasicAuth(); ok {
+		return Auth{Username: username, Password: password}, true
+	}
+	token := request.Header.Get("Authorization")
+	if strings.HasPrefix(strings.ToLower(token), "bearer ") {
+		return Auth{Token: token}, true
+	}
+	return auth, false
+}
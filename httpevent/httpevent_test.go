@@ -0,0 +1,180 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpevent
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestHttpEvent(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+	listener.Close()
+
+	errDenied := errors.New("denied")
+	err = Start(ctx, Config{
+		Port: port,
+		ErrorStatus: func(err error) int {
+			return http.StatusForbidden
+		},
+	}, func(ctx context.Context, event Event) (info any, err error) {
+		if event.Auth.Username != "user" && event.Auth.Token != "Bearer token" {
+			return nil, errDenied
+		}
+		return map[string]any{"device": event.DeviceLocalId, "service": event.ServiceLocalId, "value": event.Msg["value"], "qos": event.Qos}, nil
+	}, func(err error) {
+		t.Error(err)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	post := func(user string, body string) (status int, result map[string]any) {
+		req, _ := http.NewRequest(http.MethodPost, "http://localhost:"+port+"/events/d1/s1?qos=1", strings.NewReader(body))
+		if user != "" {
+			req.SetBasicAuth(user, "pw")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		_ = json.NewDecoder(resp.Body).Decode(&result)
+		return resp.StatusCode, result
+	}
+	if status, result := post("user", `{"value":"42"}`); status != http.StatusOK || result["value"] != "42" || result["qos"] != float64(1) {
+		t.Error(status, result)
+	}
+	if status, result := post("", `{"value":"42"}`); status != http.StatusUnauthorized {
+		t.Error(status, result)
+	}
+	if status, result := post("other", `{"value":"42"}`); status != http.StatusForbidden || result["message"] != errDenied.Error() {
+		t.Error(status, result)
+	}
+	if status, result := post("user", `invalid`); status != http.StatusBadRequest {
+		t.Error(status, result)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://localhost:"+port+"/events/d1/s1", http.Header{"Authorization": {"Bearer token"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for i, msg := range []string{`{"id":"1","msg":{"value":"1"}}`, `{"id":"2","msg":{"value":"2"},"qos":5}`} {
+		err = conn.WriteMessage(websocket.TextMessage, []byte(msg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := Result{}
+		err = conn.ReadJSON(&result)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Id != strconv.Itoa(i+1) || (i == 0) != (result.Error == nil) {
+			t.Errorf("%#v %#v", result, result.Error)
+		}
+	}
+}
+
+func TestWebsocketAuthentication(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+	listener.Close()
+
+	authentications := atomic.Int64{}
+	err = Start(ctx, Config{
+		Port:        port,
+		ReadTimeout: 200 * time.Millisecond,
+		Authenticate: func(ctx context.Context, auth Auth, remoteAddr string) (Auth, error) {
+			authentications.Add(1)
+			if auth.Username != "user" {
+				return Auth{}, errors.New("denied")
+			}
+			return Auth{Token: "Bearer token", Expiration: time.Now().Add(time.Hour)}, nil
+		},
+	}, func(ctx context.Context, event Event) (info any, err error) {
+		if event.Auth.Token != "Bearer token" {
+			return nil, errors.New("unexpected auth")
+		}
+		return event.Msg["value"], nil
+	}, func(err error) {
+		t.Error(err)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	header := http.Header{}
+	header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("other:pw")))
+	_, resp, err := websocket.DefaultDialer.Dial("ws://localhost:"+port+"/events/d1/s1", header)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusInternalServerError {
+		t.Error("expected rejected upgrade", err, resp)
+	}
+
+	header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("user:pw")))
+	conn, _, err := websocket.DefaultDialer.Dial("ws://localhost:"+port+"/events/d1/s1", header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for i := 0; i < 3; i++ {
+		if i == 2 {
+			time.Sleep(300 * time.Millisecond) //longer than the server ReadTimeout
+		}
+		err = conn.WriteJSON(WebsocketMessage{Id: strconv.Itoa(i), Msg: map[string]string{"value": strconv.Itoa(i)}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := Result{}
+		err = conn.ReadJSON(&result)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Error != nil || result.Info != strconv.Itoa(i) {
+			t.Errorf("%#v %#v", result, result.Error)
+		}
+	}
+	if authentications.Load() != 2 {
+		t.Error("expected one authentication per connection", authentications.Load())
+	}
+}
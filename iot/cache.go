@@ -1,9 +1,12 @@
 package iot
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"os"
 	"runtime/debug"
+	"strings"
 	"sync"
 	"time"
 
@@ -13,6 +16,7 @@ import (
 	"github.com/SENERGY-Platform/service-commons/pkg/cache"
 	"github.com/SENERGY-Platform/service-commons/pkg/cache/memcached"
 	"github.com/SENERGY-Platform/service-commons/pkg/signal"
+	"golang.org/x/sync/singleflight"
 )
 
 type PreparedCache struct {
@@ -21,17 +25,80 @@ type PreparedCache struct {
 	deviceExpiration         int32
 	deviceTypeExpiration     int32
 	characteristicExpiration int32
+	protocolExpiration       int32
+	notFoundExpiration       int32
 	Debug                    bool
-	protocol                 map[string]model.Protocol
-	mux                      sync.RWMutex
+	lru                      *LruCache //nil if the default unbounded l1 cache is used
+	notFound                 *LruCache
+	stale                    *LruCache //last known values; nil if stale entries are not served
+	staleExpiration          int32
+	inflight                 singleflight.Group
+	deviceKeysMux            sync.Mutex
+	deviceKeys               *LruCache //device id -> set of cache keys; bounded; entries expire with the cached devices
 }
 
+type CacheOptions struct {
+	DeviceExpiration         int32 //seconds; 0 disables the device cache
+	DeviceTypeExpiration     int32 //seconds; 0 disables the device-type cache
+	CharacteristicExpiration int32 //seconds
+	ProtocolExpiration       int32 //optional; seconds; default 3600
+	NotFoundExpiration       int32 //optional; seconds; caches security.ErrorNotFound results of device, device-type, protocol and characteristic lookups
+	StaleExpiration          int32 //optional; seconds; expired entries are served for this duration while they are refreshed in the background (e.g. while the repository is unavailable)
+
+	Size int //optional; max entries of the in-memory cache (LRU); replaces the default unbounded in-memory cache; required for snapshots
+
+	MemcachedUrls []string //optional; second cache layer
+	MaxIdleConns  int
+	Timeout       time.Duration
+}
+
+const defaultInMemorySize = 10000
+
+var ErrSnapshotNotSupported = errors.New("cache snapshots require CacheOptions.Size")
+
 type Cache struct {
 	parent *PreparedCache
 	token  security.JwtToken
+	ctx    context.Context
 }
 
 func NewCache(iot *Iot, deviceExpiration int32, deviceTypeExpiration int32, characteristicExpiration int32, maxIdleConns int, timeout time.Duration, memcachedServer ...string) (*PreparedCache, error) {
+	return NewCacheWithOptions(iot, CacheOptions{
+		DeviceExpiration:         deviceExpiration,
+		DeviceTypeExpiration:     deviceTypeExpiration,
+		CharacteristicExpiration: characteristicExpiration,
+		MemcachedUrls:            memcachedServer,
+		MaxIdleConns:             maxIdleConns,
+		Timeout:                  timeout,
+	})
+}
+
+func NewCacheWithOptions(iot *Iot, options CacheOptions) (*PreparedCache, error) {
+	result := &PreparedCache{
+		iot:                      iot,
+		deviceExpiration:         options.DeviceExpiration,
+		deviceTypeExpiration:     options.DeviceTypeExpiration,
+		characteristicExpiration: options.CharacteristicExpiration,
+		protocolExpiration:       options.ProtocolExpiration,
+		notFoundExpiration:       options.NotFoundExpiration,
+		staleExpiration:          options.StaleExpiration,
+	}
+	if result.protocolExpiration == 0 {
+		result.protocolExpiration = 3600
+	}
+	if result.notFoundExpiration > 0 {
+		result.notFound = NewLruCache(defaultInMemorySize)
+	}
+	if result.staleExpiration > 0 {
+		result.stale = NewLruCache(options.Size)
+		if options.Size <= 0 {
+			result.stale = NewLruCache(defaultInMemorySize)
+		}
+	}
+	result.deviceKeys = NewLruCache(options.Size)
+	if options.Size <= 0 {
+		result.deviceKeys = NewLruCache(defaultInMemorySize)
+	}
 	cacheConf := cache.Config{
 		ReadCacheHook: func(duration time.Duration) {
 			statistics.CacheRead(duration)
@@ -48,32 +115,169 @@ func NewCache(iot *Iot, deviceExpiration int32, deviceTypeExpiration int32, char
 			},
 		},
 	}
-	if len(memcachedServer) > 0 {
-		cacheConf.L2Provider = memcached.NewProvider(maxIdleConns, timeout, memcachedServer...)
+	if len(options.MemcachedUrls) > 0 {
+		cacheConf.L2Provider = memcached.NewProvider(options.MaxIdleConns, options.Timeout, options.MemcachedUrls...)
+	}
+	if options.Size > 0 {
+		result.lru = NewLruCache(options.Size)
+		cacheConf.L1 = result.lru
 	}
 
-	c, err := cache.New(cacheConf)
+	var err error
+	result.cache, err = cache.New(cacheConf)
 	if err != nil {
 		return nil, err
 	}
-	return &PreparedCache{iot: iot, deviceExpiration: deviceExpiration, deviceTypeExpiration: deviceTypeExpiration, characteristicExpiration: characteristicExpiration, cache: c, protocol: map[string]model.Protocol{}}, nil
+	return result, nil
+}
+
+// use is cache.Use with an additional in-memory cache of security.ErrorNotFound results and optional stale-while-revalidate;
+// concurrent cache misses of the same key are served by a single repository request.
+// get receives the context of the request it serves, which is detached from the caller for background refreshes.
+func use[T any](ctx context.Context, this *PreparedCache, key string, get func(ctx context.Context) (T, error), validate func(T) error, exp time.Duration) (result T, err error) {
+	load := get
+	if this.notFound != nil {
+		load = func(ctx context.Context) (T, error) {
+			if _, _, err := this.notFound.Get(key); err == nil {
+				return result, fmt.Errorf("%w: %v (cached)", security.ErrorNotFound, key)
+			}
+			result, err := get(ctx)
+			if errors.Is(err, security.ErrorNotFound) {
+				this.setNotFound(key)
+			}
+			return result, err
+		}
+	}
+	if this.stale == nil {
+		return cache.Use(this.cache, key, func() (T, error) {
+			return coalesce(ctx, this, key, load)
+		}, validate, exp)
+	}
+	result, err = cache.Get[T](this.cache, key, validate)
+	if err == nil {
+		return result, nil
+	}
+	if value, _, err := this.stale.Get(key); err == nil {
+		if staleResult, ok := value.(T); ok && (validate == nil || validate(staleResult) == nil) {
+			go func() {
+				_, err := refresh(context.WithoutCancel(ctx), this, key, load, exp)
+				if err != nil {
+					this.iot.GetLogger().Debug("unable to refresh stale cache entry", "error", err, "key", key)
+				}
+			}()
+			return staleResult, nil
+		}
+	}
+	return refresh(ctx, this, key, load, exp)
+}
+
+// refresh loads the value and updates the cache and the stale entry;
+// a security.ErrorNotFound result removes the stale entry, so that deleted entities are no longer served
+func refresh[T any](ctx context.Context, this *PreparedCache, key string, get func(ctx context.Context) (T, error), exp time.Duration) (result T, err error) {
+	result, err = coalesce(ctx, this, key, get)
+	if errors.Is(err, security.ErrorNotFound) {
+		_ = this.stale.Remove(key)
+		_ = this.cache.Remove(key)
+		this.setNotFound(key)
+	}
+	if err != nil {
+		return result, err
+	}
+	_ = this.set(key, result, exp)
+	return result, nil
+}
+
+func coalesce[T any](ctx context.Context, this *PreparedCache, key string, get func(ctx context.Context) (T, error)) (result T, err error) {
+	executed := false
+	done := this.inflight.DoChan(key, func() (interface{}, error) {
+		executed = true
+		return get(ctx)
+	})
+	select {
+	case <-ctx.Done():
+		return result, ctx.Err()
+	case r := <-done:
+		if !executed {
+			statistics.IotRequestCoalesced(strings.SplitN(key, ".", 2)[0])
+			if (errors.Is(r.Err, context.Canceled) || errors.Is(r.Err, context.DeadlineExceeded)) && ctx.Err() == nil {
+				return get(ctx) //the context of the request which served this call is done
+			}
+		}
+		if r.Err != nil {
+			return result, r.Err
+		}
+		return r.Val.(T), nil
+	}
+}
+
+func (this *PreparedCache) setNotFound(key string) {
+	if this.notFound != nil {
+		_ = this.notFound.Set(key, true, time.Duration(this.notFoundExpiration)*time.Second)
+	}
+}
+
+func (this *PreparedCache) set(key string, value interface{}, exp time.Duration) error {
+	if this.notFound != nil {
+		_ = this.notFound.Remove(key)
+	}
+	if this.stale != nil {
+		_ = this.stale.Set(key, value, exp+time.Duration(this.staleExpiration)*time.Second)
+	}
+	return this.cache.Set(key, value, exp)
+}
+
+// SaveSnapshot writes the content of the in-memory cache to file
+func (this *PreparedCache) SaveSnapshot(file string) error {
+	if this.lru == nil {
+		return ErrSnapshotNotSupported
+	}
+	temp := file + ".tmp"
+	f, err := os.Create(temp)
+	if err != nil {
+		return err
+	}
+	err = this.lru.WriteSnapshot(f)
+	err = errors.Join(err, f.Close())
+	if err != nil {
+		_ = os.Remove(temp)
+		return err
+	}
+	return os.Rename(temp, file)
+}
+
+// LoadSnapshot warms the in-memory cache with the content of a file written by SaveSnapshot
+func (this *PreparedCache) LoadSnapshot(file string) error {
+	if this.lru == nil {
+		return ErrSnapshotNotSupported
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return this.lru.ReadSnapshot(f)
 }
 
 func (this *PreparedCache) WithToken(token security.JwtToken) *Cache {
-	return &Cache{parent: this, token: token}
+	return &Cache{parent: this, token: token, ctx: context.Background()}
 }
 
 func (this *PreparedCache) GetDevice(token security.JwtToken, id string) (result model.Device, err error) {
+	return this.GetDeviceCtx(context.Background(), token, id)
+}
+
+func (this *PreparedCache) GetDeviceCtx(ctx context.Context, token security.JwtToken, id string) (result model.Device, err error) {
 	if this.deviceExpiration == 0 {
-		return this.iot.GetDevice(id, token)
+		return this.iot.GetDeviceCtx(ctx, id, token)
 	}
 	pl, err := token.GetPayload()
 	if err != nil {
 		return result, err
 	}
-	result, err = cache.Use(this.cache, "device."+pl.UserId+"."+id, func() (model.Device, error) {
+	key := "device." + pl.UserId + "." + id
+	result, err = use(ctx, this, key, func(ctx context.Context) (model.Device, error) {
 		this.iot.GetLogger().Debug("load device from repository", "id", id)
-		return this.iot.GetDevice(id, token)
+		return this.iot.GetDeviceCtx(ctx, id, token)
 	}, func(device model.Device) error {
 		if device.Id == "" {
 			return fmt.Errorf("missing device.id")
@@ -86,20 +290,26 @@ func (this *PreparedCache) GetDevice(token security.JwtToken, id string) (result
 	if err != nil {
 		return result, err
 	}
+	this.indexDeviceKey(result.Id, key)
 	return result, err
 }
 
 func (this *PreparedCache) GetDeviceByLocalId(token security.JwtToken, deviceUrl string) (result model.Device, err error) {
+	return this.GetDeviceByLocalIdCtx(context.Background(), token, deviceUrl)
+}
+
+func (this *PreparedCache) GetDeviceByLocalIdCtx(ctx context.Context, token security.JwtToken, deviceUrl string) (result model.Device, err error) {
 	if this.deviceExpiration == 0 {
-		return this.iot.GetDeviceByLocalId(deviceUrl, token)
+		return this.iot.GetDeviceByLocalIdCtx(ctx, deviceUrl, token)
 	}
 	pl, err := token.GetPayload()
 	if err != nil {
 		return result, err
 	}
-	return cache.Use(this.cache, "device_url."+pl.UserId+"."+deviceUrl, func() (model.Device, error) {
+	key := "device_url." + pl.UserId + "." + deviceUrl
+	result, err = use(ctx, this, key, func(ctx context.Context) (model.Device, error) {
 		this.iot.GetLogger().Debug("load device from repository", "deviceLocalId", deviceUrl)
-		return this.iot.GetDeviceByLocalId(deviceUrl, token)
+		return this.iot.GetDeviceByLocalIdCtx(ctx, deviceUrl, token)
 	}, func(device model.Device) error {
 		if device.Id == "" {
 			return fmt.Errorf("missing device.id")
@@ -109,6 +319,11 @@ func (this *PreparedCache) GetDeviceByLocalId(token security.JwtToken, deviceUrl
 		}
 		return nil
 	}, time.Duration(this.deviceExpiration)*time.Second)
+	if err != nil {
+		return result, err
+	}
+	this.indexDeviceKey(result.Id, key)
+	return result, nil
 }
 
 func (this *PreparedCache) CreateDevice(token security.JwtToken, device model.Device) (result model.Device, err error) {
@@ -126,11 +341,14 @@ func (this *PreparedCache) cacheDevice(token security.JwtToken, device model.Dev
 		return err
 	}
 	this.iot.GetLogger().Debug("cache device", "device", fmt.Sprintf("%#v", device))
-	err = this.cache.Set("device_url."+pl.UserId+"."+device.LocalId, device, time.Duration(this.deviceExpiration)*time.Second)
+	urlKey := "device_url." + pl.UserId + "." + device.LocalId
+	idKey := "device." + pl.UserId + "." + device.Id
+	this.indexDeviceKey(device.Id, urlKey, idKey)
+	err = this.set(urlKey, device, time.Duration(this.deviceExpiration)*time.Second)
 	if err != nil {
 		return err
 	}
-	err = this.cache.Set("device."+pl.UserId+"."+device.Id, device, time.Duration(this.deviceExpiration)*time.Second)
+	err = this.set(idKey, device, time.Duration(this.deviceExpiration)*time.Second)
 	if err != nil {
 		return err
 	}
@@ -148,7 +366,7 @@ func (this *PreparedCache) UpdateDevice(token security.JwtToken, device model.De
 func (this *PreparedCache) CreateDeviceType(token security.JwtToken, deviceType model.DeviceType) (result model.DeviceType, err error) {
 	result, err = this.iot.CreateDeviceType(deviceType, token)
 	if err == nil {
-		this.cache.Set("dt."+result.Id, result, time.Duration(this.deviceTypeExpiration)*time.Second)
+		this.set("dt."+result.Id, result, time.Duration(this.deviceTypeExpiration)*time.Second)
 	}
 	return
 }
@@ -156,7 +374,7 @@ func (this *PreparedCache) CreateDeviceType(token security.JwtToken, deviceType
 func (this *PreparedCache) UpdateDeviceType(token security.JwtToken, deviceType model.DeviceType) (result model.DeviceType, err error) {
 	result, err = this.iot.UpdateDeviceType(deviceType, token)
 	if err == nil {
-		this.cache.Set("dt."+result.Id, result, time.Duration(this.deviceTypeExpiration)*time.Second)
+		this.set("dt."+result.Id, result, time.Duration(this.deviceTypeExpiration)*time.Second)
 	}
 	return
 }
@@ -170,6 +388,10 @@ func (this *PreparedCache) EnsureLocalDeviceExistence(token security.JwtToken, d
 }
 
 func (this *PreparedCache) GetDeviceType(token security.JwtToken, id string) (result model.DeviceType, err error) {
+	return this.GetDeviceTypeCtx(context.Background(), token, id)
+}
+
+func (this *PreparedCache) GetDeviceTypeCtx(ctx context.Context, token security.JwtToken, id string) (result model.DeviceType, err error) {
 	if id == "" {
 		if this.Debug {
 			debug.PrintStack()
@@ -178,10 +400,10 @@ func (this *PreparedCache) GetDeviceType(token security.JwtToken, id string) (re
 		return result, errors.New("missing id")
 	}
 	if this.deviceTypeExpiration == 0 {
-		return this.iot.GetDeviceType(id, token)
+		return this.iot.GetDeviceTypeCtx(ctx, id, token)
 	}
-	return cache.Use(this.cache, "dt."+id, func() (model.DeviceType, error) {
-		return this.iot.GetDeviceType(id, token)
+	return use(ctx, this, "dt."+id, func(ctx context.Context) (model.DeviceType, error) {
+		return this.iot.GetDeviceTypeCtx(ctx, id, token)
 	}, func(deviceType model.DeviceType) error {
 		if deviceType.Id == "" {
 			return errors.New("missing device_type.id")
@@ -191,30 +413,18 @@ func (this *PreparedCache) GetDeviceType(token security.JwtToken, id string) (re
 }
 
 func (this *PreparedCache) GetProtocol(token security.JwtToken, id string) (result model.Protocol, err error) {
-	protocol, ok := this.readProtocolFromCache(id)
-	if ok {
-		return protocol, nil
-	}
-	protocol, err = this.iot.GetProtocol(id, token)
-	if err != nil {
-		return protocol, err
-	}
-	this.writeProtocolToCache(id, protocol)
-	return protocol, err
+	return this.GetProtocolCtx(context.Background(), token, id)
 }
 
-func (this *PreparedCache) readProtocolFromCache(id string) (result model.Protocol, ok bool) {
-	this.mux.RLock()
-	defer this.mux.RUnlock()
-	result, ok = this.protocol[id]
-	return
-}
-
-func (this *PreparedCache) writeProtocolToCache(id string, protocol model.Protocol) {
-	this.mux.Lock()
-	defer this.mux.Unlock()
-	this.protocol[id] = protocol
-	return
+func (this *PreparedCache) GetProtocolCtx(ctx context.Context, token security.JwtToken, id string) (result model.Protocol, err error) {
+	return use(ctx, this, protocolCachePrefix+id, func(ctx context.Context) (model.Protocol, error) {
+		return this.iot.GetProtocolCtx(ctx, id, token)
+	}, func(protocol model.Protocol) error {
+		if protocol.Id == "" {
+			return errors.New("missing protocol.id")
+		}
+		return nil
+	}, time.Duration(this.protocolExpiration)*time.Second)
 }
 
 func (this *PreparedCache) GetCache() *cache.Cache {
@@ -222,15 +432,20 @@ func (this *PreparedCache) GetCache() *cache.Cache {
 }
 
 func (this *PreparedCache) InvalidateDeviceTypeCache(deviceTypeId string) {
-	this.cache.Remove("dt." + deviceTypeId)
+	this.remove("dt." + deviceTypeId)
+}
+
+// WithContext returns a copy of the Cache which uses ctx for all repository requests
+func (this *Cache) WithContext(ctx context.Context) *Cache {
+	return &Cache{parent: this.parent, token: this.token, ctx: ctx}
 }
 
 func (this *Cache) GetDevice(id string) (result model.Device, err error) {
-	return this.parent.GetDevice(this.token, id)
+	return this.parent.GetDeviceCtx(this.ctx, this.token, id)
 }
 
 func (this *Cache) GetDeviceByLocalId(deviceUrl string) (result model.Device, err error) {
-	return this.parent.GetDeviceByLocalId(this.token, deviceUrl)
+	return this.parent.GetDeviceByLocalIdCtx(this.ctx, this.token, deviceUrl)
 }
 
 func (this *Cache) CreateDevice(device model.Device) (result model.Device, err error) {
@@ -242,9 +457,14 @@ func (this *Cache) EnsureLocalDeviceExistence(device model.Device) (result model
 }
 
 func (this *Cache) GetDeviceType(id string) (result model.DeviceType, err error) {
-	return this.parent.GetDeviceType(this.token, id)
+	return this.parent.GetDeviceTypeCtx(this.ctx, this.token, id)
 }
 
 func (this *Cache) GetProtocol(id string) (result model.Protocol, err error) {
-	return this.parent.GetProtocol(this.token, id)
+	return this.parent.GetProtocolCtx(this.ctx, this.token, id)
+}
+
+// GetCharacteristicById implements unitreference.SemanticRepository with the context of the Cache
+func (this *Cache) GetCharacteristicById(id string, token security.JwtToken) (result model.Characteristic, err error) {
+	return this.parent.GetCharacteristicByIdCtx(this.ctx, id, token)
 }
@@ -18,12 +18,24 @@ package iot
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	iot2 "github.com/SENERGY-Platform/platform-connector-lib/iot/mock/iot"
 	"github.com/SENERGY-Platform/platform-connector-lib/model"
+	"github.com/SENERGY-Platform/platform-connector-lib/security"
 )
 
 func TestCache_GetProtocol(t *testing.T) {
@@ -69,3 +81,443 @@ func TestCache_GetProtocol(t *testing.T) {
 		return
 	}
 }
+
+func TestCache_GetProtocolCanceledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mock, iotMockUrl, err := iot2.Mock(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	iot := New(iotMockUrl, iotMockUrl, "", slog.Default())
+	cache, err := NewCache(iot, 60, 60, 60, 2, 200*time.Millisecond)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	protocol, err, _ := mock.PublishProtocolCreate(model.Protocol{
+		Name:             "test",
+		Handler:          "test",
+		ProtocolSegments: nil,
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	canceled, cancelRequest := context.WithCancel(context.Background())
+	cancelRequest()
+
+	_, err = cache.WithToken("token").WithContext(canceled).GetProtocol(protocol.Id)
+	if !errors.Is(err, context.Canceled) {
+		t.Error(err)
+		return
+	}
+
+	_, err = cache.WithToken("token").GetProtocol(protocol.Id)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+}
+
+func TestCache_InMemory(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mock, iotMockUrl, err := iot2.Mock(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	iot := New(iotMockUrl, iotMockUrl, "", slog.Default())
+	options := CacheOptions{DeviceExpiration: 60, DeviceTypeExpiration: 60, CharacteristicExpiration: 60, NotFoundExpiration: 60, Size: 10}
+	cache, err := NewCacheWithOptions(iot, options)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err = cache.WithToken("token").GetProtocol("unknown")
+		if !errors.Is(err, security.ErrorNotFound) {
+			t.Error(err)
+			return
+		}
+	}
+	if len(mock.GetCalls()) != 1 {
+		t.Error(mock.GetCalls())
+		return
+	}
+
+	protocol, err, _ := mock.PublishProtocolCreate(model.Protocol{Name: "test", Handler: "test"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = cache.WithToken("token").GetProtocol(protocol.Id)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	file := filepath.Join(t.TempDir(), "snapshot.json")
+	err = cache.SaveSnapshot(file)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	warm, err := NewCacheWithOptions(iot, options)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = warm.LoadSnapshot(file)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	result, err := warm.WithToken("token").GetProtocol(protocol.Id)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if result.Id != protocol.Id || result.Name != "test" {
+		t.Error(result)
+		return
+	}
+	if len(mock.GetCalls()) != 2 {
+		t.Error(mock.GetCalls())
+		return
+	}
+}
+
+func TestLruCache(t *testing.T) {
+	cache := NewLruCache(2)
+	cache.Set("a", 1, time.Minute)
+	cache.Set("b", 2, time.Minute)
+	cache.Get("a")
+	cache.Set("c", 3, time.Minute)
+	if _, _, err := cache.Get("b"); err == nil {
+		t.Error("expected eviction of least recently used entry")
+	}
+	if _, _, err := cache.Get("a"); err != nil {
+		t.Error(err)
+	}
+	cache.Set("d", 4, -time.Second)
+	if _, _, err := cache.Get("d"); err == nil {
+		t.Error("expected expired entry")
+	}
+}
+
+func TestCache_InvalidateDevice(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mock, iotMockUrl, err := iot2.Mock(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	iot := New(iotMockUrl, iotMockUrl, "", slog.Default())
+	cache, err := NewCache(iot, 60, 60, 60, 2, 200*time.Millisecond)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	created, err, _ := mock.PublishDeviceCreate(model.Device{LocalId: "local", DeviceTypeId: "dt"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	device := created.(model.Device)
+
+	tokens := []security.JwtToken{testToken("user1"), testToken("user2")}
+	read := func() {
+		for _, token := range tokens {
+			if _, err := cache.WithToken(token).GetDevice(device.Id); err != nil {
+				t.Error(err)
+			}
+			if _, err := cache.WithToken(token).GetDeviceByLocalId(device.LocalId); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+	read()
+	read()
+	if len(mock.GetCalls()) != 4 {
+		t.Error(mock.GetCalls())
+		return
+	}
+	cache.InvalidateDeviceCache(device.Id)
+	read()
+	if len(mock.GetCalls()) != 8 {
+		t.Error(mock.GetCalls())
+		return
+	}
+}
+
+func TestCache_DeviceKeyIndexBounded(t *testing.T) {
+	cache, err := NewCacheWithOptions(New("", "", "", slog.Default()), CacheOptions{DeviceExpiration: 60, Size: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		id := "device-" + strconv.Itoa(i)
+		cache.indexDeviceKey(id, "device.user."+id)
+	}
+	cache.indexDeviceKey("device-4", "device_url.user.local-4")
+	if cache.deviceKeys.Len() != 2 {
+		t.Error(cache.deviceKeys.Len())
+	}
+	cache.InvalidateDeviceCache("device-4")
+	if cache.deviceKeys.Len() != 1 {
+		t.Error(cache.deviceKeys.Len())
+	}
+}
+
+func testToken(userId string) security.JwtToken {
+	payload, _ := json.Marshal(map[string]string{"sub": userId})
+	return security.JwtToken("Bearer header." + base64.RawURLEncoding.EncodeToString(payload) + ".signature")
+}
+
+func TestCache_Coalescing(t *testing.T) {
+	mux := sync.Mutex{}
+	calls := map[string]int{}
+	running := 0
+	maxRunning := 0
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mux.Lock()
+		calls[request.URL.Path]++
+		running++
+		maxRunning = max(maxRunning, running)
+		mux.Unlock()
+		time.Sleep(50 * time.Millisecond)
+		mux.Lock()
+		running--
+		mux.Unlock()
+		json.NewEncoder(writer).Encode(model.Device{Id: strings.TrimPrefix(request.URL.Path, "/devices/"), DeviceTypeId: "dt"})
+	}))
+	defer server.Close()
+
+	iot := New(server.URL, server.URL, "", slog.Default()).SetMaxConcurrentRequests(1)
+	cache, err := NewCache(iot, 60, 60, 60, 2, 200*time.Millisecond)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := "device-" + strconv.Itoa(i%2)
+			device, err := cache.WithToken(testToken("user")).GetDevice(id)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if device.Id != id {
+				t.Error(device)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if len(calls) != 2 || calls["/devices/device-0"] != 1 || calls["/devices/device-1"] != 1 {
+		t.Error(calls)
+	}
+	if maxRunning != 1 {
+		t.Error(maxRunning)
+	}
+}
+
+func TestCache_StaleWhileRevalidate(t *testing.T) {
+	fail := atomic.Bool{}
+	calls := atomic.Int64{}
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		calls.Add(1)
+		if fail.Load() {
+			http.Error(writer, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(writer).Encode(model.Device{Id: "device", DeviceTypeId: "dt"})
+	}))
+	defer server.Close()
+
+	iot := New(server.URL, server.URL, "", slog.Default()).SetCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 2, OpenTimeout: 200 * time.Millisecond})
+	cache, err := NewCacheWithOptions(iot, CacheOptions{DeviceExpiration: 1, DeviceTypeExpiration: 1, StaleExpiration: 60})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	get := func() {
+		t.Helper()
+		device, err := cache.WithToken(testToken("user")).GetDevice("device")
+		if err != nil || device.Id != "device" {
+			t.Fatal(device, err)
+		}
+	}
+	waitFor := func(expected CircuitState) {
+		t.Helper()
+		for start := time.Now(); iot.CircuitBreakerState() != expected; time.Sleep(10 * time.Millisecond) {
+			if time.Since(start) > 2*time.Second {
+				t.Fatal(iot.CircuitBreakerState())
+			}
+		}
+	}
+
+	get()
+	fail.Store(true)
+	time.Sleep(1100 * time.Millisecond)
+
+	//expired entries are served, while the failing background refresh opens the circuit
+	for iot.CircuitBreakerState() != CircuitOpen {
+		get()
+		time.Sleep(20 * time.Millisecond)
+		if calls.Load() > 10 {
+			t.Fatal(calls.Load())
+		}
+	}
+	callsWhileOpen := calls.Load()
+	get()
+	time.Sleep(20 * time.Millisecond)
+	if calls.Load() != callsWhileOpen {
+		t.Error("open circuit should not send requests")
+	}
+
+	fail.Store(false)
+	waitFor(CircuitHalfOpen)
+	get()
+	waitFor(CircuitClosed)
+}
+
+func TestCache_StaleRefreshWithCanceledContext(t *testing.T) {
+	calls := atomic.Int64{}
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		call := calls.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		json.NewEncoder(writer).Encode(model.Device{Id: "device", DeviceTypeId: "dt", Name: "v" + strconv.FormatInt(call, 10)})
+	}))
+	defer server.Close()
+
+	cache, err := NewCacheWithOptions(New(server.URL, server.URL, "", slog.Default()), CacheOptions{DeviceExpiration: 1, DeviceTypeExpiration: 1, StaleExpiration: 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func(ctx context.Context) model.Device {
+		t.Helper()
+		device, err := cache.GetDeviceCtx(ctx, testToken("user"), "device")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return device
+	}
+
+	get(context.Background())
+	time.Sleep(1100 * time.Millisecond)
+
+	//the caller is done as soon as the stale entry is served; the background refresh must not be canceled with it
+	ctx, cancel := context.WithCancel(context.Background())
+	if device := get(ctx); device.Name != "v1" {
+		t.Error(device)
+	}
+	cancel()
+	time.Sleep(200 * time.Millisecond)
+	if device := get(context.Background()); device.Name != "v2" {
+		t.Error(device)
+	}
+	if calls.Load() != 2 {
+		t.Error(calls.Load())
+	}
+}
+
+func TestCache_StaleRefreshNotFound(t *testing.T) {
+	deleted := atomic.Bool{}
+	calls := atomic.Int64{}
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		calls.Add(1)
+		if deleted.Load() {
+			http.NotFound(writer, request)
+			return
+		}
+		json.NewEncoder(writer).Encode(model.Device{Id: "device", DeviceTypeId: "dt"})
+	}))
+	defer server.Close()
+
+	cache, err := NewCacheWithOptions(New(server.URL, server.URL, "", slog.Default()), CacheOptions{DeviceExpiration: 1, DeviceTypeExpiration: 1, StaleExpiration: 60, NotFoundExpiration: 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func() error {
+		_, err := cache.WithToken(testToken("user")).GetDevice("device")
+		return err
+	}
+	if err = get(); err != nil {
+		t.Fatal(err)
+	}
+	deleted.Store(true)
+	time.Sleep(1100 * time.Millisecond)
+
+	//the stale entry is served once, the background refresh learns that the device has been deleted
+	if err = get(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if err = get(); !errors.Is(err, security.ErrorNotFound) {
+			t.Error(err)
+		}
+	}
+	if calls.Load() != 2 {
+		t.Error(calls.Load())
+	}
+}
+
+func TestCircuitBreakerFailures(t *testing.T) {
+	for _, c := range []struct {
+		err    error
+		failed bool
+	}{
+		{err: nil, failed: false},
+		{err: fmt.Errorf("%w: %v", security.ErrorNotFound, "url"), failed: false},
+		{err: fmt.Errorf("%w: %v", security.ErrorAccessDenied, "url"), failed: false},
+		{err: &security.UnexpectedStatusError{Url: "url", StatusCode: http.StatusBadRequest}, failed: false},
+		{err: &security.UnexpectedStatusError{Url: "url", StatusCode: http.StatusConflict}, failed: false},
+		{err: errors.New("missing id"), failed: false},
+		{err: &json.SyntaxError{}, failed: false},
+		{err: fmt.Errorf("%w: %w", security.ErrorInternal, context.Canceled), failed: false},
+		{err: &security.UnexpectedStatusError{Url: "url", StatusCode: http.StatusInternalServerError}, failed: true},
+		{err: &security.UnexpectedStatusError{Url: "url", StatusCode: http.StatusServiceUnavailable}, failed: true},
+		{err: fmt.Errorf("%w: %w", security.ErrorInternal, errors.New("connection refused")), failed: true},
+		{err: fmt.Errorf("%w: %w", security.ErrorInternal, context.DeadlineExceeded), failed: true},
+	} {
+		if isRepositoryFailure(c.err) != c.failed {
+			t.Error(c.err, c.failed)
+		}
+	}
+
+	breaker := newCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1, OpenTimeout: 10 * time.Millisecond})
+	if err := breaker.allow(); err != nil {
+		t.Fatal(err)
+	}
+	breaker.done(&security.UnexpectedStatusError{Url: "url", StatusCode: http.StatusBadGateway})
+	if breaker.getState() != CircuitOpen {
+		t.Fatal(breaker.getState())
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	//a canceled probe keeps the circuit half-open and allows the next probe
+	if err := breaker.allow(); err != nil {
+		t.Fatal(err)
+	}
+	breaker.done(fmt.Errorf("%w: %w", security.ErrorInternal, context.Canceled))
+	if breaker.getState() != CircuitHalfOpen {
+		t.Fatal(breaker.getState())
+	}
+	if err := breaker.allow(); err != nil {
+		t.Fatal(err)
+	}
+	breaker.done(nil)
+	if breaker.getState() != CircuitClosed {
+		t.Error(breaker.getState())
+	}
+}
@@ -17,12 +17,12 @@
 package iot
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"github.com/SENERGY-Platform/platform-connector-lib/model"
 	"github.com/SENERGY-Platform/platform-connector-lib/security"
 	"github.com/SENERGY-Platform/platform-connector-lib/statistics"
-	"github.com/SENERGY-Platform/service-commons/pkg/cache"
 	"io"
 	"time"
 )
@@ -30,8 +30,12 @@ import (
 const characteristicCachePrefix = "characteristic."
 
 func (this *PreparedCache) GetCharacteristicById(id string, token security.JwtToken) (characteristic model.Characteristic, err error) {
-	return cache.Use(this.cache, characteristicCachePrefix+id, func() (model.Characteristic, error) {
-		return this.iot.GetCharacteristicById(id, token)
+	return this.GetCharacteristicByIdCtx(context.Background(), id, token)
+}
+
+func (this *PreparedCache) GetCharacteristicByIdCtx(ctx context.Context, id string, token security.JwtToken) (characteristic model.Characteristic, err error) {
+	return use(ctx, this, characteristicCachePrefix+id, func(ctx context.Context) (model.Characteristic, error) {
+		return this.iot.GetCharacteristicByIdCtx(ctx, id, token)
 	}, func(c model.Characteristic) error {
 		if c.Id == "" {
 			return errors.New("missing characteristic.id")
@@ -41,12 +45,20 @@ func (this *PreparedCache) GetCharacteristicById(id string, token security.JwtTo
 }
 
 func (this *Iot) GetCharacteristicById(id string, token security.JwtToken) (characteristic model.Characteristic, err error) {
+	return this.GetCharacteristicByIdCtx(context.Background(), id, token)
+}
+
+func (this *Iot) GetCharacteristicByIdCtx(ctx context.Context, id string, token security.JwtToken) (characteristic model.Characteristic, err error) {
+	if err = this.acquire(ctx); err != nil {
+		return characteristic, err
+	}
+	defer func() { this.release(err) }()
 	start := time.Now()
-	defer statistics.IotRead(time.Since(start))
+	defer func() { statistics.IotRead(time.Since(start)) }()
 	if id == "" {
 		return characteristic, errors.New("characteristic id can not be empty")
 	}
-	resp, err := token.Get(this.repo_url + "/characteristics/" + id)
+	resp, err := token.GetCtx(ctx, this.repo_url+"/characteristics/"+id)
 	if err != nil {
 		return characteristic, err
 	}
@@ -0,0 +1,148 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package iot
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/SENERGY-Platform/platform-connector-lib/security"
+	"github.com/SENERGY-Platform/platform-connector-lib/statistics"
+)
+
+var ErrCircuitOpen = errors.New("device repository circuit breaker is open")
+
+type CircuitState string
+
+const (
+	CircuitClosed   CircuitState = "closed"
+	CircuitOpen     CircuitState = "open"
+	CircuitHalfOpen CircuitState = "half-open"
+)
+
+type CircuitBreakerConfig struct {
+	FailureThreshold int           //consecutive failed requests which open the circuit; default 5
+	OpenTimeout      time.Duration //duration until a single test request is allowed (half-open); default 30s
+}
+
+// circuitBreaker rejects requests with ErrCircuitOpen after FailureThreshold consecutive failures.
+// after OpenTimeout, one request is allowed; its success closes the circuit, its failure opens it again.
+type circuitBreaker struct {
+	config   CircuitBreakerConfig
+	mux      sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newCircuitBreaker(config CircuitBreakerConfig) *circuitBreaker {
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = 5
+	}
+	if config.OpenTimeout <= 0 {
+		config.OpenTimeout = 30 * time.Second
+	}
+	statistics.IotCircuitBreakerState(string(CircuitClosed))
+	return &circuitBreaker{config: config, state: CircuitClosed}
+}
+
+func (this *circuitBreaker) allow() error {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	if this.state == CircuitOpen && time.Since(this.openedAt) >= this.config.OpenTimeout {
+		this.setState(CircuitHalfOpen)
+	}
+	switch this.state {
+	case CircuitOpen:
+		return ErrCircuitOpen
+	case CircuitHalfOpen:
+		if this.probing {
+			return ErrCircuitOpen
+		}
+		this.probing = true
+	}
+	return nil
+}
+
+func (this *circuitBreaker) done(err error) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	if errors.Is(err, context.Canceled) {
+		//a canceled request tells nothing about the repository: a half-open circuit waits for the next probe
+		this.probing = false
+		return
+	}
+	failed := isRepositoryFailure(err)
+	if this.state == CircuitHalfOpen {
+		this.probing = false
+		if failed {
+			this.open()
+		} else {
+			this.failures = 0
+			this.setState(CircuitClosed)
+		}
+		return
+	}
+	if !failed {
+		this.failures = 0
+		return
+	}
+	this.failures++
+	if this.state == CircuitClosed && this.failures >= this.config.FailureThreshold {
+		this.open()
+	}
+}
+
+func (this *circuitBreaker) open() {
+	this.openedAt = time.Now()
+	this.setState(CircuitOpen)
+}
+
+func (this *circuitBreaker) setState(state CircuitState) {
+	if this.state != state {
+		this.state = state
+		statistics.IotCircuitBreakerState(string(state))
+	}
+}
+
+func (this *circuitBreaker) getState() CircuitState {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	if this.state == CircuitOpen && time.Since(this.openedAt) >= this.config.OpenTimeout {
+		return CircuitHalfOpen
+	}
+	return this.state
+}
+
+// isRepositoryFailure counts only transport errors, timeouts and 5xx responses;
+// errors caused by the request (e.g. unknown ids, missing permissions, 4xx responses, invalid responses or canceled contexts) are ignored
+func isRepositoryFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var statusErr *security.UnexpectedStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500
+	}
+	return errors.Is(err, security.ErrorInternal)
+}
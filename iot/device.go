@@ -17,6 +17,7 @@
 package iot
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -30,9 +31,17 @@ import (
 )
 
 func (this *Iot) GetDevice(id string, token security.JwtToken) (device model.Device, err error) {
+	return this.GetDeviceCtx(context.Background(), id, token)
+}
+
+func (this *Iot) GetDeviceCtx(ctx context.Context, id string, token security.JwtToken) (device model.Device, err error) {
+	if err = this.acquire(ctx); err != nil {
+		return device, err
+	}
+	defer func() { this.release(err) }()
 	start := time.Now()
-	defer statistics.IotRead(time.Since(start))
-	resp, err := token.Get(this.repo_url + "/devices/" + url.QueryEscape(id) + "?&p=x")
+	defer func() { statistics.IotRead(time.Since(start)) }()
+	resp, err := token.GetCtx(ctx, this.repo_url+"/devices/"+url.QueryEscape(id)+"?&p=x")
 	if err != nil {
 		return device, err
 	}
@@ -50,13 +59,21 @@ func (this *Iot) GetDevice(id string, token security.JwtToken) (device model.Dev
 }
 
 func (this *Iot) GetDeviceType(id string, token security.JwtToken) (dt model.DeviceType, err error) {
+	return this.GetDeviceTypeCtx(context.Background(), id, token)
+}
+
+func (this *Iot) GetDeviceTypeCtx(ctx context.Context, id string, token security.JwtToken) (dt model.DeviceType, err error) {
+	if err = this.acquire(ctx); err != nil {
+		return dt, err
+	}
+	defer func() { this.release(err) }()
 	if id == "" {
 		this.GetLogger().Error("on GetDeviceType() missing id")
 		return dt, errors.New("missing id")
 	}
 	start := time.Now()
-	defer statistics.IotRead(time.Since(start))
-	resp, err := token.Get(this.repo_url + "/device-types/" + url.QueryEscape(id))
+	defer func() { statistics.IotRead(time.Since(start)) }()
+	resp, err := token.GetCtx(ctx, this.repo_url+"/device-types/"+url.QueryEscape(id))
 	if err != nil {
 		this.GetLogger().Error("on GetDeviceType()", "error", err, "id", id)
 		return dt, err
@@ -71,6 +88,10 @@ func (this *Iot) GetDeviceType(id string, token security.JwtToken) (dt model.Dev
 }
 
 func (this *Iot) FindDeviceTypesWithAttributes(attributes []model.Attribute, token security.JwtToken) (dt []model.DeviceType, err error) {
+	if err = this.acquire(context.Background()); err != nil {
+		return dt, err
+	}
+	defer func() { this.release(err) }()
 	options := devicerepo.DeviceTypeListOptions{
 		Limit:           9999,
 		Offset:          0,
@@ -113,9 +134,17 @@ func allTrue(arr []bool) bool {
 }
 
 func (this *Iot) GetDeviceByLocalId(localId string, token security.JwtToken) (device model.Device, err error) {
+	return this.GetDeviceByLocalIdCtx(context.Background(), localId, token)
+}
+
+func (this *Iot) GetDeviceByLocalIdCtx(ctx context.Context, localId string, token security.JwtToken) (device model.Device, err error) {
+	if err = this.acquire(ctx); err != nil {
+		return device, err
+	}
+	defer func() { this.release(err) }()
 	start := time.Now()
-	defer statistics.IotRead(time.Since(start))
-	resp, err := token.Get(this.manager_url + "/local-devices/" + url.QueryEscape(localId))
+	defer func() { statistics.IotRead(time.Since(start)) }()
+	resp, err := token.GetCtx(ctx, this.manager_url+"/local-devices/"+url.QueryEscape(localId))
 	if err != nil {
 		if !errors.Is(err, security.ErrorNotFound) {
 			this.GetLogger().Error("unable to get device", "error", err, "localId", localId)
@@ -132,6 +161,10 @@ func (this *Iot) GetDeviceByLocalId(localId string, token security.JwtToken) (de
 }
 
 func (this *Iot) CreateDevice(device model.Device, token security.JwtToken) (result model.Device, err error) {
+	if err = this.acquire(context.Background()); err != nil {
+		return result, err
+	}
+	defer func() { this.release(err) }()
 	err = token.PostJSON(this.manager_url+"/local-devices", device, &result)
 	if err != nil {
 		this.GetLogger().Error("unable to create device", "error", err, "device", device)
@@ -140,6 +173,10 @@ func (this *Iot) CreateDevice(device model.Device, token security.JwtToken) (res
 }
 
 func (this *Iot) UpdateDevice(device model.Device, token security.JwtToken) (result model.Device, err error) {
+	if err = this.acquire(context.Background()); err != nil {
+		return result, err
+	}
+	defer func() { this.release(err) }()
 	err = token.PutJSON(this.manager_url+"/local-devices/"+device.LocalId, device, &result)
 	if err != nil {
 		this.GetLogger().Error("unable to update device", "error", err, "device", device)
@@ -148,6 +185,10 @@ func (this *Iot) UpdateDevice(device model.Device, token security.JwtToken) (res
 }
 
 func (this *Iot) CreateDeviceType(deviceType model.DeviceType, token security.JwtToken) (dt model.DeviceType, err error) {
+	if err = this.acquire(context.Background()); err != nil {
+		return dt, err
+	}
+	defer func() { this.release(err) }()
 	err = token.PostJSON(this.manager_url+"/device-types", deviceType, &dt)
 	if err != nil {
 		this.GetLogger().Error("unable to create device type", "error", err, "deviceType", deviceType)
@@ -157,6 +198,10 @@ func (this *Iot) CreateDeviceType(deviceType model.DeviceType, token security.Jw
 }
 
 func (this *Iot) UpdateDeviceType(deviceType model.DeviceType, token security.JwtToken) (dt model.DeviceType, err error) {
+	if err = this.acquire(context.Background()); err != nil {
+		return dt, err
+	}
+	defer func() { this.release(err) }()
 	err = token.PutJSON(this.manager_url+"/device-types/"+deviceType.Id, deviceType, &dt)
 	if err != nil {
 		this.GetLogger().Error("unable to update device type", "error", err, "deviceType", deviceType)
@@ -166,6 +211,10 @@ func (this *Iot) UpdateDeviceType(deviceType model.DeviceType, token security.Jw
 }
 
 func (this *Iot) GetDeviceUserRights(token security.JwtToken, deviceId string) (rights model.ResourceRights, err error) {
+	if err = this.acquire(context.Background()); err != nil {
+		return rights, err
+	}
+	defer func() { this.release(err) }()
 	resource, err, _ := this.perm.GetResource(string(token), "devices", deviceId)
 	if err != nil {
 		return rights, err
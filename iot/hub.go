@@ -17,6 +17,7 @@
 package iot
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/url"
@@ -30,8 +31,12 @@ import (
 )
 
 func (this *Iot) GetHub(id string, cred security.JwtToken, optionals ...options.Option) (hub model.Hub, err error) {
+	if err = this.acquire(context.Background()); err != nil {
+		return hub, err
+	}
+	defer func() { this.release(err) }()
 	start := time.Now()
-	defer statistics.IotRead(time.Since(start))
+	defer func() { statistics.IotRead(time.Since(start)) }()
 	resp, err := cred.Get(this.repo_url + "/hubs/" + url.QueryEscape(id) + "?&p=x")
 	if err != nil {
 		if !options.Silent.IsInOptions(optionals...) {
@@ -49,6 +54,10 @@ func (this *Iot) GetHub(id string, cred security.JwtToken, optionals ...options.
 }
 
 func (this *Iot) GetHubsByDeviceLocalId(localId string, token security.JwtToken) (hubs []model.Hub, err error) {
+	if err = this.acquire(context.Background()); err != nil {
+		return hubs, err
+	}
+	defer func() { this.release(err) }()
 	hubs, err, _ = this.devicerepo.ListHubs(string(token), client.HubListOptions{
 		LocalDeviceId: localId,
 	})
@@ -56,16 +65,28 @@ func (this *Iot) GetHubsByDeviceLocalId(localId string, token security.JwtToken)
 }
 
 func (this *Iot) CreateHub(hub model.Hub, cred security.JwtToken) (result model.Hub, err error) {
+	if err = this.acquire(context.Background()); err != nil {
+		return result, err
+	}
+	defer func() { this.release(err) }()
 	err = cred.PostJSON(this.manager_url+"/hubs", hub, &result)
 	return
 }
 
 func (this *Iot) CreateHubWithFixedId(hub model.Hub, adminToken security.JwtToken, userId string) (result model.Hub, err error) {
+	if err = this.acquire(context.Background()); err != nil {
+		return result, err
+	}
+	defer func() { this.release(err) }()
 	err = adminToken.PutJSON(this.manager_url+"/hubs/"+hub.Id+"?user_id="+userId, hub, &result)
 	return
 }
 
 func (this *Iot) ExistsHub(id string, cred security.JwtToken) (exists bool, err error) {
+	if err = this.acquire(context.Background()); err != nil {
+		return exists, err
+	}
+	defer func() { this.release(err) }()
 	var code int
 	code, err = cred.Head(this.repo_url + "/hubs/" + url.QueryEscape(id) + "?p=x")
 	if code < 300 {
@@ -78,12 +99,20 @@ func (this *Iot) ExistsHub(id string, cred security.JwtToken) (exists bool, err
 }
 
 func (this *Iot) UpdateHub(id string, hub model.Hub, cred security.JwtToken) (result model.Hub, err error) {
+	if err = this.acquire(context.Background()); err != nil {
+		return result, err
+	}
+	defer func() { this.release(err) }()
 	hub.Id = id
 	err = cred.PutJSON(this.manager_url+"/hubs/"+url.QueryEscape(id), hub, &result)
 	return
 }
 
 func (this *Iot) DeleteHub(id string, cred security.JwtToken) (err error) {
+	if err = this.acquire(context.Background()); err != nil {
+		return err
+	}
+	defer func() { this.release(err) }()
 	_, err = cred.Delete(this.manager_url + "/hubs/" + url.QueryEscape(id))
 	return
 }
@@ -0,0 +1,95 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package iot
+
+import (
+	"strings"
+	"time"
+)
+
+const protocolCachePrefix = "protocol."
+
+// device cache keys are scoped by user ("device.<user-id>.<device-id>", "device_url.<user-id>.<local-id>");
+// to evict a device for all users, the keys used by this instance are indexed by device id.
+// the index is bounded like the in-memory cache and expires with the device entries; keys of evicted index entries
+// are removed by the RemoveIf scan of the in-memory LRU or expire.
+func (this *PreparedCache) indexDeviceKey(deviceId string, keys ...string) {
+	this.deviceKeysMux.Lock()
+	defer this.deviceKeysMux.Unlock()
+	indexed := map[string]bool{}
+	if value, _, err := this.deviceKeys.Get(deviceId); err == nil {
+		indexed = value.(map[string]bool)
+	}
+	for _, key := range keys {
+		indexed[key] = true
+	}
+	_ = this.deviceKeys.Set(deviceId, indexed, time.Duration(this.deviceExpiration+this.staleExpiration)*time.Second)
+}
+
+// InvalidateDeviceCache removes all cached entries of the device, including lookups by previous local ids.
+// localIds are used to remove cached not-found results (e.g. of a new or renamed device) and entries loaded from a snapshot.
+// entries cached in memcached by other instances for other users are only removed by the other instances.
+func (this *PreparedCache) InvalidateDeviceCache(deviceId string, localIds ...string) {
+	this.deviceKeysMux.Lock()
+	keys := map[string]bool{}
+	if value, _, err := this.deviceKeys.Get(deviceId); err == nil {
+		keys = value.(map[string]bool)
+	}
+	_ = this.deviceKeys.Remove(deviceId)
+	this.deviceKeysMux.Unlock()
+	for key := range keys {
+		this.remove(key)
+	}
+	match := func(key string) bool {
+		if strings.HasPrefix(key, "device.") && strings.HasSuffix(key, "."+deviceId) {
+			return true
+		}
+		for _, localId := range localIds {
+			if localId != "" && strings.HasPrefix(key, "device_url.") && strings.HasSuffix(key, "."+localId) {
+				return true
+			}
+		}
+		return false
+	}
+	if this.lru != nil {
+		this.lru.RemoveIf(match) //entries loaded from a snapshot are not indexed
+	}
+	if this.notFound != nil {
+		this.notFound.RemoveIf(match)
+	}
+	if this.stale != nil {
+		this.stale.RemoveIf(match)
+	}
+}
+
+func (this *PreparedCache) InvalidateProtocolCache(protocolId string) {
+	this.remove(protocolCachePrefix + protocolId)
+}
+
+func (this *PreparedCache) InvalidateCharacteristicCache(characteristicId string) {
+	this.remove(characteristicCachePrefix + characteristicId)
+}
+
+func (this *PreparedCache) remove(key string) {
+	if this.notFound != nil {
+		this.notFound.Remove(key)
+	}
+	if this.stale != nil {
+		this.stale.Remove(key)
+	}
+	this.cache.Remove(key)
+}
@@ -17,6 +17,7 @@
 package iot
 
 import (
+	"context"
 	"log/slog"
 
 	devicerepo "github.com/SENERGY-Platform/device-repository/lib/client"
@@ -29,6 +30,8 @@ type Iot struct {
 	devicerepo  devicerepo.Interface
 	perm        permv2.Client
 	logger      *slog.Logger
+	limit       chan struct{} //nil if the number of concurrent requests is not limited
+	breaker     *circuitBreaker
 }
 
 func New(deviceManagerUrl string, deviceRepoUrl string, permv2Url string, logger *slog.Logger) *Iot {
@@ -44,3 +47,58 @@ func New(deviceManagerUrl string, deviceRepoUrl string, permv2Url string, logger
 func (this *Iot) GetLogger() *slog.Logger {
 	return this.logger
 }
+
+// SetMaxConcurrentRequests limits the number of parallel http requests; further requests wait until a request is finished or ctx is done.
+// must be called before the first request.
+func (this *Iot) SetMaxConcurrentRequests(max int) *Iot {
+	if max > 0 {
+		this.limit = make(chan struct{}, max)
+	} else {
+		this.limit = nil
+	}
+	return this
+}
+
+// SetCircuitBreaker enables a circuit breaker for all http requests; must be called before the first request
+func (this *Iot) SetCircuitBreaker(config CircuitBreakerConfig) *Iot {
+	this.breaker = newCircuitBreaker(config)
+	return this
+}
+
+// CircuitBreakerState returns CircuitClosed if no circuit breaker is set
+func (this *Iot) CircuitBreakerState() CircuitState {
+	if this.breaker == nil {
+		return CircuitClosed
+	}
+	return this.breaker.getState()
+}
+
+// acquire waits for a free request slot and checks the circuit breaker; a successful call must be followed by release()
+func (this *Iot) acquire(ctx context.Context) error {
+	if this.limit != nil {
+		select {
+		case this.limit <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if this.breaker != nil {
+		if err := this.breaker.allow(); err != nil {
+			if this.limit != nil {
+				<-this.limit
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// release frees the request slot and reports the result of the request to the circuit breaker
+func (this *Iot) release(err error) {
+	if this.breaker != nil {
+		this.breaker.done(err)
+	}
+	if this.limit != nil {
+		<-this.limit
+	}
+}
@@ -0,0 +1,177 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package iot
+
+import (
+	"container/list"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/SENERGY-Platform/service-commons/pkg/cache"
+	"github.com/SENERGY-Platform/service-commons/pkg/cache/interfaces"
+)
+
+// LruCache is a size bounded in-memory cache.CacheImpl; the least recently used entry is removed if the size is exceeded
+type LruCache struct {
+	size  int
+	mux   sync.Mutex
+	list  *list.List
+	items map[string]*list.Element
+}
+
+type lruEntry struct {
+	key        string
+	value      interface{}
+	resultType interfaces.ResultType
+	expires    time.Time
+}
+
+type snapshotEntry struct {
+	Key     string          `json:"key"`
+	Value   json.RawMessage `json:"value"`
+	Expires time.Time       `json:"expires"`
+}
+
+func NewLruCache(size int) *LruCache {
+	return &LruCache{size: size, list: list.New(), items: map[string]*list.Element{}}
+}
+
+func (this *LruCache) Get(key string) (value interface{}, resultType interfaces.ResultType, err error) {
+	value, resultType, _, err = this.GetWithExpiration(key)
+	return
+}
+
+func (this *LruCache) GetWithExpiration(key string) (value interface{}, resultType interfaces.ResultType, exp time.Duration, err error) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	element, ok := this.items[key]
+	if !ok {
+		return nil, interfaces.ExactlyAsSet, 0, cache.ErrNotFound
+	}
+	entry := element.Value.(*lruEntry)
+	exp = time.Until(entry.expires)
+	if exp <= 0 {
+		this.remove(element)
+		return nil, interfaces.ExactlyAsSet, 0, cache.ErrNotFound
+	}
+	this.list.MoveToFront(element)
+	return entry.value, entry.resultType, exp, nil
+}
+
+func (this *LruCache) Set(key string, value interface{}, exp time.Duration) error {
+	this.set(&lruEntry{key: key, value: value, resultType: interfaces.ExactlyAsSet, expires: time.Now().Add(exp)})
+	return nil
+}
+
+func (this *LruCache) set(entry *lruEntry) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	if element, ok := this.items[entry.key]; ok {
+		element.Value = entry
+		this.list.MoveToFront(element)
+		return
+	}
+	this.items[entry.key] = this.list.PushFront(entry)
+	for this.size > 0 && this.list.Len() > this.size {
+		this.remove(this.list.Back())
+	}
+}
+
+func (this *LruCache) Remove(key string) error {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	if element, ok := this.items[key]; ok {
+		this.remove(element)
+	}
+	return nil
+}
+
+// RemoveIf removes all entries with a matching key
+func (this *LruCache) RemoveIf(match func(key string) bool) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	for key, element := range this.items {
+		if match(key) {
+			this.remove(element)
+		}
+	}
+}
+
+func (this *LruCache) remove(element *list.Element) {
+	this.list.Remove(element)
+	delete(this.items, element.Value.(*lruEntry).key)
+}
+
+func (this *LruCache) Reset() error {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	this.list.Init()
+	this.items = map[string]*list.Element{}
+	return nil
+}
+
+func (this *LruCache) Close() error {
+	return nil
+}
+
+func (this *LruCache) Len() int {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	return this.list.Len()
+}
+
+// WriteSnapshot writes the unexpired entries as json, ordered from least to most recently used
+func (this *LruCache) WriteSnapshot(w io.Writer) error {
+	this.mux.Lock()
+	entries := make([]*lruEntry, 0, this.list.Len())
+	for element := this.list.Back(); element != nil; element = element.Prev() {
+		entries = append(entries, element.Value.(*lruEntry))
+	}
+	this.mux.Unlock()
+	now := time.Now()
+	snapshot := make([]snapshotEntry, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.expires.After(now) {
+			continue
+		}
+		value, err := json.Marshal(entry.value)
+		if err != nil {
+			return err
+		}
+		snapshot = append(snapshot, snapshotEntry{Key: entry.key, Value: value, Expires: entry.expires})
+	}
+	return json.NewEncoder(w).Encode(snapshot)
+}
+
+// ReadSnapshot adds the unexpired entries of a snapshot created by WriteSnapshot;
+// the values are stored as json and are unmarshalled to the requested type on read
+func (this *LruCache) ReadSnapshot(r io.Reader) error {
+	snapshot := []snapshotEntry{}
+	err := json.NewDecoder(r).Decode(&snapshot)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, entry := range snapshot {
+		if entry.Expires.After(now) {
+			this.set(&lruEntry{key: entry.Key, value: []byte(entry.Value), resultType: interfaces.JsonByteArray, expires: entry.Expires})
+		}
+	}
+	return nil
+}
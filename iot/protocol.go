@@ -1,6 +1,7 @@
 package iot
 
 import (
+	"context"
 	"encoding/json"
 	"net/url"
 	"time"
@@ -11,9 +12,17 @@ import (
 )
 
 func (this *Iot) GetProtocol(id string, token security.JwtToken) (protocol model.Protocol, err error) {
+	return this.GetProtocolCtx(context.Background(), id, token)
+}
+
+func (this *Iot) GetProtocolCtx(ctx context.Context, id string, token security.JwtToken) (protocol model.Protocol, err error) {
+	if err = this.acquire(ctx); err != nil {
+		return protocol, err
+	}
+	defer func() { this.release(err) }()
 	start := time.Now()
-	defer statistics.IotRead(time.Since(start))
-	resp, err := token.Get(this.repo_url + "/protocols/" + url.QueryEscape(id))
+	defer func() { statistics.IotRead(time.Since(start)) }()
+	resp, err := token.GetCtx(ctx, this.repo_url+"/protocols/"+url.QueryEscape(id))
 	if err != nil {
 		this.GetLogger().Error("unable to get protocol", "error", err, "id", id)
 		return protocol, err
@@ -0,0 +1,164 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type messageReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// offsetTracker commits the offset of a partition only after all earlier fetched messages of this partition are done.
+// like in sequential consumption, a failed message is not committed itself but is skipped by the commit of a later message.
+type offsetTracker struct {
+	mux        sync.Mutex
+	partitions map[int][]*trackedMessage
+}
+
+type trackedMessage struct {
+	msg    kafka.Message
+	done   bool
+	failed bool
+}
+
+func (this *offsetTracker) add(msg kafka.Message) *trackedMessage {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	result := &trackedMessage{msg: msg}
+	this.partitions[msg.Partition] = append(this.partitions[msg.Partition], result)
+	return result
+}
+
+// done marks the message as done and returns the message up to which the partition may be committed
+func (this *offsetTracker) done(message *trackedMessage, failed bool) (commit *kafka.Message) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	message.done = true
+	message.failed = failed
+	pending := this.partitions[message.msg.Partition]
+	for len(pending) > 0 && pending[0].done {
+		if !pending[0].failed {
+			commit = &pending[0].msg
+		}
+		pending = pending[1:]
+	}
+	this.partitions[message.msg.Partition] = pending
+	return commit
+}
+
+// consumeConcurrently distributes messages by key to config.Concurrency workers.
+// messages with the same key are handled by the same worker, in the order they were fetched.
+func (this *Consumer) consumeConcurrently(ctx context.Context, r messageReader, listener func(topic string, msg []byte, time time.Time) error) (fetched bool, err error) {
+	config := this.config
+	logger := this.logger
+	buffer := config.ConcurrencyBuffer
+	if buffer <= 0 {
+		buffer = 10
+	}
+	fetchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	//commits of messages which are handled after ctx is done should still be possible
+	commitCtx := context.WithoutCancel(ctx)
+
+	errMux := sync.Mutex{}
+	var workerErr error
+	fail := func(err error) {
+		errMux.Lock()
+		defer errMux.Unlock()
+		if workerErr == nil {
+			workerErr = err
+		}
+		cancel()
+	}
+
+	tracker := &offsetTracker{partitions: map[int][]*trackedMessage{}}
+	wg := sync.WaitGroup{}
+	workers := make([]chan *trackedMessage, config.Concurrency)
+	for i := range workers {
+		workers[i] = make(chan *trackedMessage, buffer)
+		wg.Add(1)
+		go func(queue chan *trackedMessage) {
+			defer wg.Done()
+			for message := range queue {
+				if fetchCtx.Err() != nil {
+					continue //queued messages are neither handled nor committed after ctx is done
+				}
+				m := message.msg
+				failed := false
+				if !config.AllowOldMessages && time.Since(m.Time) > 1*time.Hour { //floodgate to prevent old messages to DOS the consumer
+					logger.Warn("kafka message older than 1h", "topic", config.Topic, "age", time.Since(m.Time))
+				} else if err := listener(m.Topic, m.Value, m.Time); err != nil {
+					logger.Error("unable to handle message (no commit)", "topic", config.Topic, "partition", m.Partition, "offset", m.Offset, "error", err)
+					failed = true
+				}
+				if commit := tracker.done(message, failed); commit != nil {
+					if err := r.CommitMessages(commitCtx, *commit); err != nil {
+						logger.Error("unable to commit message consumption", "topic", config.Topic, "error", err)
+						fail(err)
+					}
+				}
+			}
+		}(workers[i])
+	}
+	defer func() {
+		for _, queue := range workers {
+			close(queue)
+		}
+		wg.Wait()
+		errMux.Lock()
+		defer errMux.Unlock()
+		if err == nil {
+			err = workerErr
+		}
+	}()
+
+	for {
+		m, err := r.FetchMessage(fetchCtx)
+		if err == io.EOF || errors.Is(err, context.Canceled) {
+			logger.Info("kafka consumer closed", "topic", config.Topic)
+			return fetched, nil
+		}
+		if err != nil {
+			logger.Error("while consuming topic", "topic", config.Topic, "error", err)
+			return fetched, err
+		}
+		fetched = true
+		message := tracker.add(m)
+		select {
+		case workers[workerIndex(m.Key, len(workers))] <- message:
+		case <-fetchCtx.Done():
+			return fetched, nil
+		}
+	}
+}
+
+func workerIndex(key []byte, workers int) int {
+	h := fnv.New32a()
+	h.Write(key)
+	return int(h.Sum32() % uint32(workers))
+}
@@ -0,0 +1,170 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type readerMock struct {
+	mux       sync.Mutex
+	messages  []kafka.Message
+	committed map[int]int64
+}
+
+func (this *readerMock) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	if len(this.messages) == 0 {
+		return kafka.Message{}, io.EOF
+	}
+	result := this.messages[0]
+	this.messages = this.messages[1:]
+	return result, nil
+}
+
+func (this *readerMock) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	for _, m := range msgs {
+		if m.Offset < this.committed[m.Partition] {
+			panic("commit of older offset")
+		}
+		this.committed[m.Partition] = m.Offset
+	}
+	return nil
+}
+
+func TestConsumeConcurrently(t *testing.T) {
+	reader := &readerMock{committed: map[int]int64{}}
+	for i := 0; i < 100; i++ {
+		reader.messages = append(reader.messages, kafka.Message{
+			Topic:     "test",
+			Partition: i % 2,
+			Offset:    int64(i),
+			Key:       []byte("device_" + strconv.Itoa(i%5)),
+			Value:     []byte(strconv.Itoa(i)),
+			Time:      time.Now(),
+		})
+	}
+
+	mux := sync.Mutex{}
+	handled := map[string][]int{}
+	consumer := &Consumer{config: ConsumerConfig{Concurrency: 3}, logger: slog.Default()}
+	_, err := consumer.consumeConcurrently(context.Background(), reader, func(topic string, msg []byte, t time.Time) error {
+		i, _ := strconv.Atoi(string(msg))
+		if i%5 == 0 {
+			time.Sleep(time.Millisecond) //slow device
+		}
+		mux.Lock()
+		defer mux.Unlock()
+		key := "device_" + strconv.Itoa(i%5)
+		handled[key] = append(handled[key], i)
+		return nil
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for key, list := range handled {
+		if len(list) != 20 {
+			t.Error(key, list)
+		}
+		for i := 1; i < len(list); i++ {
+			if list[i] < list[i-1] {
+				t.Error("unordered", key, list)
+			}
+		}
+	}
+	if reader.committed[0] != 98 || reader.committed[1] != 99 {
+		t.Error(reader.committed)
+	}
+}
+
+func TestConsumeConcurrentlyFailure(t *testing.T) {
+	reader := &readerMock{committed: map[int]int64{}}
+	for i := 0; i < 20; i++ {
+		reader.messages = append(reader.messages, kafka.Message{
+			Topic:     "test",
+			Partition: i % 2,
+			Offset:    int64(i),
+			Key:       []byte("device_" + strconv.Itoa(i%4)),
+			Value:     []byte(strconv.Itoa(i)),
+			Time:      time.Now(),
+		})
+	}
+	consumer := &Consumer{config: ConsumerConfig{Concurrency: 3}, logger: slog.Default()}
+	_, err := consumer.consumeConcurrently(context.Background(), reader, func(topic string, msg []byte, t time.Time) error {
+		if string(msg) == "7" {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	//the failed message does not hold the commits of later messages on its partition
+	if reader.committed[0] != 18 || reader.committed[1] != 19 {
+		t.Error(reader.committed)
+	}
+}
+
+func TestOffsetTrackerFailure(t *testing.T) {
+	tracker := &offsetTracker{partitions: map[int][]*trackedMessage{}}
+	m1 := tracker.add(kafka.Message{Offset: 1})
+	m2 := tracker.add(kafka.Message{Offset: 2})
+	m3 := tracker.add(kafka.Message{Offset: 3})
+	if commit := tracker.done(m2, false); commit != nil {
+		t.Error("unexpected commit before earlier message is done", commit.Offset)
+	}
+	commit := tracker.done(m1, true)
+	if commit == nil || commit.Offset != 2 {
+		t.Error("expected commit of offset 2 after failed message", commit)
+	}
+	if commit := tracker.done(m3, true); commit != nil {
+		t.Error("unexpected commit of failed message", commit.Offset)
+	}
+	if len(tracker.partitions[0]) != 0 {
+		t.Error(len(tracker.partitions[0]))
+	}
+}
+
+func TestConsumeConcurrentlyCancel(t *testing.T) {
+	reader := &readerMock{committed: map[int]int64{}}
+	for i := 0; i < 20; i++ {
+		reader.messages = append(reader.messages, kafka.Message{
+			Topic:  "test",
+			Offset: int64(i + 1),
+			Key:    []byte("device"),
+			Value:  []byte(strconv.Itoa(i + 1)),
+			Time:   time.Now(),
+		})
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handled := 0
+	consumer := &Consumer{config: ConsumerConfig{Concurrency: 2, ConcurrencyBuffer: 20}, logger: slog.Default()}
+	_, err := consumer.consumeConcurrently(ctx, reader, func(topic string, msg []byte, t time.Time) error {
+		handled++
+		if handled == 1 {
+			time.Sleep(50 * time.Millisecond) //other messages are queued
+			cancel()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if handled != 1 || reader.committed[0] != 1 {
+		t.Error(handled, reader.committed)
+	}
+}
@@ -22,8 +22,11 @@ import (
 	"io"
 	"log"
 	"log/slog"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/SENERGY-Platform/platform-connector-lib/statistics"
 	"github.com/segmentio/kafka-go"
 )
 
@@ -38,6 +41,15 @@ type ConsumerConfig struct {
 	TopicConfigMap   map[string][]kafka.ConfigEntry
 	AllowOldMessages bool
 	Logger           *slog.Logger
+	Wg               *sync.WaitGroup //optional; done when the consumer is closed
+
+	DisableReconnect        bool          //if true, the consumer stops and calls the errorhandler on the first error
+	MaxReconnects           int           //optional; 0 means unlimited; the errorhandler is called, if the consumer gives up
+	ReconnectInitialBackoff time.Duration //optional; default 1s
+	ReconnectMaxBackoff     time.Duration //optional; default 1m
+
+	Concurrency       int //optional; number of parallel listener calls; messages with the same key are handled in order; 0 or 1 handles all messages sequentially
+	ConcurrencyBuffer int //optional; number of queued messages per worker; default 10
 }
 
 func (this *ConsumerConfig) GetLogger() *slog.Logger {
@@ -47,16 +59,110 @@ func (this *ConsumerConfig) GetLogger() *slog.Logger {
 	return this.Logger
 }
 
+type ConsumerState string
+
+const (
+	ConsumerRunning      ConsumerState = "running"
+	ConsumerReconnecting ConsumerState = "reconnecting"
+	ConsumerStopped      ConsumerState = "stopped"
+)
+
+// Consumer recreates its kafka reader with exponential backoff, if fetching or committing fails
+type Consumer struct {
+	config     ConsumerConfig
+	logger     *slog.Logger
+	state      atomic.Value
+	reconnects atomic.Int64
+}
+
 func NewConsumer(ctx context.Context, config ConsumerConfig, listener func(topic string, msg []byte, time time.Time) error, errorhandler func(err error)) (err error) {
+	_, err = StartConsumer(ctx, config, listener, errorhandler)
+	return err
+}
+
+// StartConsumer consumes config.Topic until ctx is done; the errorhandler is called if the consumer gives up reconnecting
+func StartConsumer(ctx context.Context, config ConsumerConfig, listener func(topic string, msg []byte, time time.Time) error, errorhandler func(err error)) (consumer *Consumer, err error) {
 	logger := config.GetLogger()
 	logger.Info("start kafka consumer", "topic", config.Topic)
 	if config.InitTopic {
 		err = InitTopic(config.KafkaUrl, config.TopicConfigMap, config.Topic)
 		if err != nil {
 			logger.Error("unable to create topic", "topic", config.Topic, "error", err)
-			return err
+			return nil, err
 		}
 	}
+	if config.ReconnectInitialBackoff <= 0 {
+		config.ReconnectInitialBackoff = time.Second
+	}
+	if config.ReconnectMaxBackoff <= 0 {
+		config.ReconnectMaxBackoff = time.Minute
+	}
+	consumer = &Consumer{config: config, logger: logger}
+	consumer.setState(ConsumerRunning)
+	if config.Wg != nil {
+		config.Wg.Add(1)
+	}
+	go func() {
+		defer func() {
+			consumer.setState(ConsumerStopped)
+			if config.Wg != nil {
+				config.Wg.Done()
+			}
+		}()
+		backoff := config.ReconnectInitialBackoff
+		attempts := 0
+		for {
+			fetched, err := consumer.consume(ctx, listener)
+			if err == nil || ctx.Err() != nil {
+				return
+			}
+			if fetched {
+				backoff = config.ReconnectInitialBackoff
+				attempts = 0
+			}
+			if config.DisableReconnect || (config.MaxReconnects > 0 && attempts >= config.MaxReconnects) {
+				consumer.setState(ConsumerStopped)
+				errorhandler(err)
+				return
+			}
+			consumer.setState(ConsumerReconnecting)
+			logger.Warn("reconnect kafka consumer", "topic", config.Topic, "error", err, "backoff", backoff)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, config.ReconnectMaxBackoff)
+			attempts++
+			consumer.reconnects.Add(1)
+			statistics.KafkaConsumerReconnect(config.Topic)
+			consumer.setState(ConsumerRunning)
+		}
+	}()
+	return consumer, nil
+}
+
+func (this *Consumer) State() ConsumerState {
+	return this.state.Load().(ConsumerState)
+}
+
+func (this *Consumer) Reconnects() int64 {
+	return this.reconnects.Load()
+}
+
+func (this *Consumer) Topic() string {
+	return this.config.Topic
+}
+
+func (this *Consumer) setState(state ConsumerState) {
+	this.state.Store(state)
+	statistics.KafkaConsumerState(this.config.Topic, string(state))
+}
+
+// consume returns nil if ctx is done or the reader is closed; fetched is true if at least one message has been fetched
+func (this *Consumer) consume(ctx context.Context, listener func(topic string, msg []byte, time time.Time) error) (fetched bool, err error) {
+	config := this.config
+	logger := this.logger
 	kafkaLogger := slog.NewLogLogger(logger.Handler(), slog.LevelError)
 	kafkaLogger.SetPrefix("[KAFKA-ERR] ")
 	r := kafka.NewReader(kafka.ReaderConfig{
@@ -72,48 +178,46 @@ func NewConsumer(ctx context.Context, config ConsumerConfig, listener func(topic
 		WatchPartitionChanges:  true,
 		PartitionWatchInterval: time.Minute,
 	})
-	go func() {
-		defer func() {
-			logger.Info("close kafka consumer", "topic", config.Topic, "result", r.Close())
-		}()
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			default:
-				m, err := r.FetchMessage(ctx)
-				if err == io.EOF || errors.Is(err, context.Canceled) {
-					logger.Info("kafka consumer closed", "topic", config.Topic)
-					return
-				}
+	defer func() {
+		logger.Info("close kafka consumer", "topic", config.Topic, "result", r.Close())
+	}()
+	if config.Concurrency > 1 {
+		return this.consumeConcurrently(ctx, r, listener)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return fetched, nil
+		default:
+			m, err := r.FetchMessage(ctx)
+			if err == io.EOF || errors.Is(err, context.Canceled) {
+				logger.Info("kafka consumer closed", "topic", config.Topic)
+				return fetched, nil
+			}
+			if err != nil {
+				logger.Error("while consuming topic", "topic", config.Topic, "error", err)
+				return fetched, err
+			}
+			fetched = true
+			if !config.AllowOldMessages && time.Now().Sub(m.Time) > 1*time.Hour { //floodgate to prevent old messages to DOS the consumer
+				logger.Warn("kafka message older than 1h", "topic", config.Topic, "age", time.Now().Sub(m.Time))
+				err = r.CommitMessages(ctx, m)
 				if err != nil {
-					logger.Error("while consuming topic", "topic", config.Topic, "error", err)
-					errorhandler(err)
-					return
+					logger.Error("unable to commit message consumption", "topic", config.Topic, "error", err)
+					return fetched, err
 				}
-				if !config.AllowOldMessages && time.Now().Sub(m.Time) > 1*time.Hour { //floodgate to prevent old messages to DOS the consumer
-					logger.Warn("kafka message older than 1h", "topic", config.Topic, "age", time.Now().Sub(m.Time))
+			} else {
+				err = listener(m.Topic, m.Value, m.Time)
+				if err != nil {
+					logger.Error("unable to handle message (no commit)", "topic", config.Topic, "error", err)
+				} else {
 					err = r.CommitMessages(ctx, m)
 					if err != nil {
 						logger.Error("unable to commit message consumption", "topic", config.Topic, "error", err)
-						errorhandler(err)
-						return
-					}
-				} else {
-					err = listener(m.Topic, m.Value, m.Time)
-					if err != nil {
-						logger.Error("unable to handle message (no commit)", "topic", config.Topic, "error", err)
-					} else {
-						err = r.CommitMessages(ctx, m)
-						if err != nil {
-							logger.Error("unable to commit message consumption", "topic", config.Topic, "error", err)
-							errorhandler(err)
-							return
-						}
+						return fetched, err
 					}
 				}
 			}
 		}
-	}()
-	return err
+	}
 }
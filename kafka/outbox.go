@@ -0,0 +1,394 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SENERGY-Platform/platform-connector-lib/statistics"
+)
+
+var ErrOutboxFull = errors.New("kafka outbox full")
+
+type OutboxConfig struct {
+	Dir           string
+	MaxBytes      int64         //optional; 0 means unlimited
+	MaxAge        time.Duration //optional; older messages are dropped instead of replayed; 0 means unlimited
+	RetryInterval time.Duration //optional; default 5s
+}
+
+// Outbox is a ProducerInterface which persists messages that could not be produced
+// and replays them in order, once the broker is reachable again.
+// while the outbox is not empty, new messages are appended to the outbox to preserve their order.
+// a message, which could not be produced but is stored in the outbox, is reported as successfully produced (nil error);
+// an error is only returned if the message could not be stored either.
+// with an AsyncProducer, a replayed message is removed from the outbox as soon as the producer accepts it;
+// if its delivery fails later, it is appended to the end of the outbox again, so the order is only preserved for sync producers.
+type Outbox struct {
+	producer ProducerInterface
+	config   OutboxConfig
+	logger   *slog.Logger
+	name     string
+
+	produceMux sync.Mutex //held across the backlog check and the direct send, to prevent messages from overtaking stored ones
+
+	mux    sync.Mutex
+	file   *os.File
+	offset int64 //byte offset of the first pending entry
+	size   int64 //byte size of the data file
+	count  int   //number of pending entries
+
+	trigger   chan struct{}
+	stop      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+}
+
+type outboxEntry struct {
+	Topic     string    `json:"topic"`
+	Key       *string   `json:"key,omitempty"`
+	Value     string    `json:"value"`
+	Timestamp time.Time `json:"timestamp"`
+	Stored    time.Time `json:"stored"`
+}
+
+const outboxDataFile = "outbox.log"
+const outboxOffsetFile = "outbox.offset"
+
+func NewOutbox(config OutboxConfig, logger *slog.Logger) (result *Outbox, err error) {
+	if config.RetryInterval <= 0 {
+		config.RetryInterval = 5 * time.Second
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	err = os.MkdirAll(config.Dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+	result = &Outbox{
+		config:  config,
+		logger:  logger,
+		name:    filepath.Base(config.Dir),
+		trigger: make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	result.file, err = os.OpenFile(filepath.Join(config.Dir, outboxDataFile), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	err = result.load()
+	if err != nil {
+		result.file.Close()
+		return nil, err
+	}
+	result.updateStatistics()
+	return result, nil
+}
+
+// Start uses producer to produce and replay messages until ctx is done
+func (this *Outbox) Start(ctx context.Context, producer ProducerInterface) {
+	this.producer = producer
+	go func() {
+		ticker := time.NewTicker(this.config.RetryInterval)
+		defer ticker.Stop()
+		defer close(this.stopped)
+		defer func() {
+			//the wrapped producer may pass undelivered messages to Store() while it is closed; the file has to stay open until it is done
+			this.closeProducer()
+			this.mux.Lock()
+			defer this.mux.Unlock()
+			this.file.Close()
+		}()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-this.stop:
+				return
+			case <-ticker.C:
+			case <-this.trigger:
+			}
+			this.replay(ctx)
+		}
+	}()
+}
+
+// Close closes the wrapped producer and the outbox file; messages, which the producer fails to flush, remain in the outbox.
+func (this *Outbox) Close() (err error) {
+	err = this.closeProducer()
+	this.closeOnce.Do(func() {
+		close(this.stop)
+	})
+	if this.producer == nil {
+		return errors.Join(err, this.file.Close())
+	}
+	<-this.stopped
+	return err
+}
+
+func (this *Outbox) closeProducer() error {
+	if closer, ok := this.producer.(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Backlog returns the number of pending messages
+func (this *Outbox) Backlog() int {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	return this.count
+}
+
+// Store persists a message which could not be produced; may be used as Config.AsyncErrorHandler
+func (this *Outbox) Store(message Message, hasKey bool) error {
+	entry := outboxEntry{Topic: message.Topic, Value: message.Value, Timestamp: message.Timestamp, Stored: time.Now()}
+	if hasKey {
+		entry.Key = &message.Key
+	}
+	return this.append(entry)
+}
+
+func (this *Outbox) Produce(topic string, message string) (err error) {
+	return this.produce(context.Background(), Message{Topic: topic, Value: message, Timestamp: time.Now()}, false)
+}
+
+func (this *Outbox) ProduceWithKey(topic string, message string, key string) (err error) {
+	return this.produce(context.Background(), Message{Topic: topic, Value: message, Key: key, Timestamp: time.Now()}, true)
+}
+
+func (this *Outbox) ProduceWithTimestamp(topic string, message string, key string, timestamp time.Time) (err error) {
+	return this.produce(context.Background(), Message{Topic: topic, Value: message, Key: key, Timestamp: timestamp}, true)
+}
+
+func (this *Outbox) ProduceWithTimestampCtx(ctx context.Context, topic string, message string, key string, timestamp time.Time) (err error) {
+	return this.produce(ctx, Message{Topic: topic, Value: message, Key: key, Timestamp: timestamp}, true)
+}
+
+func (this *Outbox) ProduceBatchCtx(ctx context.Context, messages []Message) (errs []error) {
+	errs = make([]error, len(messages))
+	this.produceMux.Lock()
+	defer this.produceMux.Unlock()
+	if this.Backlog() > 0 {
+		for i, message := range messages {
+			errs[i] = this.Store(message, true)
+		}
+		return errs
+	}
+	for i, err := range ProduceBatchCtx(ctx, this.producer, messages) {
+		if err != nil {
+			this.logger.Warn("unable to produce message; store in outbox", "error", err, "topic", messages[i].Topic)
+			errs[i] = this.Store(messages[i], true)
+		}
+	}
+	this.notify()
+	return errs
+}
+
+// produce returns nil if the message is produced or stored in the outbox
+func (this *Outbox) produce(ctx context.Context, message Message, hasKey bool) error {
+	this.produceMux.Lock()
+	defer this.produceMux.Unlock()
+	if this.Backlog() > 0 {
+		return this.Store(message, hasKey)
+	}
+	err := this.send(ctx, message, hasKey)
+	if err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		this.logger.Warn("unable to produce message; store in outbox", "error", err, "topic", message.Topic)
+		err = this.Store(message, hasKey)
+		this.notify()
+	}
+	return err
+}
+
+func (this *Outbox) send(ctx context.Context, message Message, hasKey bool) error {
+	if !hasKey {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return this.producer.Produce(message.Topic, message.Value)
+	}
+	return ProduceWithTimestampCtx(ctx, this.producer, message.Topic, message.Value, message.Key, message.Timestamp)
+}
+
+func (this *Outbox) notify() {
+	select {
+	case this.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (this *Outbox) replay(ctx context.Context) {
+	for ctx.Err() == nil {
+		entry, next, ok, err := this.peek()
+		if err != nil {
+			this.logger.Error("unable to read kafka outbox", "error", err, "outbox", this.name)
+			return
+		}
+		if !ok {
+			return
+		}
+		if entry.Topic == "" {
+			this.logger.Warn("drop invalid kafka outbox entry", "outbox", this.name)
+			statistics.KafkaOutboxDropped(this.name, "invalid")
+		} else if this.config.MaxAge > 0 && time.Since(entry.Stored) > this.config.MaxAge {
+			this.logger.Warn("drop expired kafka outbox entry", "outbox", this.name, "topic", entry.Topic, "age", time.Since(entry.Stored))
+			statistics.KafkaOutboxDropped(this.name, "expired")
+		} else {
+			message := Message{Topic: entry.Topic, Value: entry.Value, Timestamp: entry.Timestamp}
+			if entry.Key != nil {
+				message.Key = *entry.Key
+			}
+			err = this.send(ctx, message, entry.Key != nil)
+			if err != nil {
+				this.logger.Warn("unable to replay kafka outbox", "error", err, "outbox", this.name, "backlog", this.Backlog())
+				return
+			}
+		}
+		err = this.commit(next)
+		if err != nil {
+			this.logger.Error("unable to commit kafka outbox offset", "error", err, "outbox", this.name)
+			return
+		}
+	}
+}
+
+func (this *Outbox) append(entry outboxEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	if this.config.MaxBytes > 0 && this.size-this.offset+int64(len(line)) > this.config.MaxBytes {
+		statistics.KafkaOutboxDropped(this.name, "full")
+		return ErrOutboxFull
+	}
+	_, err = this.file.Write(line)
+	if err != nil {
+		return err
+	}
+	err = this.file.Sync()
+	if err != nil {
+		return err
+	}
+	this.size = this.size + int64(len(line))
+	this.count++
+	this.updateStatisticsLocked()
+	return nil
+}
+
+// peek returns the first pending entry and the offset after it
+func (this *Outbox) peek() (entry outboxEntry, next int64, ok bool, err error) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	if this.count == 0 {
+		return entry, next, false, nil
+	}
+	reader := bufio.NewReader(io.NewSectionReader(this.file, this.offset, this.size-this.offset))
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		return entry, next, false, err
+	}
+	next = this.offset + int64(len(line))
+	if json.Unmarshal(line, &entry) != nil {
+		entry = outboxEntry{} //invalid entries are dropped by replay()
+	}
+	return entry, next, true, nil
+}
+
+func (this *Outbox) commit(offset int64) (err error) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	this.count--
+	this.offset = offset
+	if this.count == 0 {
+		//everything is replayed; start with an empty file
+		err = this.file.Truncate(0)
+		if err != nil {
+			return err
+		}
+		this.offset = 0
+		this.size = 0
+	}
+	this.updateStatisticsLocked()
+	temp := filepath.Join(this.config.Dir, outboxOffsetFile+".tmp")
+	err = os.WriteFile(temp, []byte(strconv.FormatInt(this.offset, 10)), 0o644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(temp, filepath.Join(this.config.Dir, outboxOffsetFile))
+}
+
+func (this *Outbox) load() error {
+	info, err := this.file.Stat()
+	if err != nil {
+		return err
+	}
+	this.size = info.Size()
+	offset, err := os.ReadFile(filepath.Join(this.config.Dir, outboxOffsetFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		this.offset, err = strconv.ParseInt(strings.TrimSpace(string(offset)), 10, 64)
+		if err != nil || this.offset > this.size {
+			this.logger.Warn("invalid kafka outbox offset; replay complete outbox", "outbox", this.name)
+			this.offset = 0
+		}
+	}
+	reader := bufio.NewReader(io.NewSectionReader(this.file, this.offset, this.size-this.offset))
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 && line[len(line)-1] == '\n' {
+			this.count++
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (this *Outbox) updateStatistics() {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	this.updateStatisticsLocked()
+}
+
+func (this *Outbox) updateStatisticsLocked() {
+	statistics.KafkaOutboxBacklog(this.name, this.count, this.size-this.offset)
+}
@@ -0,0 +1,194 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type producerMock struct {
+	mux      sync.Mutex
+	fail     bool
+	produced []string
+}
+
+func (this *producerMock) Produce(topic string, message string) (err error) {
+	return this.ProduceWithTimestampCtx(context.Background(), topic, message, "", time.Now())
+}
+
+func (this *producerMock) ProduceWithKey(topic string, message string, key string) (err error) {
+	return this.ProduceWithTimestampCtx(context.Background(), topic, message, key, time.Now())
+}
+
+func (this *producerMock) ProduceWithTimestamp(topic string, message string, key string, timestamp time.Time) (err error) {
+	return this.ProduceWithTimestampCtx(context.Background(), topic, message, key, timestamp)
+}
+
+func (this *producerMock) ProduceWithTimestampCtx(ctx context.Context, topic string, message string, key string, timestamp time.Time) (err error) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	if this.fail {
+		return errors.New("broker unavailable")
+	}
+	this.produced = append(this.produced, message)
+	return nil
+}
+
+func (this *producerMock) ProduceBatchCtx(ctx context.Context, messages []Message) (errs []error) {
+	for _, m := range messages {
+		errs = append(errs, this.ProduceWithTimestampCtx(ctx, m.Topic, m.Value, m.Key, m.Timestamp))
+	}
+	return errs
+}
+
+func (this *producerMock) setFail(fail bool) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	this.fail = fail
+}
+
+func (this *producerMock) getProduced() []string {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	return append([]string{}, this.produced...)
+}
+
+func TestOutbox(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mock := &producerMock{}
+	outbox, err := NewOutbox(OutboxConfig{Dir: dir, MaxBytes: 1000, RetryInterval: time.Hour}, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	outbox.Start(ctx, mock)
+
+	err = outbox.ProduceWithKey("test", "1", "key")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	mock.setFail(true)
+	for _, msg := range []string{"2", "3"} {
+		err = outbox.ProduceWithKey("test", msg, "key")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	mock.setFail(false)
+	//backlog is not empty; new messages have to wait for older ones
+	err = outbox.ProduceWithKey("test", "4", "key")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if outbox.Backlog() != 3 {
+		t.Error(outbox.Backlog())
+		return
+	}
+
+	//persisted backlog survives restarts
+	cancel()
+	time.Sleep(100 * time.Millisecond)
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	outbox, err = NewOutbox(OutboxConfig{Dir: dir, MaxBytes: 1000, RetryInterval: 100 * time.Millisecond}, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if outbox.Backlog() != 3 {
+		t.Error(outbox.Backlog())
+		return
+	}
+	outbox.Start(ctx, mock)
+	time.Sleep(500 * time.Millisecond)
+
+	if outbox.Backlog() != 0 {
+		t.Error(outbox.Backlog())
+	}
+	if !reflect.DeepEqual(mock.getProduced(), []string{"1", "2", "3", "4"}) {
+		t.Error(mock.getProduced())
+	}
+
+	mock.setFail(true)
+	large := string(make([]byte, 2000))
+	err = outbox.Produce("test", large)
+	if !errors.Is(err, ErrOutboxFull) {
+		t.Error(err)
+	}
+}
+
+func TestOutboxMaxAge(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mock := &producerMock{fail: true}
+	outbox, err := NewOutbox(OutboxConfig{Dir: t.TempDir(), MaxAge: 100 * time.Millisecond, RetryInterval: 50 * time.Millisecond}, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	outbox.Start(ctx, mock)
+	err = outbox.Produce("test", "1")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	time.Sleep(200 * time.Millisecond)
+	mock.setFail(false)
+	time.Sleep(200 * time.Millisecond)
+	if outbox.Backlog() != 0 {
+		t.Error(outbox.Backlog())
+	}
+	if len(mock.getProduced()) != 0 {
+		t.Error(mock.getProduced())
+	}
+}
+
+type closingProducerMock struct {
+	producerMock
+	onClose func()
+}
+
+func (this *closingProducerMock) Close() error {
+	time.Sleep(50 * time.Millisecond)
+	this.onClose()
+	return nil
+}
+
+func TestOutboxStoreOnClose(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	outbox, err := NewOutbox(OutboxConfig{Dir: dir, RetryInterval: time.Hour}, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	//like an AsyncProducer, which reports undelivered messages while it is flushed on close
+	mock := &closingProducerMock{onClose: func() {
+		err := outbox.Store(Message{Topic: "test", Value: "1"}, false)
+		if err != nil {
+			t.Error(err)
+		}
+	}}
+	outbox.Start(ctx, mock)
+	cancel()
+	time.Sleep(200 * time.Millisecond)
+
+	outbox, err = NewOutbox(OutboxConfig{Dir: dir, RetryInterval: time.Hour}, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if outbox.Backlog() != 1 {
+		t.Error(outbox.Backlog())
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"errors"
 	"log"
 	"log/slog"
+	"sync"
 	"time"
 
 	"github.com/IBM/sarama"
@@ -28,6 +29,7 @@ import (
 )
 
 var Fatal = false
+var ErrProducerClosed = errors.New("producer closed")
 var SlowProducerTimeout time.Duration = 2 * time.Second
 
 type ProducerInterface interface {
@@ -36,6 +38,49 @@ type ProducerInterface interface {
 	ProduceWithTimestamp(topic string, message string, key string, timestamp time.Time) (err error)
 }
 
+// ContextProducer is an optional ProducerInterface extension; implemented by SyncProducer, AsyncProducer and Outbox
+type ContextProducer interface {
+	ProduceWithTimestampCtx(ctx context.Context, topic string, message string, key string, timestamp time.Time) (err error)
+}
+
+// ProduceWithTimestampCtx uses ContextProducer if implemented by producer;
+// otherwise ctx is only checked before ProducerInterface.ProduceWithTimestamp is called
+func ProduceWithTimestampCtx(ctx context.Context, producer ProducerInterface, topic string, message string, key string, timestamp time.Time) error {
+	if ctxProducer, ok := producer.(ContextProducer); ok {
+		return ctxProducer.ProduceWithTimestampCtx(ctx, topic, message, key, timestamp)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return producer.ProduceWithTimestamp(topic, message, key, timestamp)
+}
+
+// BatchProducer is an optional ProducerInterface extension; implemented by SyncProducer, AsyncProducer and Outbox
+type BatchProducer interface {
+	// ProduceBatchCtx returns one error per message; a nil entry marks a successfully produced message
+	ProduceBatchCtx(ctx context.Context, messages []Message) (errs []error)
+}
+
+// ProduceBatchCtx uses BatchProducer if implemented by producer;
+// otherwise the messages are produced one by one with ProduceWithTimestampCtx
+func ProduceBatchCtx(ctx context.Context, producer ProducerInterface, messages []Message) (errs []error) {
+	if batchProducer, ok := producer.(BatchProducer); ok {
+		return batchProducer.ProduceBatchCtx(ctx, messages)
+	}
+	errs = make([]error, len(messages))
+	for i, message := range messages {
+		errs[i] = ProduceWithTimestampCtx(ctx, producer, message.Topic, message.Value, message.Key, message.Timestamp)
+	}
+	return errs
+}
+
+type Message struct {
+	Topic     string
+	Key       string
+	Value     string
+	Timestamp time.Time
+}
+
 type SyncProducer struct {
 	broker            []string
 	logger            *slog.Logger
@@ -47,7 +92,9 @@ type SyncProducer struct {
 	replicationFactor int
 	topicConfigMap    map[string][]kafka.ConfigEntry
 	initTopic         bool
+	closeMux          sync.RWMutex //read locked during produce calls; Close() waits for them to finish
 	isClosed          bool
+	closeOnce         sync.Once
 }
 
 type AsyncProducer struct {
@@ -60,7 +107,11 @@ type AsyncProducer struct {
 	replicationFactor int
 	topicConfigMap    map[string][]kafka.ConfigEntry
 	initTopic         bool
+	closeMux          sync.RWMutex //read locked during produce calls; AsyncClose() waits for them to finish
 	isClosed          bool
+	closeOnce         sync.Once
+	closing           chan struct{} //closed by Close(); interrupts produce calls blocked by a full input buffer
+	errorsDone        chan struct{}
 }
 
 type Config struct {
@@ -75,6 +126,12 @@ type Config struct {
 	TopicConfigMap      map[string][]kafka.ConfigEntry
 	InitTopics          bool
 	Logger              *slog.Logger
+
+	//optional; messages which could not be produced are persisted and replayed
+	Outbox *OutboxConfig
+
+	//optional; receives messages the async producer could not deliver; if nil (and no Outbox is used), errors are fatal
+	AsyncErrorHandler func(message Message, hasKey bool, err error)
 }
 
 func (this *Config) GetLogger() *slog.Logger {
@@ -92,6 +149,23 @@ func PrepareProducerWithConfig(ctx context.Context, kafkaBootstrapUrl string, co
 	if len(broker) == 0 {
 		return nil, errors.New("missing kafka broker")
 	}
+	var outbox *Outbox
+	if config.Outbox != nil {
+		outbox, err = NewOutbox(*config.Outbox, config.GetLogger())
+		if err != nil {
+			return nil, err
+		}
+		if config.AsyncErrorHandler == nil {
+			logger := config.GetLogger()
+			config.AsyncErrorHandler = func(message Message, hasKey bool, err error) {
+				logger.Warn("unable to produce message; store in outbox", "error", err, "topic", message.Topic)
+				err = outbox.Store(message, hasKey)
+				if err != nil {
+					logger.Error("unable to store message in outbox", "error", err, "topic", message.Topic)
+				}
+			}
+		}
+	}
 	if config.Sync {
 		temp := &SyncProducer{
 			broker:            broker,
@@ -121,8 +195,7 @@ func PrepareProducerWithConfig(ctx context.Context, kafkaBootstrapUrl string, co
 		result = temp
 		go func() {
 			<-ctx.Done()
-			temp.isClosed = true
-			temp.producer.Close()
+			temp.Close()
 		}()
 	} else {
 		temp := &AsyncProducer{
@@ -134,6 +207,8 @@ func PrepareProducerWithConfig(ctx context.Context, kafkaBootstrapUrl string, co
 			topicConfigMap:    config.TopicConfigMap,
 			initTopic:         config.InitTopics,
 			logger:            config.GetLogger(),
+			closing:           make(chan struct{}),
+			errorsDone:        make(chan struct{}),
 		}
 		sarama_conf := sarama.NewConfig()
 		sarama_conf.Version = sarama.V2_2_0_0
@@ -147,21 +222,92 @@ func PrepareProducerWithConfig(ctx context.Context, kafkaBootstrapUrl string, co
 			return result, err
 		}
 		go func() {
-			err, ok := <-temp.producer.Errors()
-			if ok {
-				log.Fatal(err)
+			defer close(temp.errorsDone)
+			for err := range temp.producer.Errors() {
+				if config.AsyncErrorHandler == nil {
+					log.Fatal(err)
+				}
+				message, hasKey := fromSaramaMessage(err.Msg)
+				config.AsyncErrorHandler(message, hasKey, err.Err)
 			}
 		}()
 		result = temp
 		go func() {
 			<-ctx.Done()
-			temp.isClosed = true
-			temp.producer.Close()
+			temp.Close()
 		}()
 	}
+	if outbox != nil {
+		outbox.Start(ctx, result)
+		result = outbox
+	}
 	return result, nil
 }
 
+// Close stops the producer; may be called multiple times
+func (this *SyncProducer) Close() (err error) {
+	this.closeOnce.Do(func() {
+		this.closeMux.Lock()
+		this.isClosed = true
+		this.closeMux.Unlock()
+		err = this.producer.Close()
+	})
+	return err
+}
+
+// Close flushes buffered messages and stops the producer; may be called multiple times.
+// messages which could not be delivered are passed to Config.AsyncErrorHandler.
+// produce calls waiting for space in the input buffer return ErrProducerClosed.
+func (this *AsyncProducer) Close() error {
+	this.closeOnce.Do(func() {
+		close(this.closing)
+		this.closeMux.Lock()
+		this.isClosed = true
+		this.closeMux.Unlock()
+		this.producer.AsyncClose()
+	})
+	<-this.errorsDone
+	return nil
+}
+
+// acquire read locks closeMux, if the producer is not closed; the caller has to release the lock
+func (this *SyncProducer) acquire() error {
+	this.closeMux.RLock()
+	if this.isClosed {
+		this.closeMux.RUnlock()
+		return ErrProducerClosed
+	}
+	return nil
+}
+
+// acquire read locks closeMux, if the producer is not closed; the caller has to release the lock
+func (this *AsyncProducer) acquire() error {
+	this.closeMux.RLock()
+	if this.isClosed {
+		this.closeMux.RUnlock()
+		return ErrProducerClosed
+	}
+	return nil
+}
+
+func fromSaramaMessage(msg *sarama.ProducerMessage) (result Message, hasKey bool) {
+	if msg == nil {
+		return result, false
+	}
+	result.Topic = msg.Topic
+	result.Timestamp = msg.Timestamp
+	if msg.Key != nil {
+		key, _ := msg.Key.Encode()
+		result.Key = string(key)
+		hasKey = true
+	}
+	if msg.Value != nil {
+		value, _ := msg.Value.Encode()
+		result.Value = string(value)
+	}
+	return result, hasKey
+}
+
 // deprecated
 func PrepareProducer(ctx context.Context, kafkaBootstrapUrl string, sync bool, syncIdempotent bool, partitionNum int, replicationFactor int, initTopics bool) (result ProducerInterface, err error) {
 	return PrepareProducerWithConfig(ctx, kafkaBootstrapUrl, Config{
@@ -178,9 +324,10 @@ func PrepareProducer(ctx context.Context, kafkaBootstrapUrl string, sync bool, s
 }
 
 func (this *SyncProducer) Produce(topic string, message string) (err error) {
-	if this.isClosed {
-		return errors.New("producer closed")
+	if err = this.acquire(); err != nil {
+		return err
 	}
+	defer this.closeMux.RUnlock()
 	this.logger.Debug("kafka produce sync", "topic", topic, "message", message)
 	if this.initTopic {
 		err = EnsureTopic(topic, this.kafkaBootstrapUrl, &this.usedTopics, this.topicConfigMap, this.partitionsNum, this.replicationFactor)
@@ -209,9 +356,10 @@ func (this *SyncProducer) Produce(topic string, message string) (err error) {
 }
 
 func (this *AsyncProducer) Produce(topic string, message string) (err error) {
-	if this.isClosed {
-		return errors.New("producer closed")
+	if err = this.acquire(); err != nil {
+		return err
 	}
+	defer this.closeMux.RUnlock()
 	this.logger.Debug("kafka produce async", "topic", topic, "message", message)
 	if this.initTopic {
 		err = EnsureTopic(topic, this.kafkaBootstrapUrl, &this.usedTopics, this.topicConfigMap, this.partitionsNum, this.replicationFactor)
@@ -220,8 +368,12 @@ func (this *AsyncProducer) Produce(topic string, message string) (err error) {
 			err = nil
 		}
 	}
-	this.producer.Input() <- &sarama.ProducerMessage{Topic: topic, Key: nil, Value: sarama.StringEncoder(message), Timestamp: time.Now()}
-	return
+	select {
+	case this.producer.Input() <- &sarama.ProducerMessage{Topic: topic, Key: nil, Value: sarama.StringEncoder(message), Timestamp: time.Now()}:
+		return nil
+	case <-this.closing:
+		return ErrProducerClosed
+	}
 }
 
 func (this *SyncProducer) ProduceWithKey(topic string, message string, key string) (err error) {
@@ -229,9 +381,16 @@ func (this *SyncProducer) ProduceWithKey(topic string, message string, key strin
 }
 
 func (this *SyncProducer) ProduceWithTimestamp(topic string, message string, key string, timestamp time.Time) (err error) {
-	if this.isClosed {
-		return errors.New("producer closed")
+	return this.ProduceWithTimestampCtx(context.Background(), topic, message, key, timestamp)
+}
+
+// ProduceWithTimestampCtx checks ctx before the message is handed to sarama.
+// the sarama sync producer can not be interrupted once the message is sent.
+func (this *SyncProducer) ProduceWithTimestampCtx(ctx context.Context, topic string, message string, key string, timestamp time.Time) (err error) {
+	if err = this.acquire(); err != nil {
+		return err
 	}
+	defer this.closeMux.RUnlock()
 	this.logger.Debug("kafka produce sync", "topic", topic, "message", message)
 	if this.initTopic {
 		err = EnsureTopic(topic, this.kafkaBootstrapUrl, &this.usedTopics, this.topicConfigMap, this.partitionsNum, this.replicationFactor)
@@ -240,6 +399,9 @@ func (this *SyncProducer) ProduceWithTimestamp(topic string, message string, key
 			err = nil
 		}
 	}
+	if err = ctx.Err(); err != nil {
+		return err
+	}
 	start := time.Now()
 	if SlowProducerTimeout > 0 {
 		ctx, cancel := context.WithTimeout(context.Background(), SlowProducerTimeout)
@@ -263,9 +425,15 @@ func (this *AsyncProducer) ProduceWithKey(topic string, message string, key stri
 }
 
 func (this *AsyncProducer) ProduceWithTimestamp(topic string, message string, key string, timestamp time.Time) (err error) {
-	if this.isClosed {
-		return errors.New("producer closed")
+	return this.ProduceWithTimestampCtx(context.Background(), topic, message, key, timestamp)
+}
+
+// ProduceWithTimestampCtx returns ctx.Err() if ctx is done before sarama accepts the message and ErrProducerClosed if the producer is closed meanwhile
+func (this *AsyncProducer) ProduceWithTimestampCtx(ctx context.Context, topic string, message string, key string, timestamp time.Time) (err error) {
+	if err = this.acquire(); err != nil {
+		return err
 	}
+	defer this.closeMux.RUnlock()
 	this.logger.Debug("kafka produce async", "topic", topic, "message", message)
 	if this.initTopic {
 		err = EnsureTopic(topic, this.kafkaBootstrapUrl, &this.usedTopics, this.topicConfigMap, this.partitionsNum, this.replicationFactor)
@@ -274,6 +442,88 @@ func (this *AsyncProducer) ProduceWithTimestamp(topic string, message string, ke
 			err = nil
 		}
 	}
-	this.producer.Input() <- &sarama.ProducerMessage{Topic: topic, Key: sarama.StringEncoder(key), Value: sarama.StringEncoder(message), Timestamp: timestamp}
-	return
+	select {
+	case this.producer.Input() <- &sarama.ProducerMessage{Topic: topic, Key: sarama.StringEncoder(key), Value: sarama.StringEncoder(message), Timestamp: timestamp}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-this.closing:
+		return ErrProducerClosed
+	}
+}
+
+func (this *SyncProducer) ProduceBatchCtx(ctx context.Context, messages []Message) (errs []error) {
+	errs = make([]error, len(messages))
+	if err := this.acquire(); err != nil {
+		return fillErrors(errs, err)
+	}
+	defer this.closeMux.RUnlock()
+	if err := ctx.Err(); err != nil {
+		return fillErrors(errs, err)
+	}
+	this.logger.Debug("kafka produce sync batch", "size", len(messages))
+	saramaMessages := make([]*sarama.ProducerMessage, len(messages))
+	index := map[*sarama.ProducerMessage]int{}
+	for i, m := range messages {
+		if this.initTopic {
+			err := EnsureTopic(m.Topic, this.kafkaBootstrapUrl, &this.usedTopics, this.topicConfigMap, this.partitionsNum, this.replicationFactor)
+			if err != nil {
+				this.logger.Warn("unable to ensure topic", "error", err)
+			}
+		}
+		saramaMessages[i] = &sarama.ProducerMessage{Topic: m.Topic, Key: sarama.StringEncoder(m.Key), Value: sarama.StringEncoder(m.Value), Timestamp: m.Timestamp}
+		index[saramaMessages[i]] = i
+	}
+	start := time.Now()
+	err := this.producer.SendMessages(saramaMessages)
+	if SlowProducerTimeout > 0 && time.Since(start) >= SlowProducerTimeout {
+		this.logger.Warn("finished slow batch produce call", "duration", time.Since(start), "size", len(messages))
+	}
+	var producerErrors sarama.ProducerErrors
+	if errors.As(err, &producerErrors) {
+		for _, e := range producerErrors {
+			if i, ok := index[e.Msg]; ok {
+				errs[i] = e.Err
+			}
+		}
+		return errs
+	}
+	if err != nil {
+		return fillErrors(errs, err)
+	}
+	return errs
+}
+
+func (this *AsyncProducer) ProduceBatchCtx(ctx context.Context, messages []Message) (errs []error) {
+	errs = make([]error, len(messages))
+	if err := this.acquire(); err != nil {
+		return fillErrors(errs, err)
+	}
+	defer this.closeMux.RUnlock()
+	this.logger.Debug("kafka produce async batch", "size", len(messages))
+	for i, m := range messages {
+		if this.initTopic {
+			err := EnsureTopic(m.Topic, this.kafkaBootstrapUrl, &this.usedTopics, this.topicConfigMap, this.partitionsNum, this.replicationFactor)
+			if err != nil {
+				this.logger.Warn("unable to ensure topic", "error", err)
+			}
+		}
+		select {
+		case this.producer.Input() <- &sarama.ProducerMessage{Topic: m.Topic, Key: sarama.StringEncoder(m.Key), Value: sarama.StringEncoder(m.Value), Timestamp: m.Timestamp}:
+		case <-ctx.Done():
+			fillErrors(errs[i:], ctx.Err())
+			return errs
+		case <-this.closing:
+			fillErrors(errs[i:], ErrProducerClosed)
+			return errs
+		}
+	}
+	return errs
+}
+
+func fillErrors(errs []error, err error) []error {
+	for i := range errs {
+		errs[i] = err
+	}
+	return errs
 }
@@ -0,0 +1,67 @@
+package kafka
+
+import (
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// blockedAsyncProducer never accepts messages, like a sarama producer with a full input buffer
+type blockedAsyncProducer struct {
+	sarama.AsyncProducer
+	input  chan *sarama.ProducerMessage
+	errors chan *sarama.ProducerError
+}
+
+func (this *blockedAsyncProducer) Input() chan<- *sarama.ProducerMessage {
+	return this.input
+}
+
+func (this *blockedAsyncProducer) Errors() <-chan *sarama.ProducerError {
+	return this.errors
+}
+
+func (this *blockedAsyncProducer) AsyncClose() {
+	close(this.errors)
+}
+
+func TestAsyncProducerCloseWhileBlocked(t *testing.T) {
+	mock := &blockedAsyncProducer{input: make(chan *sarama.ProducerMessage), errors: make(chan *sarama.ProducerError)}
+	producer := &AsyncProducer{producer: mock, logger: slog.Default(), closing: make(chan struct{}), errorsDone: make(chan struct{})}
+	go func() {
+		defer close(producer.errorsDone)
+		for range mock.Errors() {
+		}
+	}()
+
+	produced := make(chan error, 2)
+	go func() {
+		produced <- producer.Produce("test", "1")
+	}()
+	go func() {
+		produced <- producer.ProduceWithKey("test", "2", "key")
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		producer.Close()
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("close is blocked by pending produce calls")
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-produced; !errors.Is(err, ErrProducerClosed) {
+			t.Error(err)
+		}
+	}
+	if err := producer.Produce("test", "3"); !errors.Is(err, ErrProducerClosed) {
+		t.Error(err)
+	}
+}
@@ -17,6 +17,7 @@
 package kafka
 
 import (
+	"context"
 	"net"
 	"strconv"
 	"strings"
@@ -56,6 +57,23 @@ func getBroker(bootstrapUrl string) (result []string, err error) {
 	return result, nil
 }
 
+// Ping checks if the broker list can be requested from bootstrapUrl
+func Ping(ctx context.Context, bootstrapUrl string) error {
+	conn, err := kafka.DialContext(ctx, "tcp", bootstrapUrl)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		err = conn.SetDeadline(deadline)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = conn.Brokers()
+	return err
+}
+
 func InitTopic(kafkaUrl string, configMap map[string][]kafka.ConfigEntry, topics ...string) (err error) {
 	return InitTopicWithConfig(kafkaUrl, configMap, 1, 1, topics...)
 }
@@ -0,0 +1,102 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package platform_connector_lib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/SENERGY-Platform/platform-connector-lib/kafka"
+	"github.com/SENERGY-Platform/platform-connector-lib/model"
+	"github.com/SENERGY-Platform/platform-connector-lib/statistics"
+)
+
+const KafkaSinkName = "kafka"
+
+// KafkaSink produces envelopes to the service topics
+type KafkaSink struct {
+	getProducer func(qos Qos) (kafka.ProducerInterface, error)
+}
+
+func NewKafkaSink(getProducer func(qos Qos) (kafka.ProducerInterface, error)) *KafkaSink {
+	return &KafkaSink{getProducer: getProducer}
+}
+
+func (this *KafkaSink) Name() string {
+	return KafkaSinkName
+}
+
+func (this *KafkaSink) Send(ctx context.Context, info EventInfo, envelope model.Envelope) error {
+	producer, err := this.getProducer(info.Qos)
+	if err != nil {
+		return err
+	}
+	jsonMsg, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	topic := model.ServiceIdToTopic(envelope.ServiceId)
+	start := time.Now()
+	err = kafka.ProduceWithTimestampCtx(ctx, producer, topic, string(jsonMsg), envelope.DeviceId, info.Time)
+	statistics.KafkaWrite(time.Since(start), info.UserId)
+	if err != nil {
+		return fmt.Errorf("unable to produce to topic %v: %w", topic, err)
+	}
+	return nil
+}
+
+// SendBatch uses the qos of the first event for all events
+func (this *KafkaSink) SendBatch(ctx context.Context, events []SinkEvent) (errs []error) {
+	errs = make([]error, len(events))
+	if len(events) == 0 {
+		return errs
+	}
+	producer, err := this.getProducer(events[0].Info.Qos)
+	if err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+	messages := []kafka.Message{}
+	origin := []int{}
+	for i, event := range events {
+		jsonMsg, err := json.Marshal(event.Envelope)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		messages = append(messages, kafka.Message{
+			Topic:     model.ServiceIdToTopic(event.Envelope.ServiceId),
+			Key:       event.Envelope.DeviceId,
+			Value:     string(jsonMsg),
+			Timestamp: event.Info.Time,
+		})
+		origin = append(origin, i)
+	}
+	start := time.Now()
+	produceErrs := kafka.ProduceBatchCtx(ctx, producer, messages)
+	statistics.KafkaWrite(time.Since(start), events[0].Info.UserId)
+	for j, err := range produceErrs {
+		if err != nil {
+			errs[origin[j]] = fmt.Errorf("unable to produce to topic %v: %w", messages[j].Topic, err)
+		}
+	}
+	return errs
+}
@@ -81,7 +81,7 @@ func (this *Connector) notifyDeviceOwners(deviceId string, message Notification)
 		this.Config.GetLogger().Warn("no NotificationUrl configured")
 		return
 	}
-	if this.Config.NotificationUserOverwrite != "" && this.Config.NotificationUserOverwrite != "-" {
+	if isSet(this.Config.NotificationUserOverwrite) {
 		err := this.SendNotification(message)
 		if err != nil {
 			this.Config.GetLogger().Error("unable to send notification", "error", err)
@@ -137,7 +137,7 @@ func (this *Connector) SendNotification(message Notification) error {
 	if message.Topic == "" {
 		message.Topic = "connector"
 	}
-	if this.Config.NotificationUserOverwrite != "" && this.Config.NotificationUserOverwrite != "-" {
+	if isSet(this.Config.NotificationUserOverwrite) {
 		message.UserId = this.Config.NotificationUserOverwrite
 	}
 	message.Message = this.removeSecretsFromString(message.Message)
@@ -169,13 +169,13 @@ func (this *Connector) SendNotification(message Notification) error {
 	}
 	endpoint := this.Config.NotificationUrl + "/notifications?ignore_duplicates_within_seconds=" + ignoreDuplicatesWithinS
 	this.Config.GetLogger().Debug("send notification", "endpoint", endpoint, "userId", message.UserId)
-	req, err := http.NewRequest("POST", endpoint, b)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, b)
 	if err != nil {
 		this.Config.GetLogger().Error("unable to create notification request", "error", err)
 		return err
 	}
-	ctx, _ := context.WithTimeout(context.Background(), 5*time.Second)
-	req.WithContext(ctx)
 	req.Header.Set("Content-Type", "application/json")
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
@@ -211,7 +211,7 @@ func (this *Connector) removeSecretsFromString(input string) string {
 		this.Config.PostgresPw:               "***",
 	}
 	for secret, replace := range secrets {
-		if secret != "" && secret != "-" {
+		if isSet(secret) {
 			output = strings.ReplaceAll(output, secret, replace)
 		}
 	}
@@ -0,0 +1,95 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package platform_connector_lib
+
+import (
+	"context"
+	"time"
+
+	"github.com/SENERGY-Platform/platform-connector-lib/model"
+	"github.com/SENERGY-Platform/platform-connector-lib/security"
+)
+
+// EventInfo describes the event a middleware is called for
+type EventInfo struct {
+	Token   security.JwtToken
+	UserId  string
+	Device  model.Device
+	Service model.Service
+	Qos     Qos
+	Time    time.Time
+	Sink    string //name of the EventSink; only set in the sink stages
+}
+
+// RawEventMiddleware is called before the event message is unmarshalled.
+// returning a nil EventMsg drops the event, returning an error aborts the event handling.
+type RawEventMiddleware func(ctx context.Context, info EventInfo, msg EventMsg) (EventMsg, error)
+
+// EnvelopeMiddleware may rewrite, enrich, drop (empty result) or fan out (multiple results) an envelope.
+// returning an error aborts the event handling.
+type EnvelopeMiddleware func(ctx context.Context, info EventInfo, envelope model.Envelope) ([]model.Envelope, error)
+
+type EnvelopeStage int
+
+const (
+	AfterValidation EnvelopeStage = iota
+	BeforeKafka                   //only for the KafkaSink
+	BeforePostgres                //only for the TimescaleSink
+	BeforeSink                    //for every EventSink, before the sink specific stages
+)
+
+// UseRawEventMiddleware registers a middleware, called in registration order; must be called before Start()
+func (this *Connector) UseRawEventMiddleware(middleware RawEventMiddleware) *Connector {
+	this.rawEventMiddlewares = append(this.rawEventMiddlewares, middleware)
+	return this
+}
+
+// UseEnvelopeMiddleware registers a middleware for stage, called in registration order; must be called before Start()
+func (this *Connector) UseEnvelopeMiddleware(stage EnvelopeStage, middleware EnvelopeMiddleware) *Connector {
+	if this.envelopeMiddlewares == nil {
+		this.envelopeMiddlewares = map[EnvelopeStage][]EnvelopeMiddleware{}
+	}
+	this.envelopeMiddlewares[stage] = append(this.envelopeMiddlewares[stage], middleware)
+	return this
+}
+
+func (this *Connector) applyRawEventMiddlewares(ctx context.Context, info EventInfo, msg EventMsg) (result EventMsg, err error) {
+	result = msg
+	for _, middleware := range this.rawEventMiddlewares {
+		result, err = middleware(ctx, info, result)
+		if err != nil || result == nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+func (this *Connector) applyEnvelopeMiddlewares(ctx context.Context, stage EnvelopeStage, info EventInfo, envelope model.Envelope) (result []model.Envelope, err error) {
+	result = []model.Envelope{envelope}
+	for _, middleware := range this.envelopeMiddlewares[stage] {
+		next := []model.Envelope{}
+		for _, e := range result {
+			temp, err := middleware(ctx, info, e)
+			if err != nil {
+				return nil, err
+			}
+			next = append(next, temp...)
+		}
+		result = next
+	}
+	return result, nil
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package platform_connector_lib
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/SENERGY-Platform/platform-connector-lib/model"
+)
+
+func TestEnvelopeMiddlewares(t *testing.T) {
+	ctl := &Connector{}
+	ctl.UseEnvelopeMiddleware(AfterValidation, func(ctx context.Context, info EventInfo, envelope model.Envelope) ([]model.Envelope, error) {
+		copied := envelope
+		copied.ServiceId = envelope.ServiceId + "_copy"
+		return []model.Envelope{envelope, copied}, nil
+	}).UseEnvelopeMiddleware(AfterValidation, func(ctx context.Context, info EventInfo, envelope model.Envelope) ([]model.Envelope, error) {
+		if envelope.ServiceId == "drop" {
+			return nil, nil
+		}
+		return []model.Envelope{envelope}, nil
+	})
+
+	result, err := ctl.applyEnvelopeMiddlewares(context.Background(), AfterValidation, EventInfo{}, model.Envelope{ServiceId: "s"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !reflect.DeepEqual(result, []model.Envelope{{ServiceId: "s"}, {ServiceId: "s_copy"}}) {
+		t.Errorf("%#v", result)
+	}
+
+	result, err = ctl.applyEnvelopeMiddlewares(context.Background(), AfterValidation, EventInfo{}, model.Envelope{ServiceId: "drop"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !reflect.DeepEqual(result, []model.Envelope{{ServiceId: "drop_copy"}}) {
+		t.Errorf("%#v", result)
+	}
+
+	result, err = ctl.applyEnvelopeMiddlewares(context.Background(), BeforeKafka, EventInfo{}, model.Envelope{ServiceId: "drop"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !reflect.DeepEqual(result, []model.Envelope{{ServiceId: "drop"}}) {
+		t.Errorf("%#v", result)
+	}
+}
+
+func TestRawEventMiddlewares(t *testing.T) {
+	ctl := &Connector{}
+	ctl.UseRawEventMiddleware(func(ctx context.Context, info EventInfo, msg EventMsg) (EventMsg, error) {
+		if msg["drop"] != "" {
+			return nil, nil
+		}
+		msg["seen"] = "true"
+		return msg, nil
+	})
+	result, err := ctl.applyRawEventMiddlewares(context.Background(), EventInfo{}, EventMsg{"data": "1"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !reflect.DeepEqual(result, EventMsg{"data": "1", "seen": "true"}) {
+		t.Errorf("%#v", result)
+	}
+	result, err = ctl.applyRawEventMiddlewares(context.Background(), EventInfo{}, EventMsg{"drop": "1"})
+	if err != nil || result != nil {
+		t.Error(result, err)
+	}
+}
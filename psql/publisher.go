@@ -100,9 +100,22 @@ func New(postgresHost string, postgresPort int, postgresUser string, postgresPw
 	}, nil
 }
 
+// Close closes the connection pool and waits for acquired connections to be released
+func (publisher *Publisher) Close() {
+	publisher.db.Close()
+}
+
+func (publisher *Publisher) Ping(ctx context.Context) error {
+	return publisher.db.Ping(ctx)
+}
+
 var SlowProducerTimeout time.Duration = 2 * time.Second
 
 func (publisher *Publisher) Publish(envelope model.Envelope, service model.Service) (err error, notifyUsers bool) {
+	return publisher.PublishCtx(context.Background(), envelope, service)
+}
+
+func (publisher *Publisher) PublishCtx(ctx context.Context, envelope model.Envelope, service model.Service) (err error, notifyUsers bool) {
 	start := time.Now()
 	m := flatten(envelope.Value)
 
@@ -174,7 +187,7 @@ func (publisher *Publisher) Publish(envelope model.Envelope, service model.Servi
 
 	publisher.logger.Debug("psql request", "query", query)
 
-	_, err = publisher.db.Exec(context.Background(), query)
+	_, err = publisher.db.Exec(ctx, query)
 
 	publisher.logger.Debug("psql response", "err", err, "duration", time.Since(start))
 	if SlowProducerTimeout > 0 && time.Since(start) >= SlowProducerTimeout {
@@ -0,0 +1,85 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package platform_connector_lib
+
+import (
+	"fmt"
+
+	"github.com/SENERGY-Platform/platform-connector-lib/connectionlimit"
+	"github.com/SENERGY-Platform/platform-connector-lib/security"
+	"github.com/SENERGY-Platform/platform-connector-lib/statistics"
+)
+
+var ErrRateLimited = connectionlimit.ErrRateLimited
+
+const CommandErrorRateLimited CommandErrorReason = "rate_limited"
+
+type RateLimits struct {
+	Device *connectionlimit.RateLimiter //optional; events and commands per device id
+	User   *connectionlimit.RateLimiter //optional; events per user id
+	Hub    *connectionlimit.RateLimiter //optional; messages per hub id; checked by AllowHub()
+}
+
+// SetRateLimits overwrites the limits of Config.DeviceRateLimit, Config.UserRateLimit and Config.HubRateLimit
+func (this *Connector) SetRateLimits(limits RateLimits) *Connector {
+	this.rateLimits = limits
+	return this
+}
+
+func getRateLimitsFromConfig(config Config) (result RateLimits) {
+	var urls []string
+	if len(config.RateLimitUrl) > 0 && isSet(config.RateLimitUrl[0]) {
+		urls = config.RateLimitUrl
+	}
+	if config.DeviceRateLimit > 0 {
+		result.Device = connectionlimit.NewRateLimiter("device", connectionlimit.RateLimit{Rate: config.DeviceRateLimit, Burst: config.DeviceRateLimitBurst}, config.GetLogger(), urls...)
+	}
+	if config.UserRateLimit > 0 {
+		result.User = connectionlimit.NewRateLimiter("user", connectionlimit.RateLimit{Rate: config.UserRateLimit, Burst: config.UserRateLimitBurst}, config.GetLogger(), urls...)
+	}
+	if config.HubRateLimit > 0 {
+		result.Hub = connectionlimit.NewRateLimiter("hub", connectionlimit.RateLimit{Rate: config.HubRateLimit, Burst: config.HubRateLimitBurst}, config.GetLogger(), urls...)
+	}
+	return result
+}
+
+// AllowHub checks the hub rate limit; returns an error wrapping ErrRateLimited if the hub exceeds its limit.
+// connectors should call it for every message received from a hub connection.
+func (this *Connector) AllowHub(hubId string) error {
+	return this.allow(this.rateLimits.Hub, "hub", hubId, "message")
+}
+
+func (this *Connector) checkEventRateLimit(token security.JwtToken, deviceId string) error {
+	err := this.allow(this.rateLimits.Device, "device", deviceId, "event")
+	if err != nil || this.rateLimits.User == nil {
+		return err
+	}
+	pl, err := token.GetPayload()
+	if err != nil {
+		return err
+	}
+	return this.allow(this.rateLimits.User, "user", pl.UserId, "event")
+}
+
+func (this *Connector) allow(limiter *connectionlimit.RateLimiter, scope string, key string, msgType string) error {
+	err := limiter.Allow(key)
+	if err != nil {
+		statistics.RateLimited(scope, msgType)
+		return fmt.Errorf("%w: %v %v", err, scope, key)
+	}
+	return nil
+}
@@ -33,53 +33,45 @@ var ErrorNotFound = errors.New("not found")
 var ErrorAccessDenied = errors.New("access denied")
 var ErrorUnexpectedStatus = errors.New("unexpected status")
 
+// UnexpectedStatusError is returned for responses with a status code not mapped to ErrorNotFound or ErrorAccessDenied;
+// errors.Is(err, ErrorUnexpectedStatus) is true
+type UnexpectedStatusError struct {
+	Url        string
+	StatusCode int
+	Body       string
+}
+
+func (this *UnexpectedStatusError) Error() string {
+	return fmt.Sprintf("%v: %v %v %v", ErrorUnexpectedStatus, this.Url, this.StatusCode, this.Body)
+}
+
+func (this *UnexpectedStatusError) Unwrap() error {
+	return ErrorUnexpectedStatus
+}
+
+// RequestTimeout limits every JwtToken http request, including the time needed to read the response body.
+// the deadline of a context passed to one of the ...Ctx methods is respected if it is shorter.
+var RequestTimeout = 5 * time.Second
+
 func (this JwtToken) Post(url string, contentType string, body io.Reader) (resp *http.Response, err error) {
-	req, err := http.NewRequest("POST", url, body)
-	if err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrorInternal, err.Error())
-	}
-	ctx, _ := context.WithTimeout(context.Background(), 5*time.Second)
-	req.WithContext(ctx)
-	req.Header.Set("Authorization", string(this))
-	req.Header.Set("Content-Type", contentType)
+	return this.PostCtx(context.Background(), url, contentType, body)
+}
 
-	resp, err = http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrorInternal, err.Error())
-	}
-	if resp.StatusCode == http.StatusNotFound {
-		//body muss be read til eof and closed to enable connection reuse
-		io.ReadAll(resp.Body)
-		resp.Body.Close()
-		return resp, fmt.Errorf("%w: %v %v", ErrorNotFound, url, resp.StatusCode)
-	}
-	if resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusUnauthorized {
-		//body muss be read til eof and closed to enable connection reuse
-		io.ReadAll(resp.Body)
-		resp.Body.Close()
-		return resp, fmt.Errorf("%w: %v %v", ErrorAccessDenied, url, resp.StatusCode)
-	}
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		b, err := io.ReadAll(resp.Body)
-		if err != nil {
-			log.Println("ERROR: ", err)
-		}
-		if err := resp.Body.Close(); err != nil {
-			log.Println("ERROR: ", err)
-		}
-		log.Println("DEBUG: response:", resp.StatusCode, string(b))
-		return resp, fmt.Errorf("%w: %v %v %v", ErrorUnexpectedStatus, url, resp.StatusCode, string(b))
-	}
-	return
+func (this JwtToken) PostCtx(ctx context.Context, url string, contentType string, body io.Reader) (resp *http.Response, err error) {
+	return this.do(ctx, "POST", url, contentType, body)
 }
 
 func (this JwtToken) PostJSON(url string, body interface{}, result interface{}) (err error) {
+	return this.PostJSONCtx(context.Background(), url, body, result)
+}
+
+func (this JwtToken) PostJSONCtx(ctx context.Context, url string, body interface{}, result interface{}) (err error) {
 	b := new(bytes.Buffer)
 	err = json.NewEncoder(b).Encode(body)
 	if err != nil {
 		return
 	}
-	resp, err := this.Post(url, "application/json", b)
+	resp, err := this.PostCtx(ctx, url, "application/json", b)
 	if err != nil {
 		return err
 	}
@@ -91,45 +83,19 @@ func (this JwtToken) PostJSON(url string, body interface{}, result interface{})
 }
 
 func (this JwtToken) Get(url string) (resp *http.Response, err error) {
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrorInternal, err.Error())
-	}
-	ctx, _ := context.WithTimeout(context.Background(), 5*time.Second)
-	req.WithContext(ctx)
-	req.Header.Set("Authorization", string(this))
-	resp, err = http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrorInternal, err.Error())
-	}
-	if resp.StatusCode == http.StatusNotFound {
-		//body muss be read til eof and closed to enable connection reuse
-		io.ReadAll(resp.Body)
-		resp.Body.Close()
-		return resp, fmt.Errorf("%w: %v %v", ErrorNotFound, url, resp.StatusCode)
-	}
-	if resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusUnauthorized {
-		//body muss be read til eof and closed to enable connection reuse
-		io.ReadAll(resp.Body)
-		resp.Body.Close()
-		return resp, fmt.Errorf("%w: %v %v", ErrorAccessDenied, url, resp.StatusCode)
-	}
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		b, err := io.ReadAll(resp.Body)
-		if err != nil {
-			log.Println("ERROR: ", err)
-		}
-		if err := resp.Body.Close(); err != nil {
-			log.Println("ERROR: ", err)
-		}
-		log.Println("DEBUG: response:", resp.StatusCode, string(b))
-		return resp, fmt.Errorf("%w: %v %v %v", ErrorUnexpectedStatus, url, resp.StatusCode, string(b))
-	}
-	return
+	return this.GetCtx(context.Background(), url)
+}
+
+func (this JwtToken) GetCtx(ctx context.Context, url string) (resp *http.Response, err error) {
+	return this.do(ctx, "GET", url, "", nil)
 }
 
 func (this JwtToken) GetJSON(url string, result interface{}) (err error) {
-	resp, err := this.Get(url)
+	return this.GetJSONCtx(context.Background(), url, result)
+}
+
+func (this JwtToken) GetJSONCtx(ctx context.Context, url string, result interface{}) (err error) {
+	resp, err := this.GetCtx(ctx, url)
 	if err != nil {
 		return err
 	}
@@ -138,58 +104,83 @@ func (this JwtToken) GetJSON(url string, result interface{}) (err error) {
 }
 
 func (this JwtToken) Delete(url string) (resp *http.Response, err error) {
-	req, err := http.NewRequest("DELETE", url, nil)
+	return this.DeleteCtx(context.Background(), url)
+}
+
+func (this JwtToken) DeleteCtx(ctx context.Context, url string) (resp *http.Response, err error) {
+	return this.do(ctx, "DELETE", url, "", nil)
+}
+
+func (this JwtToken) Put(url string, contentType string, body io.Reader) (resp *http.Response, err error) {
+	return this.PutCtx(context.Background(), url, contentType, body)
+}
+
+func (this JwtToken) PutCtx(ctx context.Context, url string, contentType string, body io.Reader) (resp *http.Response, err error) {
+	return this.do(ctx, "PUT", url, contentType, body)
+}
+
+func (this JwtToken) PutJSON(url string, body interface{}, result interface{}) (err error) {
+	return this.PutJSONCtx(context.Background(), url, body, result)
+}
+
+func (this JwtToken) PutJSONCtx(ctx context.Context, url string, body interface{}, result interface{}) (err error) {
+	b := new(bytes.Buffer)
+	err = json.NewEncoder(b).Encode(body)
 	if err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrorInternal, err.Error())
+		return
 	}
-	ctx, _ := context.WithTimeout(context.Background(), 5*time.Second)
-	req.WithContext(ctx)
-	req.Header.Set("Authorization", string(this))
-
-	resp, err = http.DefaultClient.Do(req)
+	resp, err := this.PutCtx(ctx, url, "application/json", b)
 	if err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrorInternal, err.Error())
+		return err
 	}
-	if resp.StatusCode == http.StatusNotFound {
-		//body muss be read til eof and closed to enable connection reuse
-		io.ReadAll(resp.Body)
-		resp.Body.Close()
-		return resp, fmt.Errorf("%w: %v %v", ErrorNotFound, url, resp.StatusCode)
+	defer resp.Body.Close()
+	if result != nil {
+		err = json.NewDecoder(resp.Body).Decode(result)
 	}
-	if resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusUnauthorized {
-		//body muss be read til eof and closed to enable connection reuse
-		io.ReadAll(resp.Body)
-		resp.Body.Close()
-		return resp, fmt.Errorf("%w: %v %v", ErrorAccessDenied, url, resp.StatusCode)
+	return
+}
+
+func (this JwtToken) Head(url string) (statuscode int, err error) {
+	return this.HeadCtx(context.Background(), url)
+}
+
+func (this JwtToken) HeadCtx(ctx context.Context, url string) (statuscode int, err error) {
+	ctx, cancel := context.WithTimeout(ctx, RequestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "HEAD", url, nil)
+	if err != nil {
+		return statuscode, fmt.Errorf("%w: %v", ErrorInternal, err.Error())
 	}
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		b, err := io.ReadAll(resp.Body)
-		if err != nil {
-			log.Println("ERROR: ", err)
-		}
-		if err := resp.Body.Close(); err != nil {
-			log.Println("ERROR: ", err)
-		}
-		log.Println("DEBUG: response:", resp.StatusCode, string(b))
-		return resp, fmt.Errorf("%w: %v %v %v", ErrorUnexpectedStatus, url, resp.StatusCode, string(b))
+	req.Header.Set("Authorization", string(this))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return statuscode, fmt.Errorf("%w: %w", ErrorInternal, err)
 	}
-	return
+	defer resp.Body.Close()
+	defer io.ReadAll(resp.Body)
+	return resp.StatusCode, nil
 }
 
-func (this JwtToken) Put(url string, contentType string, body io.Reader) (resp *http.Response, err error) {
-	req, err := http.NewRequest("PUT", url, body)
+func (this JwtToken) do(ctx context.Context, method string, url string, contentType string, body io.Reader) (resp *http.Response, err error) {
+	ctx, cancel := context.WithTimeout(ctx, RequestTimeout)
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
+		cancel()
 		return nil, fmt.Errorf("%w: %v", ErrorInternal, err.Error())
 	}
-	ctx, _ := context.WithTimeout(context.Background(), 5*time.Second)
-	req.WithContext(ctx)
 	req.Header.Set("Authorization", string(this))
-	req.Header.Set("Content-Type", contentType)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
 
 	resp, err = http.DefaultClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrorInternal, err.Error())
+		cancel()
+		return nil, fmt.Errorf("%w: %w", ErrorInternal, err)
 	}
+	//the timeout must stay active until the caller has read the body
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
 	if resp.StatusCode == http.StatusNotFound {
 		//body muss be read til eof and closed to enable connection reuse
 		io.ReadAll(resp.Body)
@@ -211,42 +202,17 @@ func (this JwtToken) Put(url string, contentType string, body io.Reader) (resp *
 			log.Println("ERROR: ", err)
 		}
 		log.Println("DEBUG: response:", resp.StatusCode, string(b))
-		return resp, fmt.Errorf("%w: %v %v %v", ErrorUnexpectedStatus, url, resp.StatusCode, string(b))
+		return resp, &UnexpectedStatusError{Url: url, StatusCode: resp.StatusCode, Body: string(b)}
 	}
 	return
 }
 
-func (this JwtToken) PutJSON(url string, body interface{}, result interface{}) (err error) {
-	b := new(bytes.Buffer)
-	err = json.NewEncoder(b).Encode(body)
-	if err != nil {
-		return
-	}
-	resp, err := this.Put(url, "application/json", b)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	if result != nil {
-		err = json.NewDecoder(resp.Body).Decode(result)
-	}
-	return
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
 }
 
-func (this JwtToken) Head(url string) (statuscode int, err error) {
-	req, err := http.NewRequest("HEAD", url, nil)
-	if err != nil {
-		return statuscode, fmt.Errorf("%w: %v", ErrorInternal, err.Error())
-	}
-	ctx, _ := context.WithTimeout(context.Background(), 5*time.Second)
-	req.WithContext(ctx)
-	req.Header.Set("Authorization", string(this))
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return statuscode, fmt.Errorf("%w: %v", ErrorInternal, err.Error())
-	}
-	defer resp.Body.Close()
-	defer io.ReadAll(resp.Body)
-	return resp.StatusCode, nil
+func (this *cancelOnClose) Close() error {
+	defer this.cancel()
+	return this.ReadCloser.Close()
 }
@@ -0,0 +1,220 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package security
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SENERGY-Platform/platform-connector-lib/model"
+	"github.com/golang-jwt/jwt"
+)
+
+// StaticUsers is the content of the users file of the Offline provider
+type StaticUsers struct {
+	Client string       `json:"client"` //username of the user returned by Access()
+	Users  []StaticUser `json:"users"`
+}
+
+type StaticUser struct {
+	Id       string   `json:"id"`
+	Username string   `json:"username"`
+	Password string   `json:"password"` //plain text; intended for test setups
+	Roles    []string `json:"roles"`
+}
+
+// Offline signs tokens locally and resolves users and roles from a static file; allows running without keycloak
+type Offline struct {
+	jwtIssuer     string
+	jwtPrivateKey string
+	jwtExpiration time.Duration
+	logger        *slog.Logger
+
+	users  map[string]StaticUser //by id
+	client StaticUser
+
+	mux    sync.Mutex
+	access JwtToken
+	renew  time.Time
+}
+
+// NewOffline reads the users from usersFile (json, see StaticUsers);
+// tokens are signed with jwtPrivateKey (base64 PKCS1) or unsigned if jwtPrivateKey is empty
+func NewOffline(usersFile string, jwtIssuer string, jwtPrivateKey string, jwtExpiration int64, logger *slog.Logger) (result *Offline, err error) {
+	file, err := os.ReadFile(usersFile)
+	if err != nil {
+		return nil, err
+	}
+	users := StaticUsers{}
+	err = json.Unmarshal(file, &users)
+	if err != nil {
+		return nil, errors.New("unable to parse users file: " + err.Error())
+	}
+	return NewOfflineFromUsers(users, jwtIssuer, jwtPrivateKey, jwtExpiration, logger)
+}
+
+func NewOfflineFromUsers(users StaticUsers, jwtIssuer string, jwtPrivateKey string, jwtExpiration int64, logger *slog.Logger) (result *Offline, err error) {
+	if jwtPrivateKey != "" {
+		_, err = parsePrivateKey(jwtPrivateKey)
+		if err != nil {
+			return nil, errors.New("unable to parse jwt private key: " + err.Error())
+		}
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	result = &Offline{
+		jwtIssuer:     jwtIssuer,
+		jwtPrivateKey: jwtPrivateKey,
+		jwtExpiration: time.Duration(jwtExpiration),
+		logger:        logger,
+		users:         map[string]StaticUser{},
+	}
+	if result.jwtExpiration <= 0 {
+		result.jwtExpiration = time.Hour
+	}
+	for _, user := range users.Users {
+		if user.Id == "" || user.Username == "" {
+			return nil, errors.New("static users need an id and a username")
+		}
+		result.users[user.Id] = user
+		if user.Username == users.Client {
+			result.client = user
+		}
+	}
+	if result.client.Id == "" {
+		return nil, errors.New("unknown client user " + users.Client)
+	}
+	return result, nil
+}
+
+func (this *Offline) ResetAccess() {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	this.access = ""
+}
+
+// Access returns a token of the client user; renewed after half of its lifetime
+func (this *Offline) Access() (token JwtToken, err error) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	if this.access != "" && time.Now().Before(this.renew) {
+		return this.access, nil
+	}
+	token, err = this.GenerateUserTokenById(this.client.Id)
+	if err != nil {
+		return token, err
+	}
+	this.access = token
+	this.renew = time.Now().Add(this.jwtExpiration / 2)
+	return token, nil
+}
+
+func (this *Offline) GenerateUserTokenById(userid string) (token JwtToken, err error) {
+	user, ok := this.users[userid]
+	if !ok {
+		return token, ErrorNotFound
+	}
+	token, err = signToken(this.jwtIssuer, this.jwtPrivateKey, this.jwtExpiration, user.Id, user.Roles)
+	if err != nil {
+		this.logger.Error("unable to sign token", "error", err, "userid", userid)
+	}
+	return token, err
+}
+
+func (this *Offline) GenerateUserToken(username string) (token JwtToken, err error) {
+	userid, err := this.GetUserId(username)
+	if err != nil {
+		return token, err
+	}
+	return this.GenerateUserTokenById(userid)
+}
+
+func (this *Offline) ExchangeUserToken(userid string, remoteInfo model.RemoteInfo) (token JwtToken, err error) {
+	return this.GenerateUserTokenById(userid)
+}
+
+func (this *Offline) GetUserToken(username string, password string, remoteInfo model.RemoteInfo) (token JwtToken, err error) {
+	userid, err := this.GetUserId(username)
+	if err != nil {
+		return token, ErrorAccessDenied
+	}
+	if subtle.ConstantTimeCompare([]byte(this.users[userid].Password), []byte(password)) != 1 {
+		return token, ErrorAccessDenied
+	}
+	return this.GenerateUserTokenById(userid)
+}
+
+// GetCachedUserToken accepts a user id or a username, like the keycloak token exchange
+func (this *Offline) GetCachedUserToken(username string, remoteInfo model.RemoteInfo) (token JwtToken, err error) {
+	if _, ok := this.users[username]; ok {
+		return this.GenerateUserTokenById(username)
+	}
+	return this.GenerateUserToken(username)
+}
+
+func (this *Offline) GetUserId(username string) (userid string, err error) {
+	for _, user := range this.users {
+		if user.Username == username {
+			return user.Id, nil
+		}
+	}
+	return "", errors.New("no unambiguous user found")
+}
+
+func (this *Offline) GetUserRoles(userid string) (roles []string, err error) {
+	user, ok := this.users[userid]
+	if !ok {
+		return nil, ErrorNotFound
+	}
+	return user.Roles, nil
+}
+
+var ErrUnsignedTokens = errors.New("offline security without JwtPrivateKey can not validate tokens")
+
+// ValidateToken checks the signature, the expiration and the user;
+// without a private key every token is rejected, because unsigned tokens can be forged by anyone
+func (this *Offline) ValidateToken(token JwtToken) (payload JwtPayload, err error) {
+	if this.jwtPrivateKey == "" {
+		return payload, errors.Join(ErrInvalidToken, ErrUnsignedTokens)
+	}
+	tokenString := strings.TrimPrefix(string(token), "Bearer ")
+	claims := KeycloakClaims{}
+	_, err = jwt.ParseWithClaims(tokenString, &claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		key, err := parsePrivateKey(this.jwtPrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		return &key.PublicKey, nil
+	})
+	if err != nil {
+		return payload, errors.Join(ErrInvalidToken, err)
+	}
+	if _, ok := this.users[claims.Subject]; !ok {
+		return payload, ErrInvalidToken
+	}
+	return token.GetPayload()
+}
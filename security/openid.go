@@ -19,6 +19,7 @@ package security
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/SENERGY-Platform/platform-connector-lib/model"
 	"io"
 	"net/http"
@@ -43,6 +44,10 @@ func (this *OpenidToken) JwtToken() JwtToken {
 	return JwtToken("Bearer " + this.AccessToken)
 }
 
+func (this *OpenidToken) expiresAt() time.Time {
+	return this.RequestTime.Add(time.Duration(this.ExpiresIn * float64(time.Second)))
+}
+
 func GetOpenidToken(authEndpoint string, authClientId string, authClientSecret string, remoteInfo model.RemoteInfo) (openid OpenidToken, err error) {
 	requesttime := time.Now()
 	client := http.Client{
@@ -150,6 +155,10 @@ func GetOpenidPasswordToken(authEndpoint string, authClientId string, authClient
 	if resp.StatusCode >= 300 {
 		b, _ := io.ReadAll(resp.Body)
 		err = errors.New(resp.Status + ": " + string(b))
+		if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+			//invalid credentials
+			err = fmt.Errorf("%w: %w", ErrorAccessDenied, err)
+		}
 		return
 	}
 	err = json.NewDecoder(resp.Body).Decode(&token)
@@ -17,7 +17,9 @@
 package security
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"sync"
 	"time"
@@ -71,11 +73,29 @@ type Security struct {
 	cache                *cache.Cache
 	tokenCacheExpiration int32
 	logger               *slog.Logger
+
+	refreshTrigger chan struct{} //set while the token refresher is running
+
+	validatedTokensMux sync.Mutex
+	validatedTokens    map[JwtToken]time.Time //expiration of tokens validated by ValidateToken
 }
 
+const refreshInitialBackoff = time.Second
+const refreshMaxBackoff = time.Minute
+const refreshMinWait = time.Second
+
+// ResetAccess drops the access token; triggers an async refresh instead, if the token refresher is running
 func (this *Security) ResetAccess() {
 	this.mux.Lock()
 	defer this.mux.Unlock()
+	if this.refreshTrigger != nil {
+		this.logger.Debug("trigger openid token refresh")
+		select {
+		case this.refreshTrigger <- struct{}{}:
+		default: //refresh already triggered
+		}
+		return
+	}
 	b, _ := json.Marshal(this.openid)
 	this.logger.Debug("reset openid token", "openid", string(b))
 	this.openid = nil
@@ -89,6 +109,12 @@ func (this *Security) Access() (token JwtToken, err error) {
 	}
 	duration := time.Now().Sub(this.openid.RequestTime).Seconds()
 
+	if this.refreshTrigger != nil && this.openid.AccessToken != "" && this.openid.ExpiresIn > duration {
+		//the refresher renews the token; the last good token is used until it expires
+		token = JwtToken("Bearer " + this.openid.AccessToken)
+		return
+	}
+
 	if this.openid.AccessToken != "" && this.openid.ExpiresIn > duration+this.authExpirationTimeBuffer {
 		token = JwtToken("Bearer " + this.openid.AccessToken)
 		return
@@ -101,6 +127,7 @@ func (this *Security) Access() (token JwtToken, err error) {
 			this.logger.Warn("unable to refresh token", "error", err)
 		} else {
 			this.openid = &openid
+			statistics.AuthToken(this.openid.RequestTime, this.openid.expiresAt())
 			token = JwtToken("Bearer " + this.openid.AccessToken)
 			return token, err
 		}
@@ -112,7 +139,94 @@ func (this *Security) Access() (token JwtToken, err error) {
 	if err != nil {
 		this.logger.Error("unable to get new access token", "error", err)
 		this.openid = &OpenidToken{}
+		return "", err
 	}
+	statistics.AuthToken(this.openid.RequestTime, this.openid.expiresAt())
 	token = JwtToken("Bearer " + this.openid.AccessToken)
 	return
 }
+
+// StartTokenRefresher renews the access token in the background, before the authExpirationTimeBuffer is reached.
+// failed renewals are retried with exponential backoff; Access() serves the last good token meanwhile.
+// stops when ctx is done.
+func (this *Security) StartTokenRefresher(ctx context.Context) {
+	this.mux.Lock()
+	if this.refreshTrigger != nil {
+		this.mux.Unlock()
+		return
+	}
+	trigger := make(chan struct{}, 1)
+	this.refreshTrigger = trigger
+	this.mux.Unlock()
+	go func() {
+		defer func() {
+			this.mux.Lock()
+			defer this.mux.Unlock()
+			this.refreshTrigger = nil
+		}()
+		backoff := refreshInitialBackoff
+		for {
+			wait, err := this.refreshAccess()
+			if err != nil {
+				this.logger.Warn("unable to refresh access token", "error", err, "backoff", backoff)
+				wait = backoff
+				backoff = min(backoff*2, refreshMaxBackoff)
+			} else {
+				backoff = refreshInitialBackoff
+			}
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-trigger:
+				timer.Stop()
+			case <-timer.C:
+			}
+		}
+	}()
+}
+
+// refreshAccess renews the token without blocking Access(); returns the wait until the next renewal
+func (this *Security) refreshAccess() (wait time.Duration, err error) {
+	this.mux.Lock()
+	var current OpenidToken
+	if this.openid != nil {
+		current = *this.openid
+	}
+	this.mux.Unlock()
+
+	var openid OpenidToken
+	if current.RefreshToken != "" && current.RefreshExpiresIn > time.Since(current.RequestTime).Seconds()+this.authExpirationTimeBuffer {
+		openid, err = RefreshOpenidToken(this.authEndpoint, this.authClientId, this.authClientSecret, current, model.RemoteInfo{})
+		if err != nil {
+			this.logger.Debug("unable to refresh token; request new token", "error", err)
+		}
+	}
+	if err != nil || openid.AccessToken == "" {
+		openid, err = GetOpenidToken(this.authEndpoint, this.authClientId, this.authClientSecret, model.RemoteInfo{})
+	}
+	if err == nil && openid.AccessToken == "" {
+		err = errors.New("empty access token")
+	}
+	if err != nil {
+		statistics.AuthTokenRefresh(false)
+		return 0, err
+	}
+	this.mux.Lock()
+	this.openid = &openid
+	this.mux.Unlock()
+	statistics.AuthTokenRefresh(true)
+	statistics.AuthToken(openid.RequestTime, openid.expiresAt())
+	return max(time.Duration((openid.ExpiresIn-this.authExpirationTimeBuffer)*float64(time.Second)), refreshMinWait), nil
+}
+
+// TokenAge returns the time since the current access token has been requested; 0 if no token is known
+func (this *Security) TokenAge() time.Duration {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	if this.openid == nil || this.openid.AccessToken == "" {
+		return 0
+	}
+	return time.Since(this.openid.RequestTime)
+}
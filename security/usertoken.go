@@ -17,6 +17,7 @@
 package security
 
 import (
+	"crypto/rsa"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
@@ -94,40 +95,50 @@ func (this *Security) GenerateUserTokenById(userid string) (token JwtToken, err
 		return token, err
 	}
 
-	// Create the Claims
+	token, err = signToken(this.jwtIssuer, this.jwtPrivateKey, time.Duration(this.jwtExpiration), userid, roles)
+	if err != nil {
+		this.logger.Error("unable to sign token", "error", err, "userid", userid)
+		return token, err
+	}
+	return token, nil
+}
+
+// signToken signs with the base64 encoded PKCS1 privateKey; returns an unsigned token if privateKey is empty
+func signToken(issuer string, privateKey string, expiration time.Duration, userid string, roles []string) (token JwtToken, err error) {
 	claims := KeycloakClaims{
 		RealmAccess{Roles: roles},
 		jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(time.Duration(this.jwtExpiration)).Unix(),
-			Issuer:    this.jwtIssuer,
+			ExpiresAt: time.Now().Add(expiration).Unix(),
+			Issuer:    issuer,
 			Subject:   userid,
 		},
 	}
-
 	jwtoken := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
-	if this.jwtPrivateKey == "" {
+	if privateKey == "" {
 		unsignedTokenString, err := jwtoken.SigningString()
 		if err != nil {
-			this.logger.Error("unable to sign token", "error", err, "userid", userid)
 			return token, err
 		}
 		tokenString := strings.Join([]string{unsignedTokenString, ""}, ".")
-		token = JwtToken("Bearer " + tokenString)
-	} else {
-		//decode key base64 string to []byte
-		b, err := base64.StdEncoding.DecodeString(this.jwtPrivateKey)
-		if err != nil {
-			this.logger.Error("unable to decode jwt private key", "error", err, "userid", userid)
-			return token, err
-		}
-		//parse []byte key to go struct key (use most common encoding)
-		key, err := x509.ParsePKCS1PrivateKey(b)
-		tokenString, err := jwtoken.SignedString(key)
-		if err != nil {
-			this.logger.Error("unable to sign token", "error", err, "userid", userid)
-			return token, err
-		}
-		token = JwtToken("Bearer " + tokenString)
+		return JwtToken("Bearer " + tokenString), nil
+	}
+	key, err := parsePrivateKey(privateKey)
+	if err != nil {
+		return token, err
+	}
+	tokenString, err := jwtoken.SignedString(key)
+	if err != nil {
+		return token, err
+	}
+	return JwtToken("Bearer " + tokenString), nil
+}
+
+func parsePrivateKey(privateKey string) (key *rsa.PrivateKey, err error) {
+	//decode key base64 string to []byte
+	b, err := base64.StdEncoding.DecodeString(privateKey)
+	if err != nil {
+		return nil, err
 	}
-	return token, err
+	//parse []byte key to go struct key (use most common encoding)
+	return x509.ParsePKCS1PrivateKey(b)
 }
@@ -0,0 +1,107 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package security
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// maxValidatedTokens limits the number of cached token validations
+const maxValidatedTokens = 10000
+
+type userInfo struct {
+	Sub string `json:"sub"`
+}
+
+type tokenExpiration struct {
+	Exp int64 `json:"exp"`
+}
+
+// ValidateToken checks the token ("Bearer <jwt>") with the userinfo endpoint of the auth service;
+// successful validations are cached until the token expires
+func (this *Security) ValidateToken(token JwtToken) (payload JwtPayload, err error) {
+	payload, err = token.GetPayload()
+	if err != nil {
+		return payload, errors.Join(ErrInvalidToken, err)
+	}
+	exp := tokenExpiration{}
+	err = GetJWTPayload(string(token), &exp)
+	if err != nil {
+		return payload, errors.Join(ErrInvalidToken, err)
+	}
+	expiration := time.Unix(exp.Exp, 0)
+	if exp.Exp == 0 || time.Now().After(expiration) {
+		return payload, errors.Join(ErrInvalidToken, errors.New("missing or expired exp claim"))
+	}
+	if this.isValidatedToken(token) {
+		return payload, nil
+	}
+	resp, err := token.GetCtx(context.Background(), this.authEndpoint+"/auth/realms/master/protocol/openid-connect/userinfo")
+	if errors.Is(err, ErrorAccessDenied) {
+		return payload, errors.Join(ErrInvalidToken, err)
+	}
+	if err != nil {
+		return payload, err
+	}
+	defer resp.Body.Close()
+	info := userInfo{}
+	err = json.NewDecoder(resp.Body).Decode(&info)
+	if err != nil {
+		return payload, err
+	}
+	if info.Sub != payload.UserId {
+		return payload, ErrInvalidToken
+	}
+	this.setValidatedToken(token, expiration)
+	return payload, nil
+}
+
+func (this *Security) isValidatedToken(token JwtToken) bool {
+	this.validatedTokensMux.Lock()
+	defer this.validatedTokensMux.Unlock()
+	expiration, ok := this.validatedTokens[token]
+	if ok && time.Now().After(expiration) {
+		delete(this.validatedTokens, token)
+		return false
+	}
+	return ok
+}
+
+func (this *Security) setValidatedToken(token JwtToken, expiration time.Time) {
+	this.validatedTokensMux.Lock()
+	defer this.validatedTokensMux.Unlock()
+	if this.validatedTokens == nil {
+		this.validatedTokens = map[JwtToken]time.Time{}
+	}
+	if len(this.validatedTokens) >= maxValidatedTokens {
+		now := time.Now()
+		for key, exp := range this.validatedTokens {
+			if now.After(exp) {
+				delete(this.validatedTokens, key)
+			}
+		}
+		if len(this.validatedTokens) >= maxValidatedTokens {
+			clear(this.validatedTokens)
+		}
+	}
+	this.validatedTokens[token] = expiration
+}
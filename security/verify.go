@@ -0,0 +1,210 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package security
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"golang.org/x/sync/singleflight"
+)
+
+type VerifierConfig struct {
+	JwksUrl   string //optional; e.g. <AuthEndpoint>/auth/realms/master/protocol/openid-connect/certs; ignored if PublicKey is set
+	PublicKey string //optional; PEM or base64 encoded DER (PKIX or PKCS1) rsa public key
+	Issuer    string //optional; expected "iss" claim
+
+	JwksCacheDuration   time.Duration //optional; default 1h; keys are refreshed earlier if a token references an unknown "kid"
+	JwksRefreshInterval time.Duration //optional; min wait between refreshes caused by unknown keys; default 10s
+}
+
+// Verifier checks signature, expiry and issuer of tokens; supports RS256/RS384/RS512
+type Verifier struct {
+	config    VerifierConfig
+	publicKey *rsa.PublicKey
+	client    *http.Client
+
+	mux       sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetched   time.Time
+	attempted time.Time
+	fetch     singleflight.Group
+}
+
+func NewVerifier(config VerifierConfig) (result *Verifier, err error) {
+	if config.JwksCacheDuration <= 0 {
+		config.JwksCacheDuration = time.Hour
+	}
+	if config.JwksRefreshInterval <= 0 {
+		config.JwksRefreshInterval = 10 * time.Second
+	}
+	result = &Verifier{config: config, client: &http.Client{Timeout: 5 * time.Second}}
+	if config.PublicKey != "" {
+		result.publicKey, err = ParsePublicKey(config.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+	} else if config.JwksUrl == "" {
+		return nil, errors.New("verifier needs a JwksUrl or a PublicKey")
+	}
+	return result, nil
+}
+
+// Verify returns an error wrapping ErrorAccessDenied and ErrInvalidToken for invalid or expired tokens
+func (this *Verifier) Verify(token JwtToken) (payload JwtPayload, err error) {
+	tokenString := string(token)
+	if len(tokenString) > 7 && strings.EqualFold(tokenString[:7], "bearer ") {
+		tokenString = tokenString[7:]
+	}
+	claims := KeycloakClaims{}
+	_, err = jwt.ParseWithClaims(tokenString, &claims, this.getKey)
+	if err == nil && !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		err = errors.New("missing exp claim")
+	}
+	if err == nil && this.config.Issuer != "" && !claims.VerifyIssuer(this.config.Issuer, true) {
+		err = errors.New("unexpected issuer " + claims.Issuer)
+	}
+	if err != nil {
+		return payload, errors.Join(ErrorAccessDenied, ErrInvalidToken, err)
+	}
+	err = GetJWTPayload("Bearer "+tokenString, &payload)
+	if err != nil {
+		return payload, errors.Join(ErrorAccessDenied, ErrInvalidToken, err)
+	}
+	return payload, nil
+}
+
+func (this *Verifier) getKey(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+		return nil, errors.New("unexpected signing method " + token.Method.Alg())
+	}
+	if this.publicKey != nil {
+		return this.publicKey, nil
+	}
+	kid, _ := token.Header["kid"].(string)
+	return this.getJwksKey(kid)
+}
+
+// getJwksKey refreshes the keys if the cache is expired or kid is unknown; refreshes are limited by JwksRefreshInterval.
+// concurrent refreshes are coalesced and the http request is sent without holding the lock.
+func (this *Verifier) getJwksKey(kid string) (key *rsa.PublicKey, err error) {
+	this.mux.Lock()
+	key, ok := this.keys[kid]
+	expired := time.Since(this.fetched) > this.config.JwksCacheDuration
+	refresh := time.Since(this.attempted) > this.config.JwksRefreshInterval
+	this.mux.Unlock()
+	if ok && !expired {
+		return key, nil
+	}
+	if refresh {
+		_, err, _ = this.fetch.Do("jwks", func() (interface{}, error) {
+			keys, err := this.fetchJwks()
+			this.mux.Lock()
+			defer this.mux.Unlock()
+			this.attempted = time.Now()
+			if err == nil {
+				this.keys = keys
+				this.fetched = time.Now()
+			}
+			//on error: keep using the known keys until the next refresh
+			return nil, err
+		})
+	}
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	if err != nil && this.keys == nil {
+		return nil, err
+	}
+	key, ok = this.keys[kid]
+	if !ok {
+		return nil, errors.New("unknown key id " + kid)
+	}
+	return key, nil
+}
+
+type jwks struct {
+	Keys []struct {
+		Kid string `json:"kid"`
+		Kty string `json:"kty"`
+		Use string `json:"use"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	} `json:"keys"`
+}
+
+func (this *Verifier) fetchJwks() (keys map[string]*rsa.PublicKey, err error) {
+	resp, err := this.client.Get(this.config.JwksUrl)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("unexpected jwks response: " + resp.Status)
+	}
+	set := jwks{}
+	err = json.NewDecoder(resp.Body).Decode(&set)
+	if err != nil {
+		return nil, err
+	}
+	keys = map[string]*rsa.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	return keys, nil
+}
+
+// ParsePublicKey parses PEM or base64 encoded DER (PKIX or PKCS1) rsa public keys
+func ParsePublicKey(publicKey string) (key *rsa.PublicKey, err error) {
+	var der []byte
+	if block, _ := pem.Decode([]byte(publicKey)); block != nil {
+		der = block.Bytes
+	} else {
+		der, err = base64.StdEncoding.DecodeString(strings.TrimSpace(publicKey))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if parsed, err := x509.ParsePKIXPublicKey(der); err == nil {
+		key, ok := parsed.(*rsa.PublicKey)
+		if !ok {
+			return nil, errors.New("expect rsa public key")
+		}
+		return key, nil
+	}
+	return x509.ParsePKCS1PublicKey(der)
+}
@@ -0,0 +1,174 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package platform_connector_lib
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SENERGY-Platform/platform-connector-lib/model"
+	"github.com/SENERGY-Platform/platform-connector-lib/security"
+	"github.com/golang-jwt/jwt"
+)
+
+func TestOfflineSecurity(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	usersFile := filepath.Join(t.TempDir(), "users.json")
+	users, _ := json.Marshal(security.StaticUsers{
+		Client: "connector",
+		Users: []security.StaticUser{
+			{Id: "c1", Username: "connector", Roles: []string{"admin"}},
+			{Id: "u1", Username: "user", Password: "pw", Roles: []string{"user"}},
+		},
+	})
+	err = os.WriteFile(usersFile, users, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctl, err := New(Config{
+		SecurityUsersFile: usersFile,
+		JwtPrivateKey:     base64.StdEncoding.EncodeToString(x509.MarshalPKCS1PrivateKey(key)),
+		JwtIssuer:         "test",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec, ok := ctl.Security().(*security.Offline)
+	if !ok {
+		t.Fatalf("%T", ctl.Security())
+	}
+
+	token, err := sec.Access()
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := sec.ValidateToken(token)
+	if err != nil || payload.UserId != "c1" || !slices.Contains(payload.RealmAccess.Roles, "admin") {
+		t.Error(payload, err)
+	}
+
+	_, err = sec.GetUserToken("user", "wrong", model.RemoteInfo{})
+	if !errors.Is(err, security.ErrorAccessDenied) {
+		t.Error(err)
+	}
+	token, err = sec.GetUserToken("user", "pw", model.RemoteInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err = sec.ValidateToken(token)
+	if err != nil || payload.UserId != "u1" {
+		t.Error(payload, err)
+	}
+
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	forger, err := security.NewOfflineFromUsers(security.StaticUsers{Client: "user", Users: []security.StaticUser{{Id: "u1", Username: "user"}}}, "test", base64.StdEncoding.EncodeToString(x509.MarshalPKCS1PrivateKey(other)), 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, _ := forger.Access()
+	_, err = sec.ValidateToken(forged)
+	if !errors.Is(err, security.ErrInvalidToken) {
+		t.Error(err)
+	}
+
+	unsigned, err := security.NewOfflineFromUsers(security.StaticUsers{Client: "user", Users: []security.StaticUser{{Id: "u1", Username: "user"}}}, "test", "", 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsignedToken, _ := unsigned.Access()
+	_, err = unsigned.ValidateToken(unsignedToken)
+	if !errors.Is(err, security.ErrInvalidToken) || !errors.Is(err, security.ErrUnsignedTokens) {
+		t.Error(err)
+	}
+
+	custom, err := NewWithOptions(Config{}, Options{Security: forger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if custom.Security() != Security(forger) {
+		t.Error("custom security not used")
+	}
+}
+
+func TestSecurityValidateToken(t *testing.T) {
+	requests := atomic.Int64{}
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requests.Add(1)
+		if request.URL.Path != "/auth/realms/master/protocol/openid-connect/userinfo" {
+			http.NotFound(writer, request)
+			return
+		}
+		payload, err := security.JwtToken(request.Header.Get("Authorization")).GetPayload()
+		if err != nil || payload.UserId == "revoked" {
+			http.Error(writer, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(writer).Encode(map[string]string{"sub": payload.UserId})
+	}))
+	defer server.Close()
+
+	sec, err := security.New(server.URL, "", "", "", "", 0, 0, 0, nil, 0, 0, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := func(userId string, expiresAt time.Time) security.JwtToken {
+		signed, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{Subject: userId, ExpiresAt: expiresAt.Unix()}).SignedString([]byte("secret"))
+		return security.JwtToken("Bearer " + signed)
+	}
+
+	valid := token("u1", time.Now().Add(time.Hour))
+	for i := 0; i < 3; i++ {
+		payload, err := sec.ValidateToken(valid)
+		if err != nil || payload.UserId != "u1" {
+			t.Error(payload, err)
+		}
+	}
+	if requests.Load() != 1 {
+		t.Error("validation not cached", requests.Load())
+	}
+
+	for _, invalid := range []security.JwtToken{
+		token("revoked", time.Now().Add(time.Hour)),
+		token("u1", time.Now().Add(-time.Minute)),
+		"Bearer invalid",
+	} {
+		_, err = sec.ValidateToken(invalid)
+		if !errors.Is(err, security.ErrInvalidToken) {
+			t.Error(err)
+		}
+	}
+	if requests.Load() != 2 {
+		t.Error(requests.Load())
+	}
+}
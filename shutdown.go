@@ -0,0 +1,246 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package platform_connector_lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+
+	"github.com/SENERGY-Platform/platform-connector-lib/kafka"
+)
+
+var ErrShuttingDown = errors.New("connector is shutting down")
+
+// ShutdownPendingError is returned by Connector.Shutdown, if ctx is done before everything could be drained
+type ShutdownPendingError struct {
+	Consumers   bool           //consumers did not stop in time
+	Commands    int            //number of command handlers still running
+	Events      int            //number of event handlers still running
+	DeadLetters int            //number of dead letters not sent yet
+	SinkWrites  map[string]int //number of pending writes by sink name
+	Producers   []Qos          //producers which could not be flushed in time
+	Postgres    bool           //postgres connections are still in use
+	Err         error
+}
+
+func (this *ShutdownPendingError) Error() string {
+	pending := []string{}
+	if this.Consumers {
+		pending = append(pending, "consumers")
+	}
+	if this.Commands > 0 {
+		pending = append(pending, fmt.Sprintf("commands=%v", this.Commands))
+	}
+	if this.Events > 0 {
+		pending = append(pending, fmt.Sprintf("events=%v", this.Events))
+	}
+	if this.DeadLetters > 0 {
+		pending = append(pending, fmt.Sprintf("dead letters=%v", this.DeadLetters))
+	}
+	for sink, count := range this.SinkWrites {
+		pending = append(pending, fmt.Sprintf("sink %v=%v", sink, count))
+	}
+	for _, qos := range this.Producers {
+		pending = append(pending, fmt.Sprintf("producer qos=%v", qos))
+	}
+	if this.Postgres {
+		pending = append(pending, "postgres")
+	}
+	return fmt.Sprintf("shutdown incomplete: %v; pending: %v", this.Err, strings.Join(pending, ", "))
+}
+
+func (this *ShutdownPendingError) Unwrap() error {
+	return this.Err
+}
+
+// Shutdown stops the command consumers and the event ingestion server, waits for running command and event handlers, queued dead letters and background sink writes,
+// stops the grpc server, flushes the kafka producers and closes the postgres connections.
+// fatal errors are ignored once the shutdown has started.
+// new commands and events are rejected with ErrShuttingDown. commands passed to an AsyncCommandHandler are only tracked until the handler returns.
+// if ctx is done before everything is drained, a *ShutdownPendingError describes what is still pending.
+func (this *Connector) Shutdown(ctx context.Context) error {
+	logger := this.Config.GetLogger()
+	logger.Info("shutdown connector")
+	this.shutdownMux.Lock()
+	this.shuttingDown = true
+	stopEventIngestion := this.stopEventIngestion
+	if this.cancelShutdownCtx != nil {
+		this.cancelShutdownCtx()
+	}
+	this.shutdownMux.Unlock()
+
+	pending := &ShutdownPendingError{SinkWrites: map[string]int{}}
+	incomplete := false
+
+	if this.stopConsumers != nil {
+		this.stopConsumers()
+	}
+	if stopEventIngestion != nil {
+		stopEventIngestion()
+	}
+	if !waitCtx(ctx, this.consumers.Wait) {
+		pending.Consumers = true
+		incomplete = true
+	}
+
+	if !waitCtx(ctx, this.commands.Wait) {
+		pending.Commands = int(this.pendingCommands.Load())
+		incomplete = true
+	}
+
+	if !waitCtx(ctx, this.events.Wait) {
+		pending.Events = int(this.pendingEvents.Load())
+		incomplete = true
+	}
+
+	if !waitCtx(ctx, this.deadLetters.Wait) {
+		pending.DeadLetters = int(this.pendingDeadLetters.Load())
+		incomplete = true
+	}
+
+	//responses of the drained commands have been sent; connected grpc clients may be disconnected
+	if this.grpcServer != nil {
+		this.grpcServer.Stop()
+	}
+
+	for _, sink := range this.sinks {
+		if drainer, ok := sink.sink.(DrainingEventSink); ok {
+			if count := drainer.Drain(ctx); count > 0 {
+				pending.SinkWrites[sink.sink.Name()] = count
+				incomplete = true
+			}
+		}
+	}
+
+	this.producerMux.RLock()
+	producers := maps.Clone(this.producer)
+	this.producerMux.RUnlock()
+	for qos, producer := range producers {
+		closer, ok := producer.(interface{ Close() error })
+		if !ok {
+			continue
+		}
+		var err error
+		if !waitCtx(ctx, func() { err = closer.Close() }) {
+			pending.Producers = append(pending.Producers, qos)
+			incomplete = true
+			continue
+		}
+		if err != nil {
+			logger.Error("unable to close kafka producer", "error", err, "qos", qos)
+		}
+		if outbox, ok := producer.(*kafka.Outbox); ok && outbox.Backlog() > 0 {
+			logger.Info("kafka outbox will be replayed on next start", "qos", qos, "backlog", outbox.Backlog())
+		}
+	}
+
+	if this.postgresPublisher != nil && len(pending.SinkWrites) == 0 {
+		if !waitCtx(ctx, this.postgresPublisher.Close) {
+			pending.Postgres = true
+			incomplete = true
+		}
+	}
+
+	if this.stopTokenRefresher != nil {
+		this.stopTokenRefresher()
+	}
+
+	if isSet(this.Config.IotCacheSnapshotFile) && this.IotCache != nil {
+		if err := this.IotCache.SaveSnapshot(this.Config.IotCacheSnapshotFile); err != nil {
+			logger.Error("unable to save iot cache snapshot", "error", err, "file", this.Config.IotCacheSnapshotFile)
+		}
+	}
+
+	if incomplete {
+		pending.Err = ctx.Err()
+		logger.Error("unable to shutdown connector gracefully", "error", pending)
+		return pending
+	}
+	logger.Info("connector shutdown complete")
+	return nil
+}
+
+func (this *Connector) isShuttingDown() bool {
+	this.shutdownMux.RLock()
+	defer this.shutdownMux.RUnlock()
+	return this.shuttingDown
+}
+
+// shutdownContext returns a context, which is canceled when the shutdown starts (e.g. to stop waiting for command retries)
+func (this *Connector) shutdownContext() context.Context {
+	this.shutdownMux.Lock()
+	defer this.shutdownMux.Unlock()
+	if this.shutdownCtx == nil {
+		this.shutdownCtx, this.cancelShutdownCtx = context.WithCancel(context.Background())
+		if this.shuttingDown {
+			this.cancelShutdownCtx()
+		}
+	}
+	return this.shutdownCtx
+}
+
+// startCommand registers a running command handler; returns false if the connector is shutting down
+func (this *Connector) startCommand() bool {
+	this.shutdownMux.RLock()
+	defer this.shutdownMux.RUnlock()
+	if this.shuttingDown {
+		return false
+	}
+	this.commands.Add(1)
+	this.pendingCommands.Add(1)
+	return true
+}
+
+func (this *Connector) finishCommand() {
+	this.pendingCommands.Add(-1)
+	this.commands.Done()
+}
+
+// startEvent registers a running event handler; returns false if the connector is shutting down
+func (this *Connector) startEvent() bool {
+	this.shutdownMux.RLock()
+	defer this.shutdownMux.RUnlock()
+	if this.shuttingDown {
+		return false
+	}
+	this.events.Add(1)
+	this.pendingEvents.Add(1)
+	return true
+}
+
+func (this *Connector) finishEvent() {
+	this.pendingEvents.Add(-1)
+	this.events.Done()
+}
+
+// waitCtx calls f and returns false if ctx is done before f returns
+func waitCtx(ctx context.Context, f func()) bool {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f()
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
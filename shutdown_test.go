@@ -0,0 +1,152 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package platform_connector_lib
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/SENERGY-Platform/platform-connector-lib/grpccommand"
+	"github.com/SENERGY-Platform/platform-connector-lib/model"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+type DrainingSinkMock struct {
+	SinkMock
+	pending int
+}
+
+func (this *DrainingSinkMock) Drain(ctx context.Context) int {
+	if this.pending > 0 {
+		<-ctx.Done()
+	}
+	return this.pending
+}
+
+func TestShutdown(t *testing.T) {
+	release := make(chan struct{})
+	ctl := &Connector{}
+	ctl.SetAsyncCommandHandler(func(commandRequest model.ProtocolMsg, requestMsg CommandRequestMsg, t time.Time) (err error) {
+		<-release
+		return nil
+	})
+	sink := &DrainingSinkMock{SinkMock: SinkMock{name: "draining"}, pending: 2}
+	ctl.AddEventSink(sink, SinkOptions{})
+
+	go ctl.handleCommand([]byte(`{}`), time.Now())
+	time.Sleep(50 * time.Millisecond)
+	if !ctl.startEvent() {
+		t.Fatal("event rejected before shutdown")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := ctl.Shutdown(ctx)
+	pending := &ShutdownPendingError{}
+	if !errors.As(err, &pending) {
+		t.Fatal(err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) || pending.Commands != 1 || pending.Events != 1 || pending.SinkWrites["draining"] != 2 {
+		t.Error(err)
+	}
+
+	err = ctl.handleCommand([]byte(`{}`), time.Now())
+	if !errors.Is(err, ErrShuttingDown) {
+		t.Error(err)
+	}
+
+	err = ctl.HandleDeviceEventWithAuthTokenCtx(context.Background(), "", "d1", "s1", EventMsg{}, Async)
+	if !errors.Is(err, ErrShuttingDown) {
+		t.Error(err)
+	}
+
+	close(release)
+	ctl.finishEvent()
+	sink.pending = 0
+	err = ctl.Shutdown(context.Background())
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestShutdownStopsServers(t *testing.T) {
+	freePort := func() string {
+		listener, err := net.Listen("tcp", "localhost:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer listener.Close()
+		return strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+	}
+	grpcPort := freePort()
+	ingestionPort := freePort()
+
+	fatalErrors := 0
+	ctl := &Connector{Config: Config{EventIngestionPort: ingestionPort}, grpcServer: grpccommand.New(grpccommand.Config{Port: grpcPort})}
+	ctl.SetFatalErrorHandler(func(err *FatalError) {
+		fatalErrors++
+	})
+	err := ctl.startGrpcCommandConsumer(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ctl.StartEventIngestion(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := grpc.NewClient("localhost:"+grpcPort, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	stream, err := conn.NewStream(context.Background(), &grpc.StreamDesc{ServerStreams: true, ClientStreams: true}, grpccommand.FullMethodName, grpc.ForceCodec(grpccommand.Codec{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = stream.SendMsg(&grpccommand.Message{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ctl.grpcServer.Connected() != 1 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	err = ctl.Shutdown(context.Background())
+	if err != nil {
+		t.Error(err)
+	}
+	if err = stream.RecvMsg(&grpccommand.Message{}); err == nil {
+		t.Error("grpc stream should be closed")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if _, err = http.Get("http://localhost:" + ingestionPort + "/events/d1/s1"); err == nil {
+		t.Error("event ingestion server should be stopped")
+	}
+
+	//e.g. a producer reporting undelivered messages after it has been closed
+	ctl.fatal(&FatalError{Source: FatalKafkaProducer, Err: errors.New("undelivered")})
+	if fatalErrors != 0 {
+		t.Error(fatalErrors)
+	}
+}
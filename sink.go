@@ -0,0 +1,193 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package platform_connector_lib
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/SENERGY-Platform/platform-connector-lib/model"
+	"github.com/SENERGY-Platform/platform-connector-lib/statistics"
+)
+
+// EventSink receives every handled event envelope; must be able to handle concurrent calls
+type EventSink interface {
+	Name() string
+	Send(ctx context.Context, info EventInfo, envelope model.Envelope) error
+}
+
+// BatchEventSink may be implemented by an EventSink to receive the envelopes of HandleDeviceEventBatch in one call
+type BatchEventSink interface {
+	EventSink
+	// SendBatch returns one error per event; a nil entry marks a successfully sent event
+	SendBatch(ctx context.Context, events []SinkEvent) (errs []error)
+}
+
+// DrainingEventSink may be implemented by an EventSink which writes in the background.
+// Drain is called by Connector.Shutdown and returns the number of writes still pending when ctx is done.
+type DrainingEventSink interface {
+	EventSink
+	Drain(ctx context.Context) (pending int)
+}
+
+type SinkEvent struct {
+	Info     EventInfo
+	Envelope model.Envelope
+}
+
+type SinkErrorPolicy int
+
+const (
+	SinkErrorReturn SinkErrorPolicy = iota //error is logged and returned to the caller of the event handler
+	SinkErrorLog                           //error is logged
+	SinkErrorNotify                        //error is logged and the device owners are notified
+	SinkErrorFatal                         //error is logged and the process exits
+)
+
+type SinkOptions struct {
+	Qos         *Qos //optional; overwrites the qos of the handled event
+	ErrorPolicy SinkErrorPolicy
+}
+
+type registeredSink struct {
+	sink    EventSink
+	options SinkOptions
+}
+
+// AddEventSink registers an additional sink for device events; must be called before Start()
+func (this *Connector) AddEventSink(sink EventSink, options SinkOptions) *Connector {
+	this.sinks = append(this.sinks, registeredSink{sink: sink, options: options})
+	return this
+}
+
+// sendToSinks fans the events out to all registered sinks in parallel and returns one error per event
+func (this *Connector) sendToSinks(ctx context.Context, events []SinkEvent) (errs []error) {
+	errs = make([]error, len(events))
+	mux := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for i, sink := range this.sinks {
+		send := func() {
+			sinkErrs := this.sendToSink(ctx, sink, events)
+			mux.Lock()
+			defer mux.Unlock()
+			for j, err := range sinkErrs {
+				if err != nil && errs[j] == nil {
+					errs[j] = err
+				}
+			}
+		}
+		if i == len(this.sinks)-1 {
+			send()
+		} else {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				send()
+			}()
+		}
+	}
+	wg.Wait()
+	return errs
+}
+
+func (this *Connector) sendToSink(ctx context.Context, sink registeredSink, events []SinkEvent) (errs []error) {
+	errs = make([]error, len(events))
+	name := sink.sink.Name()
+	prepared := []SinkEvent{}
+	origin := []int{}
+events:
+	for i, event := range events {
+		info := event.Info
+		info.Sink = name
+		if sink.options.Qos != nil {
+			info.Qos = *sink.options.Qos
+		}
+		envelopes := []model.Envelope{event.Envelope}
+		for _, stage := range sinkStages(name) {
+			next := []model.Envelope{}
+			for _, envelope := range envelopes {
+				temp, err := this.applyEnvelopeMiddlewares(ctx, stage, info, envelope)
+				if err != nil {
+					errs[i] = err
+					continue events
+				}
+				next = append(next, temp...)
+			}
+			envelopes = next
+		}
+		for _, envelope := range envelopes {
+			prepared = append(prepared, SinkEvent{Info: info, Envelope: envelope})
+			origin = append(origin, i)
+		}
+	}
+	if len(prepared) == 0 {
+		return errs
+	}
+
+	start := time.Now()
+	var sendErrs []error
+	if batchSink, ok := sink.sink.(BatchEventSink); ok && len(prepared) > 1 {
+		sendErrs = batchSink.SendBatch(ctx, prepared)
+	} else {
+		sendErrs = make([]error, len(prepared))
+		for j, event := range prepared {
+			sendErrs[j] = sink.sink.Send(ctx, event.Info, event.Envelope)
+		}
+	}
+	statistics.SinkWrite(name, time.Since(start), prepared[0].Info.UserId)
+
+	for j, err := range sendErrs {
+		if err != nil {
+			err = this.handleSinkError(sink, prepared[j], err)
+			if err != nil && errs[origin[j]] == nil {
+				errs[origin[j]] = err
+			}
+		}
+	}
+	return errs
+}
+
+func (this *Connector) handleSinkError(sink registeredSink, event SinkEvent, err error) error {
+	name := sink.sink.Name()
+	statistics.SinkError(name, event.Info.UserId)
+	this.Config.GetLogger().Error("unable to send event to sink", "error", err, "sink", name, "deviceId", event.Envelope.DeviceId, "serviceId", event.Envelope.ServiceId)
+	switch sink.options.ErrorPolicy {
+	case SinkErrorFatal:
+		this.fatal(&FatalError{Source: FatalEventSink, Topic: name, Err: err})
+		return err
+	case SinkErrorNotify:
+		this.notifyDeviceOwners(event.Envelope.DeviceId, Notification{
+			Title:   "Event-Sink-Error",
+			Message: "Error: " + err.Error() + "\n\nSink: " + name + "\nDeviceId: " + event.Envelope.DeviceId + "\nService: " + event.Info.Service.Name + " (" + event.Info.Service.LocalId + ")",
+		})
+	case SinkErrorReturn:
+		return err
+	}
+	return nil
+}
+
+func sinkStages(sinkName string) []EnvelopeStage {
+	switch sinkName {
+	case KafkaSinkName:
+		return []EnvelopeStage{BeforeSink, BeforeKafka}
+	case TimescaleSinkName:
+		return []EnvelopeStage{BeforeSink, BeforePostgres}
+	default:
+		return []EnvelopeStage{BeforeSink}
+	}
+}
@@ -0,0 +1,85 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package platform_connector_lib
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/SENERGY-Platform/platform-connector-lib/model"
+)
+
+type SinkMock struct {
+	name     string
+	err      error
+	mux      sync.Mutex
+	received []SinkEvent
+}
+
+func (this *SinkMock) Name() string {
+	return this.name
+}
+
+func (this *SinkMock) Send(ctx context.Context, info EventInfo, envelope model.Envelope) error {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	this.received = append(this.received, SinkEvent{Info: info, Envelope: envelope})
+	return this.err
+}
+
+func TestSendToSinks(t *testing.T) {
+	returning := &SinkMock{name: "returning", err: errors.New("returned")}
+	logging := &SinkMock{name: "logging", err: errors.New("logged")}
+	syncQos := Sync
+	overwritten := &SinkMock{name: "overwritten"}
+
+	ctl := &Connector{}
+	ctl.Config.GetLogger()
+	ctl.AddEventSink(returning, SinkOptions{ErrorPolicy: SinkErrorReturn}).
+		AddEventSink(logging, SinkOptions{ErrorPolicy: SinkErrorLog}).
+		AddEventSink(overwritten, SinkOptions{Qos: &syncQos}).
+		UseEnvelopeMiddleware(BeforeSink, func(ctx context.Context, info EventInfo, envelope model.Envelope) ([]model.Envelope, error) {
+			if info.Sink == "logging" {
+				return []model.Envelope{envelope, envelope}, nil
+			}
+			return []model.Envelope{envelope}, nil
+		})
+
+	errs := ctl.sendToSinks(context.Background(), []SinkEvent{
+		{Info: EventInfo{Qos: Async}, Envelope: model.Envelope{DeviceId: "d1"}},
+		{Info: EventInfo{Qos: Async}, Envelope: model.Envelope{DeviceId: "d2"}},
+	})
+	if len(errs) != 2 || !errors.Is(errs[0], returning.err) || !errors.Is(errs[1], returning.err) {
+		t.Error(errs)
+	}
+	if len(returning.received) != 2 {
+		t.Error(returning.received)
+	}
+	if len(logging.received) != 4 {
+		t.Error(logging.received)
+	}
+	if len(overwritten.received) != 2 {
+		t.Error(overwritten.received)
+	}
+	for _, event := range overwritten.received {
+		if event.Info.Qos != Sync || event.Info.Sink != "overwritten" {
+			t.Errorf("%#v", event.Info)
+		}
+	}
+}
@@ -40,6 +40,21 @@ var sourceWrites *prometheus.HistogramVec
 var sourceHandled *prometheus.HistogramVec
 var deviceMessages *prometheus.HistogramVec
 var deviceMessagesHandled *prometheus.HistogramVec
+var sinkWrites *prometheus.HistogramVec
+var sinkErrors *prometheus.CounterVec
+var outboxBacklog *prometheus.GaugeVec
+var outboxBacklogBytes *prometheus.GaugeVec
+var outboxDropped *prometheus.CounterVec
+var deadLetters *prometheus.CounterVec
+var fatalErrors *prometheus.CounterVec
+var consumerReconnects *prometheus.CounterVec
+var consumerState *prometheus.GaugeVec
+var authTokenRefreshes *prometheus.CounterVec
+var authTokenIssued *prometheus.GaugeVec
+var authTokenExpiry *prometheus.GaugeVec
+var rateLimited *prometheus.CounterVec
+var iotCoalesced *prometheus.CounterVec
+var iotCircuitState *prometheus.GaugeVec
 var instanceId string
 
 func Init() {
@@ -51,6 +66,24 @@ func IotRead(duration time.Duration) {
 	iotReads.WithLabelValues(instanceId).Observe(float64(duration.Milliseconds()))
 }
 
+// IotRequestCoalesced counts iot lookups which have been served by a concurrent request for the same cache key; entity is the cache key prefix (e.g. device, dt)
+func IotRequestCoalesced(entity string) {
+	once.Do(start)
+	iotCoalesced.WithLabelValues(entity, instanceId).Inc()
+}
+
+// IotCircuitBreakerState sets the gauge of the current device repository circuit breaker state to 1 and of all other states to 0
+func IotCircuitBreakerState(state string) {
+	once.Do(start)
+	for _, s := range []string{"closed", "open", "half-open"} {
+		value := 0.0
+		if s == state {
+			value = 1
+		}
+		iotCircuitState.WithLabelValues(s, instanceId).Set(value)
+	}
+}
+
 func CacheRead(duration time.Duration) {
 	once.Do(start)
 	cacheReads.WithLabelValues(instanceId).Observe(float64(duration.Milliseconds()))
@@ -71,6 +104,109 @@ func KafkaWrite(duration time.Duration, userId string) {
 	kafkaWrites.WithLabelValues(userId, instanceId).Observe(float64(duration.Milliseconds()))
 }
 
+func SinkWrite(sink string, duration time.Duration, userId string) {
+	once.Do(start)
+	sinkWrites.WithLabelValues(sink, userId, instanceId).Observe(float64(duration.Milliseconds()))
+}
+
+func SinkError(sink string, userId string) {
+	once.Do(start)
+	sinkErrors.WithLabelValues(sink, userId, instanceId).Inc()
+}
+
+func KafkaOutboxBacklog(outbox string, messages int, bytes int64) {
+	once.Do(start)
+	outboxBacklog.WithLabelValues(outbox, instanceId).Set(float64(messages))
+	outboxBacklogBytes.WithLabelValues(outbox, instanceId).Set(float64(bytes))
+}
+
+func KafkaOutboxDropped(outbox string, reason string) {
+	once.Do(start)
+	outboxDropped.WithLabelValues(outbox, reason, instanceId).Inc()
+}
+
+func DeadLetter(msgType string, errorClass string) {
+	once.Do(start)
+	deadLetters.WithLabelValues(msgType, errorClass, instanceId).Inc()
+}
+
+var handlersMux sync.Mutex
+var handlers = map[string]*replaceableHandler{}
+
+type replaceableHandler struct {
+	mux     sync.RWMutex
+	handler http.Handler
+}
+
+func (this *replaceableHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	this.mux.RLock()
+	handler := this.handler
+	this.mux.RUnlock()
+	handler.ServeHTTP(writer, request)
+}
+
+// Handle registers an additional handler on the metrics server (:2112) and starts the server if necessary.
+// the pattern is registered only once; later calls with the same pattern replace the handler.
+func Handle(pattern string, handler http.Handler) {
+	handlersMux.Lock()
+	registered, ok := handlers[pattern]
+	if ok {
+		registered.mux.Lock()
+		registered.handler = handler
+		registered.mux.Unlock()
+	} else {
+		registered = &replaceableHandler{handler: handler}
+		handlers[pattern] = registered
+		http.Handle(pattern, registered)
+	}
+	handlersMux.Unlock()
+	once.Do(start)
+}
+
+func FatalError(source string) {
+	once.Do(start)
+	fatalErrors.WithLabelValues(source, instanceId).Inc()
+}
+
+func KafkaConsumerReconnect(topic string) {
+	once.Do(start)
+	consumerReconnects.WithLabelValues(topic, instanceId).Inc()
+}
+
+// KafkaConsumerState sets the gauge of the current state to 1 and of all other states to 0
+func KafkaConsumerState(topic string, state string) {
+	once.Do(start)
+	for _, s := range []string{"running", "reconnecting", "stopped"} {
+		value := 0.0
+		if s == state {
+			value = 1
+		}
+		consumerState.WithLabelValues(topic, s, instanceId).Set(value)
+	}
+}
+
+func AuthTokenRefresh(success bool) {
+	once.Do(start)
+	result := "success"
+	if !success {
+		result = "error"
+	}
+	authTokenRefreshes.WithLabelValues(result, instanceId).Inc()
+}
+
+// AuthToken records the request and expiry time of the current access token; the token age is time() - connector_auth_token_issued_timestamp_seconds
+func AuthToken(issued time.Time, expires time.Time) {
+	once.Do(start)
+	authTokenIssued.WithLabelValues(instanceId).Set(float64(issued.Unix()))
+	authTokenExpiry.WithLabelValues(instanceId).Set(float64(expires.Unix()))
+}
+
+// RateLimited counts messages rejected by a rate limit; scope is device, user or hub; msgType is event or command
+func RateLimited(scope string, msgType string) {
+	once.Do(start)
+	rateLimited.WithLabelValues(scope, msgType, instanceId).Inc()
+}
+
 func SourceReceive(size float64, userId string) {
 	once.Do(start)
 	sourceWrites.WithLabelValues(userId, instanceId).Observe(size)
@@ -102,6 +238,14 @@ func start() {
 		Help:    "Latency of IoT metadata reads",
 		Buckets: buckets,
 	}, []string{"instance_id"})
+	iotCoalesced = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "connector_iot_coalesced_requests_total",
+		Help: "Total number of iot lookups served by a concurrent request for the same key",
+	}, []string{"entity", "instance_id"})
+	iotCircuitState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "connector_iot_circuit_breaker_state",
+		Help: "Current state of the device repository circuit breaker (closed, open, half-open)",
+	}, []string{"state", "instance_id"})
 	cacheReads = promauto.NewHistogramVec(prometheus.HistogramOpts{
 		Name:    "connector_cache_read_latency_ms",
 		Help:    "Latency of cache reads",
@@ -141,6 +285,59 @@ func start() {
 		Help:    "Latency of timescale writes",
 		Buckets: buckets,
 	}, []string{"user_id", "instance_id"})
+	sinkWrites = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "connector_sink_write_latency_ms",
+		Help:    "Latency of event sink writes",
+		Buckets: buckets,
+	}, []string{"sink", "user_id", "instance_id"})
+	sinkErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "connector_sink_errors_total",
+		Help: "Total number of failed event sink writes",
+	}, []string{"sink", "user_id", "instance_id"})
+	outboxBacklog = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "connector_kafka_outbox_backlog_messages",
+		Help: "Number of messages waiting in the kafka outbox",
+	}, []string{"outbox", "instance_id"})
+	outboxBacklogBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "connector_kafka_outbox_backlog_bytes",
+		Help: "Size of the messages waiting in the kafka outbox",
+	}, []string{"outbox", "instance_id"})
+	outboxDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "connector_kafka_outbox_dropped_total",
+		Help: "Total number of messages dropped by the kafka outbox",
+	}, []string{"outbox", "reason", "instance_id"})
+	deadLetters = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "connector_dead_letters_total",
+		Help: "Total number of rejected messages sent to the dead letter topic",
+	}, []string{"type", "error_class", "instance_id"})
+	fatalErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "connector_fatal_errors_total",
+		Help: "Total number of fatal errors passed to the fatal error handler",
+	}, []string{"source", "instance_id"})
+	consumerReconnects = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "connector_kafka_consumer_reconnects_total",
+		Help: "Total number of kafka consumer reconnects",
+	}, []string{"topic", "instance_id"})
+	consumerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "connector_kafka_consumer_state",
+		Help: "Current state of the kafka consumer (running, reconnecting, stopped)",
+	}, []string{"topic", "state", "instance_id"})
+	authTokenRefreshes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "connector_auth_token_refreshes_total",
+		Help: "Total number of background access token refreshes by result (success, error)",
+	}, []string{"result", "instance_id"})
+	authTokenIssued = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "connector_auth_token_issued_timestamp_seconds",
+		Help: "Request time of the current access token",
+	}, []string{"instance_id"})
+	authTokenExpiry = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "connector_auth_token_expiry_timestamp_seconds",
+		Help: "Expiry time of the current access token",
+	}, []string{"instance_id"})
+	rateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "connector_rate_limited_total",
+		Help: "Total number of messages rejected by a rate limit",
+	}, []string{"scope", "type", "instance_id"})
 	hostname, err := os.Hostname()
 	if err != nil {
 		hostname = "unknown"
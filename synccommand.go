@@ -0,0 +1,204 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package platform_connector_lib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/SENERGY-Platform/platform-connector-lib/httpcommand"
+	"github.com/SENERGY-Platform/platform-connector-lib/model"
+	"github.com/SENERGY-Platform/platform-connector-lib/security"
+)
+
+// ErrUnknownDevice may be returned (wrapped) by command handlers; http commands are answered with 404
+var ErrUnknownDevice = errors.New("unknown device")
+
+var ErrCommandOverload = errors.New("too many pending commands")
+var ErrSyncCommandPending = errors.New("synchronous command with the same task id is already pending")
+var ErrMissingTaskId = errors.New("synchronous commands require task_info.task_id")
+
+// syncCommandError marks errors of synchronous commands; unclassified errors of the device or the command handler are answered with 502
+type syncCommandError struct {
+	err error
+}
+
+func (this *syncCommandError) Error() string {
+	return this.err.Error()
+}
+
+func (this *syncCommandError) Unwrap() error {
+	return this.err
+}
+
+type syncCommandResult struct {
+	response CommandResponseMsg
+	err      error
+}
+
+func (this *Connector) getHttpCommandConfig() (config httpcommand.Config, err error) {
+	config = httpcommand.Config{
+		Port:        this.Config.HttpCommandConsumerPort,
+		Logger:      this.Config.GetLogger(),
+		CorsOrigins: this.Config.HttpCommandCorsOrigins,
+		ErrorStatus: getHttpCommandErrorStatus,
+	}
+	if len(config.CorsOrigins) == 0 {
+		config.CorsOrigins = []string{"*"}
+	}
+	if config.CorsOrigins[0] == "-" {
+		config.CorsOrigins = nil
+	}
+	if isSet(this.Config.HttpCommandTimeout) {
+		config.ReadTimeout, err = time.ParseDuration(this.Config.HttpCommandTimeout)
+		if err != nil {
+			return config, errors.New("unable to parse HttpCommandTimeout as duration: " + err.Error())
+		}
+		config.SyncTimeout = config.ReadTimeout
+	}
+	if isSet(this.Config.HttpCommandTlsCert) {
+		config.TlsCertFile = this.Config.HttpCommandTlsCert
+		config.TlsKeyFile = this.Config.HttpCommandTlsKey
+	}
+	if isSet(this.Config.HttpCommandTlsClientCa) {
+		config.TlsClientCaFile = this.Config.HttpCommandTlsClientCa
+	}
+	if this.Config.HttpCommandJwtAuth {
+		if _, ok := this.security.(TokenValidator); !ok && this.tokenVerifier == nil {
+			return config, errors.New("HttpCommandJwtAuth requires Config.JwtVerify or a Security implementing TokenValidator")
+		}
+		config.Authenticate = func(request *http.Request) error {
+			_, err := this.validateToken(security.JwtToken(request.Header.Get("Authorization")))
+			return err
+		}
+	}
+	return config, nil
+}
+
+func (this *Connector) handleHttpCommand(ctx context.Context, msg []byte, sync bool) (response []byte, err error) {
+	if this.Config.HttpCommandMaxPending > 0 && this.pendingCommands.Load() >= int64(this.Config.HttpCommandMaxPending) {
+		return nil, ErrCommandOverload
+	}
+	if !sync {
+		return nil, this.handleCommand(msg, time.Now())
+	}
+	protocolmsg := model.ProtocolMsg{}
+	err = json.Unmarshal(msg, &protocolmsg)
+	if err != nil {
+		return nil, rejected(DeadLetterMarshalling, err)
+	}
+	key, ok := getCommandKey(protocolmsg)
+	if !ok {
+		return nil, ErrMissingTaskId
+	}
+	result := make(chan syncCommandResult, 1)
+	this.syncCommandsMux.Lock()
+	if this.syncCommands == nil {
+		this.syncCommands = map[string]chan syncCommandResult{}
+	}
+	if _, exists := this.syncCommands[key]; exists {
+		this.syncCommandsMux.Unlock()
+		return nil, ErrSyncCommandPending
+	}
+	this.syncCommands[key] = result
+	this.syncCommandsMux.Unlock()
+	defer func() {
+		this.syncCommandsMux.Lock()
+		delete(this.syncCommands, key)
+		this.syncCommandsMux.Unlock()
+	}()
+
+	err = this.handleCommand(msg, time.Now())
+	if err != nil {
+		return nil, &syncCommandError{err: err}
+	}
+	select {
+	case <-ctx.Done():
+		return nil, errors.Join(ErrCommandTimeout, ctx.Err())
+	case r := <-result:
+		if r.err != nil {
+			return nil, &syncCommandError{err: r.err}
+		}
+		return json.Marshal(r.response)
+	}
+}
+
+// resolveSyncCommand passes the result to a waiting synchronous http command; returns false if no one is waiting
+func (this *Connector) resolveSyncCommand(commandRequest model.ProtocolMsg, response CommandResponseMsg, err error) bool {
+	key, ok := getCommandKey(commandRequest)
+	if !ok {
+		return false
+	}
+	this.syncCommandsMux.Lock()
+	defer this.syncCommandsMux.Unlock()
+	result, ok := this.syncCommands[key]
+	if !ok {
+		return false
+	}
+	select {
+	case result <- syncCommandResult{response: response, err: err}:
+	default: //already resolved
+	}
+	return true
+}
+
+func getSyncCommandError(reason CommandErrorReason, errorMessage string) error {
+	return wrapSyncCommandError(reason, errors.New(errorMessage))
+}
+
+func wrapSyncCommandError(reason CommandErrorReason, err error) error {
+	switch reason {
+	case CommandErrorTimeout:
+		if errors.Is(err, ErrCommandTimeout) {
+			return err
+		}
+		return errors.Join(ErrCommandTimeout, err)
+	case CommandErrorExpired:
+		return errors.Join(ErrCommandExpired, err)
+	case CommandErrorRateLimited:
+		return errors.Join(ErrRateLimited, err)
+	default:
+		return err
+	}
+}
+
+func getHttpCommandErrorStatus(err error) int {
+	var rejectedErr *RejectedError
+	switch {
+	case errors.As(err, &rejectedErr), errors.Is(err, ErrMissingTaskId):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrUnknownDevice), errors.Is(err, security.ErrorNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrSyncCommandPending):
+		return http.StatusConflict
+	case errors.Is(err, ErrRateLimited):
+		return http.StatusTooManyRequests
+	case errors.Is(err, ErrCommandOverload), errors.Is(err, ErrShuttingDown):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, ErrCommandTimeout), errors.Is(err, ErrCommandExpired):
+		return http.StatusGatewayTimeout
+	default:
+		var syncErr *syncCommandError
+		if errors.As(err, &syncErr) {
+			return http.StatusBadGateway //the device or the command handler failed
+		}
+		return http.StatusBadRequest
+	}
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package platform_connector_lib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/SENERGY-Platform/platform-connector-lib/model"
+	"github.com/SENERGY-Platform/platform-connector-lib/security"
+)
+
+func TestSyncHttpCommand(t *testing.T) {
+	sec, err := security.New("http://localhost:0", "", "", "", "", 0, 0, 0, nil, 0, 0, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctl := &Connector{security: sec} //responses are not sent as events, because no token is available
+	ctl.SetDeviceCommandHandler(func(deviceId string, deviceUri string, serviceId string, serviceUri string, requestMsg CommandRequestMsg) (responseMsg CommandResponseMsg, qos Qos, err error) {
+		switch deviceId {
+		case "unknown":
+			return nil, Sync, fmt.Errorf("%w: %v", ErrUnknownDevice, deviceId)
+		case "slow":
+			time.Sleep(200 * time.Millisecond)
+		case "failing":
+			return nil, Sync, errors.New("device failed")
+		}
+		return CommandResponseMsg{"device": deviceId}, Sync, nil
+	})
+	ctl.SetCommandOptions(CommandOptions{Timeout: 100 * time.Millisecond})
+
+	command := func(taskId string, deviceId string) []byte {
+		msg := model.ProtocolMsg{
+			TaskInfo: model.TaskInfo{TaskId: taskId},
+			Metadata: model.Metadata{Device: model.Device{Id: deviceId}},
+		}
+		result, _ := json.Marshal(msg)
+		return result
+	}
+
+	response, err := ctl.handleHttpCommand(context.Background(), command("t1", "d1"), true)
+	if err != nil {
+		t.Error(err)
+	}
+	if string(response) != `{"device":"d1"}` {
+		t.Error(string(response))
+	}
+
+	for _, c := range []struct {
+		msg    []byte
+		status int
+	}{
+		{msg: command("t2", "unknown"), status: http.StatusNotFound},
+		{msg: command("t3", "slow"), status: http.StatusGatewayTimeout},
+		{msg: command("t5", "failing"), status: http.StatusBadGateway},
+		{msg: command("", "d1"), status: http.StatusBadRequest},
+		{msg: []byte("invalid"), status: http.StatusBadRequest},
+	} {
+		_, err = ctl.handleHttpCommand(context.Background(), c.msg, true)
+		if status := getHttpCommandErrorStatus(err); err == nil || status != c.status {
+			t.Error(string(c.msg), status, err)
+		}
+	}
+
+	//handler errors of asynchronous commands keep the default status
+	if status := getHttpCommandErrorStatus(errors.New("device failed")); status != http.StatusBadRequest {
+		t.Error(status)
+	}
+
+	ctl.Config.HttpCommandMaxPending = 1
+	ctl.pendingCommands.Add(1)
+	_, err = ctl.handleHttpCommand(context.Background(), command("t4", "d1"), false)
+	if status := getHttpCommandErrorStatus(err); status != http.StatusServiceUnavailable {
+		t.Error(status, err)
+	}
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package platform_connector_lib
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/SENERGY-Platform/platform-connector-lib/model"
+	"github.com/SENERGY-Platform/platform-connector-lib/psql"
+	"github.com/SENERGY-Platform/platform-connector-lib/statistics"
+)
+
+const TimescaleSinkName = "timescale"
+
+// TimescaleSink writes envelopes to the timescale tables of the device services.
+// envelopes with Async qos are written in the background; errors of these writes are only logged.
+type TimescaleSink struct {
+	publisher         *psql.Publisher
+	asyncBackpressure chan bool //used to limit go routines for async postgres publishing
+	asyncWrites       sync.WaitGroup
+	logger            *slog.Logger
+	notify            func(deviceId string, message Notification)
+}
+
+func NewTimescaleSink(publisher *psql.Publisher, maxAsyncWrites int, logger *slog.Logger, notify func(deviceId string, message Notification)) *TimescaleSink {
+	if maxAsyncWrites <= 0 {
+		maxAsyncWrites = 1000
+	}
+	return &TimescaleSink{
+		publisher:         publisher,
+		asyncBackpressure: make(chan bool, maxAsyncWrites),
+		logger:            logger,
+		notify:            notify,
+	}
+}
+
+func (this *TimescaleSink) Name() string {
+	return TimescaleSinkName
+}
+
+func (this *TimescaleSink) Send(ctx context.Context, info EventInfo, envelope model.Envelope) error {
+	if info.Qos != Async {
+		return this.publish(ctx, info, envelope)
+	}
+	select {
+	case this.asyncBackpressure <- true: //reserve one of the limited go routines
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	this.asyncWrites.Add(1)
+	go func() {
+		defer func() {
+			<-this.asyncBackpressure //free one of the limited go routines
+			this.asyncWrites.Done()
+		}()
+		err := this.publish(context.WithoutCancel(ctx), info, envelope)
+		if err != nil {
+			this.logger.Error("unable to publish event to postgres", "error", err)
+		}
+	}()
+	return nil
+}
+
+// Drain waits for running async writes
+func (this *TimescaleSink) Drain(ctx context.Context) (pending int) {
+	done := make(chan struct{})
+	go func() {
+		this.asyncWrites.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return 0
+	case <-ctx.Done():
+		return len(this.asyncBackpressure)
+	}
+}
+
+func (this *TimescaleSink) publish(ctx context.Context, info EventInfo, envelope model.Envelope) error {
+	start := time.Now()
+	err, shouldNotify := this.publisher.PublishCtx(ctx, envelope, info.Service)
+	if err != nil {
+		if shouldNotify && this.notify != nil {
+			this.notify(envelope.DeviceId, Notification{
+				Title:   "DeviceType Timescale Configuration Error",
+				Message: "Error: " + err.Error() + "\n\nDeviceId: " + envelope.DeviceId + "\nService: " + info.Service.Name + " (" + info.Service.LocalId + ")",
+			})
+		}
+		return err
+	}
+	statistics.TimescaleWrite(time.Since(start), info.UserId)
+	return nil
+}
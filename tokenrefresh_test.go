@@ -0,0 +1,88 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package platform_connector_lib
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SENERGY-Platform/platform-connector-lib/security"
+)
+
+func TestTokenRefresher(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	current := atomic.Value{}
+	current.Store("t1")
+	requests := atomic.Int64{}
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requests.Add(1)
+		token := current.Load().(string)
+		if token == "" {
+			http.Error(writer, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		_ = json.NewEncoder(writer).Encode(security.OpenidToken{AccessToken: token, ExpiresIn: 60})
+	}))
+	defer server.Close()
+
+	sec, err := security.New(server.URL, "client", "secret", "", "", 0, 1, 0, nil, 0, 0, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec.StartTokenRefresher(ctx)
+
+	waitFor := func(expected security.JwtToken) {
+		t.Helper()
+		for i := 0; i < 100; i++ {
+			if token, _ := sec.Access(); token == expected {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatal("timeout waiting for", expected)
+	}
+	waitFor("Bearer t1")
+	if requests.Load() != 1 {
+		t.Error(requests.Load())
+	}
+
+	//auth outage: last good token is served
+	current.Store("")
+	sec.ResetAccess()
+	for requests.Load() < 2 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	token, err := sec.Access()
+	if err != nil || token != "Bearer t1" {
+		t.Error(token, err)
+	}
+
+	current.Store("t2")
+	sec.ResetAccess()
+	waitFor("Bearer t2")
+	if sec.TokenAge() <= 0 || sec.TokenAge() > time.Second {
+		t.Error(sec.TokenAge())
+	}
+}
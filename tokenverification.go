@@ -0,0 +1,68 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package platform_connector_lib
+
+import (
+	"errors"
+
+	"github.com/SENERGY-Platform/platform-connector-lib/security"
+)
+
+// TokenValidator is an optional Security extension; used to authenticate bearer tokens if Config.JwtVerify is not set
+type TokenValidator interface {
+	ValidateToken(token security.JwtToken) (payload security.JwtPayload, err error)
+}
+
+func newTokenVerifier(config Config) (*security.Verifier, error) {
+	if !config.JwtVerify {
+		return nil, nil
+	}
+	verifierConfig := security.VerifierConfig{Issuer: getOptional(config.JwtVerifyIssuer)}
+	if isSet(config.JwtPublicKey) {
+		verifierConfig.PublicKey = config.JwtPublicKey
+	} else if isSet(config.AuthEndpoint) {
+		verifierConfig.JwksUrl = config.AuthEndpoint + "/auth/realms/master/protocol/openid-connect/certs"
+	} else {
+		return nil, errors.New("JwtVerify requires JwtPublicKey or AuthEndpoint")
+	}
+	return security.NewVerifier(verifierConfig)
+}
+
+// verifyToken checks tokens passed by the caller, if Config.JwtVerify is set; returns an error wrapping security.ErrorAccessDenied
+func (this *Connector) verifyToken(token security.JwtToken) error {
+	if this.tokenVerifier == nil {
+		return nil
+	}
+	_, err := this.tokenVerifier.Verify(token)
+	if err != nil {
+		this.Config.GetLogger().Warn("reject token", "error", err)
+		return rejected(DeadLetterAuth, err)
+	}
+	return nil
+}
+
+// validateToken authenticates bearer tokens of http clients
+func (this *Connector) validateToken(token security.JwtToken) (payload security.JwtPayload, err error) {
+	if this.tokenVerifier != nil {
+		return this.tokenVerifier.Verify(token)
+	}
+	validator, ok := this.security.(TokenValidator)
+	if !ok {
+		return payload, errors.New("bearer token authentication requires Config.JwtVerify or a Security implementing TokenValidator")
+	}
+	return validator.ValidateToken(token)
+}
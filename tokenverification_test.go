@@ -0,0 +1,150 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package platform_connector_lib
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SENERGY-Platform/platform-connector-lib/security"
+	"github.com/golang-jwt/jwt"
+)
+
+func TestTokenVerification(t *testing.T) {
+	key1, _ := rsa.GenerateKey(rand.Reader, 2048)
+	key2, _ := rsa.GenerateKey(rand.Reader, 2048)
+	sign := func(key *rsa.PrivateKey, kid string, issuer string, expiresAt time.Time) security.JwtToken {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, security.KeycloakClaims{StandardClaims: jwt.StandardClaims{Subject: "u1", Issuer: issuer, ExpiresAt: expiresAt.Unix()}})
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return security.JwtToken("Bearer " + signed)
+	}
+	valid := time.Now().Add(time.Hour)
+
+	t.Run("public key", func(t *testing.T) {
+		ctl := &Connector{}
+		var err error
+		ctl.tokenVerifier, err = newTokenVerifier(Config{JwtVerify: true, JwtVerifyIssuer: "iss", JwtPublicKey: base64.StdEncoding.EncodeToString(x509.MarshalPKCS1PublicKey(&key1.PublicKey))})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = ctl.verifyToken(sign(key1, "", "iss", valid)); err != nil {
+			t.Error(err)
+		}
+		withoutExp, _ := jwt.NewWithClaims(jwt.SigningMethodRS256, security.KeycloakClaims{StandardClaims: jwt.StandardClaims{Subject: "u1", Issuer: "iss"}}).SignedString(key1)
+		for _, token := range []security.JwtToken{
+			security.JwtToken("Bearer " + withoutExp),
+			sign(key1, "", "iss", time.Now().Add(-time.Minute)),
+			sign(key1, "", "other", valid),
+			sign(key2, "", "iss", valid),
+			"Bearer invalid",
+		} {
+			err = ctl.verifyToken(token)
+			if !errors.Is(err, security.ErrorAccessDenied) {
+				t.Error(err)
+			}
+		}
+		err = ctl.HandleDeviceEventWithAuthTokenCtx(context.Background(), sign(key1, "", "iss", time.Now().Add(-time.Minute)), "d1", "s1", EventMsg{}, Async)
+		if !errors.Is(err, security.ErrorAccessDenied) {
+			t.Error(err)
+		}
+	})
+
+	t.Run("jwks", func(t *testing.T) {
+		current := atomic.Value{}
+		current.Store(map[string]*rsa.PublicKey{"k1": &key1.PublicKey})
+		requests := atomic.Int64{}
+		server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			requests.Add(1)
+			if request.URL.Path != "/auth/realms/master/protocol/openid-connect/certs" {
+				http.NotFound(writer, request)
+				return
+			}
+			keys := []map[string]string{}
+			for kid, key := range current.Load().(map[string]*rsa.PublicKey) {
+				keys = append(keys, map[string]string{
+					"kid": kid,
+					"kty": "RSA",
+					"use": "sig",
+					"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+					"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+				})
+			}
+			_ = json.NewEncoder(writer).Encode(map[string]any{"keys": keys})
+		}))
+		defer server.Close()
+
+		verifier, err := security.NewVerifier(security.VerifierConfig{JwksUrl: server.URL + "/auth/realms/master/protocol/openid-connect/certs", JwksRefreshInterval: time.Nanosecond})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctl := &Connector{tokenVerifier: verifier}
+		for i := 0; i < 3; i++ {
+			if err = ctl.verifyToken(sign(key1, "k1", "", valid)); err != nil {
+				t.Error(err)
+			}
+		}
+		if requests.Load() != 1 {
+			t.Error("jwks not cached", requests.Load())
+		}
+
+		//rotation
+		current.Store(map[string]*rsa.PublicKey{"k2": &key2.PublicKey})
+		if err = ctl.verifyToken(sign(key2, "k2", "", valid)); err != nil {
+			t.Error(err)
+		}
+		if err = ctl.verifyToken(sign(key1, "k2", "", valid)); !errors.Is(err, security.ErrorAccessDenied) {
+			t.Error(err)
+		}
+
+		//refreshes of an expired cache are throttled too
+		verifier, err = security.NewVerifier(security.VerifierConfig{JwksUrl: server.URL + "/auth/realms/master/protocol/openid-connect/certs", JwksCacheDuration: time.Nanosecond, JwksRefreshInterval: time.Hour})
+		if err != nil {
+			t.Fatal(err)
+		}
+		requests.Store(0)
+		wg := sync.WaitGroup{}
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := verifier.Verify(sign(key2, "k2", "", valid)); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+		if requests.Load() != 1 {
+			t.Error("jwks refresh not throttled", requests.Load())
+		}
+	})
+}